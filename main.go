@@ -1,15 +1,38 @@
 package main
 
 import (
+	"bufio"
+	"context"
 	"embed"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
+	"io/fs"
 	"log"
+	"log/slog"
+	"net/http"
 	"os"
 	"os/signal"
+	"runtime/debug"
+	"strings"
 	"syscall"
 
+	"github.com/pynezz/wasmdash/pkg/auth"
+	"github.com/pynezz/wasmdash/pkg/config"
+	"github.com/pynezz/wasmdash/pkg/core"
+	"github.com/pynezz/wasmdash/pkg/csp"
+	"github.com/pynezz/wasmdash/pkg/health"
+	"github.com/pynezz/wasmdash/pkg/logging"
 	"github.com/pynezz/wasmdash/pkg/server"
+	"github.com/pynezz/wasmdash/pkg/storage"
+	"github.com/pynezz/wasmdash/pkg/storage/sqlite"
+	"github.com/pynezz/wasmdash/pkg/system"
+	"github.com/pynezz/wasmdash/pkg/ui/widgets"
+
+	// Built-in widget types, registered on import
+	_ "github.com/pynezz/wasmdash/pkg/ui/widgets/stat"
+	_ "github.com/pynezz/wasmdash/pkg/ui/widgets/text"
 )
 
 //go:generate tailwindcss -i assets/css/base.css -o static/css/styles.css -m
@@ -31,6 +54,10 @@ type WConfig struct {
 	Port string
 	Host string
 	Env  string
+	Name string
+
+	// Settings is the fully resolved configuration (file, environment and flags)
+	Settings *config.Config
 }
 
 func main() {
@@ -42,95 +69,408 @@ func main() {
 	}
 
 	// Set up command line flags
+	defaults := config.Default()
 	helpFlag := flag.Bool("help", false, "Show this help message")
-	portFlag := flag.String("port", "8080", "Port to listen on")
-	hostFlag := flag.String("host", "localhost", "Host to listen on")
-	envFlag := flag.String("env", "development", "Environment to run in (development, production)")
+	configFlag := flag.String("config", os.Getenv("WASMDASH_CONFIG"), "Path to wasmdash.toml")
+	portFlag := flag.String("port", string(defaults.Server.Port), "Port to listen on")
+	hostFlag := flag.String("host", defaults.Server.Host, "Host to listen on")
+	envFlag := flag.String("env", defaults.Server.Env, "Environment to run in (development, production)")
 
 	// Parse the command line flags
 	flag.Parse()
 
+	// Subcommands
+	switch flag.Arg(0) {
+	case "":
+	case "hash-password":
+		if err := hashPassword(); err != nil {
+			fmt.Fprintf(os.Stderr, "hash-password: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	case "token":
+		os.Exit(tokenCommand(*configFlag, flag.Args()[1:]))
+	case "secret":
+		os.Exit(secretCommand(*configFlag, flag.Args()[1:]))
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q, see --help\n", flag.Arg(0))
+		os.Exit(2)
+	}
+
 	// Check if help was requested
 	if *helpFlag {
 		showHelp()
 		return
 	}
 
-	// Apply parsed flags to configuration
-	app.Config.Port = *portFlag
-	app.Config.Host = *hostFlag
-	app.Config.Env = *envFlag
+	// Load the config file and WASMDASH_* overrides, flags that were set
+	// explicitly take final precedence
+	var overrides []config.Override
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "port":
+			overrides = append(overrides, config.Override{
+				Key:    "server.port",
+				Source: "--port",
+				Set:    func(cfg *config.Config) { cfg.Server.Port = config.Port(*portFlag) },
+			})
+		case "host":
+			overrides = append(overrides, config.Override{
+				Key:    "server.host",
+				Source: "--host",
+				Set:    func(cfg *config.Config) { cfg.Server.Host = *hostFlag },
+			})
+		case "env":
+			overrides = append(overrides, config.Override{
+				Key:    "server.env",
+				Source: "--env",
+				Set:    func(cfg *config.Config) { cfg.Server.Env = *envFlag },
+			})
+		}
+	})
+	settings, err := config.Load(*configFlag, overrides...)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	app.Config.Port = string(settings.Server.Port)
+	app.Config.Host = settings.Server.Host
+	app.Config.Env = settings.Server.Env
+	app.Config.Name = settings.Server.Name
+	app.Config.Settings = settings
 
 	fmt.Printf("\033[34mDatdash v%s - %s running on %s\n:\033[36m%s/%s\n\033[0m", app.Version, app.Build, app.Config.Host, app.Config.Port, app.Config.Env)
 
-	// Configure logging
-	os.Setenv("WLOGPATH", "wasmdash.log")
+	// Log to stdout and/or a rotated file, the log package included
+	logger, logs, err := logging.New(logging.Config{
+		Level:      settings.Log.Level,
+		Format:     settings.Log.Format,
+		Stdout:     settings.Log.Stdout,
+		File:       settings.Log.File,
+		MaxSize:    int64(settings.Log.MaxSize) << 20,
+		MaxAge:     settings.Log.MaxAge,
+		MaxBackups: settings.Log.MaxBackups,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "configuring logging: %v\n", err)
+		os.Exit(1)
+	}
+	defer logs.Close()
+	slog.SetDefault(logger)
+
 	log.Printf("Starting WasmDash (Version: %s, Build: %s)", app.Version, app.Build)
 	log.Printf("Configuration: Host=%s, Port=%s, Environment=%s", app.Config.Host, app.Config.Port, app.Config.Env)
 
-	// Run the server
-	if err := runServer(app.Config); err != nil {
-		log.Fatalf("Server failed to start: %v", err)
+	// Pages are only rendered with a nonce, make sure there's entropy for them
+	if err := core.Nonces.Fill(); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+
+	// Open the secrets widgets reference as ${secret:name}
+	checks := health.NewRegistry()
+	if err := openSecrets(settings.Secrets, checks); err != nil {
+		fmt.Fprintf(os.Stderr, "opening secrets: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Load widget definitions
+	defs, err := widgets.LoadDir(settings.Widgets.Dir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid widget definitions:\n%v\n", err)
+		os.Exit(2)
+	}
+	log.Printf("Loaded %d widget(s) from %s", len(defs), settings.Widgets.Dir)
+	for _, def := range defs {
+		if widgets.IsUnknown(def.Kind) {
+			fmt.Fprintf(os.Stderr, "warning: %s: unknown widget type %q, known types: %v\n", def.Path, def.Type, widgets.Types())
+		}
+	}
+
+	// Open the layout store and bring the widget.toml definitions into it
+	store, err := openStore(settings.Storage.Path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "opening storage: %v\n", err)
+		os.Exit(1)
+	}
+	defer store.Close()
+
+	shadowed, err := storage.Sync(context.Background(), store, storage.DefaultDashboard, "Dashboard", defs)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "syncing widgets into storage: %v\n", err)
+		store.Close()
+		os.Exit(1)
 	}
+	for _, def := range shadowed {
+		fmt.Fprintf(os.Stderr, "warning: %s: widget %q was created at runtime on the dashboard too, the widget.toml is ignored\n", def.Path, def.Widget.ID)
+	}
+
+	// Bring the configured accounts into storage
+	if err := syncAccounts(store, settings.Auth); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		store.Close()
+		os.Exit(1)
+	}
+
+	// Host metrics for the system status card, sampled while the server runs
+	metrics := system.NewCollector(system.Config{
+		Interval: settings.System.Interval,
+		Mounts:   settings.System.Mounts,
+		Warning:  system.Thresholds(settings.System.Warning),
+		Critical: system.Thresholds(settings.System.Critical),
+	})
+
+	// Run the server until it's stopped, exiting with 1 if that didn't go cleanly
+	if err := runServer(app.Config, store, metrics, checks); err != nil {
+		log.Printf("Server: %v", err)
+		store.Close()
+		os.Exit(1)
+	}
+}
+
+// syncAccounts creates or updates the accounts from [[auth.accounts]], and
+// makes sure someone can sign in if authentication is enabled
+func syncAccounts(store storage.Store, cfg config.Auth) error {
+	for _, account := range cfg.Accounts {
+		if !auth.IsHash(account.Password) {
+			fmt.Fprintf(os.Stderr, "warning: account %q has a plaintext password in the config, replace it with the output of `wasmdash hash-password`\n", account.ID)
+		}
+	}
+	if err := storage.SyncAccounts(context.Background(), store, cfg.Accounts); err != nil {
+		return fmt.Errorf("syncing accounts into storage: %w", err)
+	}
+
+	if !cfg.Enabled {
+		return nil
+	}
+	accounts, err := store.Accounts(context.Background())
+	if err != nil {
+		return fmt.Errorf("listing accounts: %w", err)
+	}
+	if len(accounts) == 0 {
+		return errors.New("authentication is enabled but there are no accounts, add one under [[auth.accounts]]")
+	}
+	log.Printf("Authentication enabled, %d account(s)", len(accounts))
+	return nil
 }
 
-func runServer(config *WConfig) error {
+// hashPassword implements `wasmdash hash-password`: it reads a password
+// from stdin and prints its hash for [[auth.accounts]] password
+func hashPassword() error {
+	password, err := readLine("Password (echoed): ")
+	if err != nil {
+		return err
+	}
+
+	hash, err := auth.HashPassword(password)
+	if err != nil {
+		return err
+	}
+	fmt.Println(hash)
+	return nil
+}
+
+// readLine reads a line from stdin, prompting for it on a terminal
+func readLine(prompt string) (string, error) {
+	if term, err := os.Stdin.Stat(); err == nil && term.Mode()&os.ModeCharDevice != 0 {
+		fmt.Fprint(os.Stderr, prompt)
+	}
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+	line = strings.TrimRight(line, "\r\n")
+	if line == "" {
+		return "", errors.New("empty input")
+	}
+	return line, nil
+}
+
+// openStore opens the SQLite database at path, or an in-memory store if path is empty
+func openStore(path string) (storage.Store, error) {
+	if path == "" {
+		log.Println("No storage path configured, dashboard layouts are kept in memory")
+		return storage.NewMemory(), nil
+	}
+	return sqlite.Open(context.Background(), path)
+}
+
+func runServer(config *WConfig, store storage.Store, metrics *system.Collector, checks *health.Registry) error {
+	// Signed API tokens, the key was checked with the config
+	var signer *auth.Signer
+	if key := config.Settings.API.SigningKey; key != "" {
+		var err error
+		if signer, err = auth.ParseSigningKey(key); err != nil {
+			return fmt.Errorf("api.signing_key: %w", err)
+		}
+	}
+
+	// Content-Security-Policy, the directives were checked with the config
+	var routes []csp.Route
+	for _, route := range config.Settings.CSP.Routes {
+		routes = append(routes, csp.Route{Path: route.Path, Directives: route.Directives})
+	}
+	policy, err := csp.New(csp.Config{
+		Directives: config.Settings.CSP.Directives,
+		Routes:     routes,
+		ReportOnly: config.Settings.CSP.ReportOnly,
+		Production: config.Settings.IsProduction(),
+	})
+	if err != nil {
+		return err
+	}
+
+	// The static files embedded in the binary, so it runs from anywhere
+	assets, err := fs.Sub(static, "static")
+	if err != nil {
+		return err
+	}
+
+	version, built := buildInfo()
+
 	// Create server configuration
 	serverConfig := &server.Config{
-		Port:        config.Port,
-		Host:        config.Host,
-		Environment: config.Env,
-		ServerName:  "wasmdash",
+		Port:                  config.Port,
+		Host:                  config.Host,
+		Environment:           config.Env,
+		ServerName:            config.Name,
+		HSTSIncludeSubdomains: config.Settings.Server.HSTSIncludeSubdomains,
+		SlowRequest:           config.Settings.Server.SlowRequest,
+		Version:               version,
+		BuildTime:             built,
+		Health:                checks,
+		Static:                assets,
+		CSP:                   policy,
+		Store:                 store,
+		Metrics:               metrics,
+		APIEnabled:            config.Settings.API.Enabled,
+		APIToken:              config.Settings.API.Token,
+		TokenSigner:           signer,
+		MetricsEnabled:        config.Settings.Metrics.Enabled,
+		MetricsToken:          config.Settings.Metrics.Token,
+		AuthEnabled:           config.Settings.Auth.Enabled,
+		SessionTTL:            config.Settings.Auth.SessionTTL,
 	}
 
 	// Create new server instance
-	srv := server.New(serverConfig)
+	srv, err := server.New(serverConfig)
+	if err != nil {
+		return err
+	}
 
 	// Setup middleware and routes
 	srv.SetupMiddleware()
 	srv.SetupRoutes()
 
-	// Setup graceful shutdown
-	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	// Sample host metrics in the background until shutdown
+	jobs, stopJobs := context.WithCancel(context.Background())
+	defer stopJobs()
+	sampling := make(chan struct{})
+	go func() {
+		defer close(sampling)
+		metrics.Run(jobs)
+	}()
 
 	// Start the server in a goroutine
+	failed := make(chan error, 1)
 	go func() {
 		log.Printf("Server listening on %s:%s (environment: %s)", config.Host, config.Port, config.Env)
-		if err := srv.Start(); err != nil {
-			log.Printf("Server error: %v", err)
+		if err := srv.Start(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			failed <- err
 		}
 	}()
 
-	// Wait for interrupt signal
-	<-quit
-	log.Println("Shutting down server...")
+	// Wait for SIGINT or SIGTERM, unless the server fails first
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	timeout := config.Settings.Server.ShutdownTimeout
+	select {
+	case err := <-failed:
+		return err
+	case sig := <-quit:
+		log.Printf("Received %s, finishing requests in flight for up to %s", sig, timeout)
+		fmt.Fprintf(os.Stderr, "\nShutting down, press Ctrl-C again to stop at once\n")
+	}
+
+	// A second signal doesn't wait for anything
+	go func() {
+		sig := <-quit
+		log.Printf("Received %s again, stopping at once", sig)
+		os.Exit(1)
+	}()
 
-	if err := srv.Shutdown(); err != nil {
-		return fmt.Errorf("server forced to shutdown: %w", err)
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	stopJobs()
+	if err := srv.Shutdown(ctx); err != nil {
+		return fmt.Errorf("requests still in flight after %s were cut off: %w", timeout, err)
+	}
+	select {
+	case <-sampling:
+	case <-ctx.Done():
+		return fmt.Errorf("metrics collection didn't stop within %s", timeout)
 	}
 
 	log.Println("Server exited")
 	return nil
 }
 
+// buildInfo returns the version and build time set by `make build`, or else
+// the commit go build recorded
+func buildInfo() (version, built string) {
+	version, built = commit, buildTime
+	if version != "" {
+		return version, built
+	}
+
+	version = "dev"
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return version, built
+	}
+	var dirty bool
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			version = setting.Value[:min(12, len(setting.Value))]
+		case "vcs.time":
+			built = setting.Value
+		case "vcs.modified":
+			dirty = setting.Value == "true"
+		}
+	}
+	if dirty && version != "dev" {
+		version += "-dirty"
+	}
+	return version, built
+}
+
 func showHelp() {
 	helpMsg := `WasmDash - A modern dashboard built with Go and WASM
 
 Usage:
     wasmdash [flags]
+    wasmdash hash-password    Hash a password read from stdin for [[auth.accounts]]
+    wasmdash token COMMAND    Issue, list and revoke API tokens (wasmdash token help)
+    wasmdash secret COMMAND   Manage secrets for widget settings (wasmdash secret help)
 
 Flags:
+    --config FILE    Path to wasmdash.toml (default: $WASMDASH_CONFIG)
     --port PORT      Port to serve on (default: 8080)
     --host HOST      Host to bind to (default: localhost)
     --env ENV        Environment: development, production (default: development)
     --help           Show this help message
 
+Configuration is resolved as defaults -> config file -> WASMDASH_* environment
+variables -> flags, e.g. WASMDASH_PORT=3000 overrides [server] port.
+
 Examples:
     wasmdash
     wasmdash --port 3000
     wasmdash --host 192.168.1.193 --port 8081
     wasmdash --env production --port 80
+    wasmdash --config wasmdash.toml
     wasmdash --help`
 
 	fmt.Println(helpMsg)
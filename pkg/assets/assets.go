@@ -0,0 +1,149 @@
+package assets
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/fs"
+	"path"
+	"strings"
+	"sync"
+)
+
+/*
+ * Package for fingerprinting the static files served at /static
+ *
+ * A Manifest hashes every file once on startup and maps its path to one with
+ * the hash before the extension, like css/styles.css to
+ * css/styles.3f9a1c2b.css. Pages link to the hashed paths with URL, which can
+ * be cached forever: a changed file gets a new path on the next start.
+ *
+ * Files are served compressed with brotli or gzip when the client accepts
+ * it, see serve.go. Scripts and stylesheets have a SHA-384 digest for their
+ * integrity attribute, see integrity.go.
+ */
+
+// Prefix is where the static files are served
+const Prefix = "/static/"
+
+// hashLength is the number of hex digits of the SHA-256 in hashed paths
+const hashLength = 8
+
+// Manifest maps the paths of static files to their hashed paths. It's an
+// fs.FS serving the files under both.
+type Manifest struct {
+	fsys  fs.FS
+	live  bool              // Files may change, nothing is hashed
+	files map[string]*file  // By path
+	paths map[string]string // Hashed path to path
+}
+
+// file is a hashed static file
+type file struct {
+	hashed    string // Hashed path
+	etag      string // Full SHA-256, hex
+	integrity string // SHA-384 of scripts and stylesheets, see Integrity
+
+	once     sync.Once
+	variants map[string][]byte // Compressed by content coding, see load
+}
+
+// New hashes every file in fsys. Files with a .br or .gz extension next to
+// the file they compress, like css/styles.css.br, are variants of it rather
+// than files of their own.
+func New(fsys fs.FS) (*Manifest, error) {
+	var names []string
+	err := fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			names = append(names, name)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	m := &Manifest{fsys: fsys, files: make(map[string]*file), paths: make(map[string]string)}
+	for _, name := range names {
+		if isVariant(name, names) {
+			continue
+		}
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return nil, err
+		}
+		digest := sha256.Sum256(data)
+		sum := hex.EncodeToString(digest[:])
+		f := &file{hashed: hashedPath(name, sum[:hashLength]), etag: sum}
+		if isSubresource(name) {
+			f.integrity = integrity(data)
+		}
+		m.files[name], m.paths[f.hashed] = f, name
+	}
+	return m, nil
+}
+
+// Live serves fsys without hashed paths, for files edited while the server
+// runs
+func Live(fsys fs.FS) *Manifest {
+	return &Manifest{fsys: fsys, live: true}
+}
+
+// hashedPath inserts hash before the extension of name
+func hashedPath(name, hash string) string {
+	ext := path.Ext(name)
+	return strings.TrimSuffix(name, ext) + "." + hash + ext
+}
+
+// Len returns the number of hashed files
+func (m *Manifest) Len() int {
+	return len(m.files)
+}
+
+// URL returns the URL of the static file at name, hashed if it can be
+func (m *Manifest) URL(name string) string {
+	if f, ok := m.files[name]; ok {
+		return Prefix + f.hashed
+	}
+	return Prefix + name
+}
+
+// Hashed reports whether name is a hashed path, which never changes content
+func (m *Manifest) Hashed(name string) bool {
+	_, ok := m.paths[name]
+	return ok
+}
+
+// Open opens a file by its path or its hashed path
+func (m *Manifest) Open(name string) (fs.File, error) {
+	if original, ok := m.paths[name]; ok {
+		name = original
+	}
+	return m.fsys.Open(name)
+}
+
+var (
+	defaultMu       sync.RWMutex
+	defaultManifest *Manifest
+)
+
+// SetDefault makes m the manifest URL reads from
+func SetDefault(m *Manifest) {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	defaultManifest = m
+}
+
+// URL returns the URL of the static file at name from the default manifest,
+// or its plain URL without one. Used by templates:
+//
+//	<link rel="stylesheet" href={ assets.URL("css/styles.css") }/>
+func URL(name string) string {
+	defaultMu.RLock()
+	m := defaultManifest
+	defaultMu.RUnlock()
+
+	if m == nil {
+		return Prefix + name
+	}
+	return m.URL(name)
+}
@@ -0,0 +1,117 @@
+package assets
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"testing"
+	"testing/fstest"
+)
+
+// hash returns the hash of data in hashed paths
+func hash(data string) string {
+	sum := sha256.Sum256([]byte(data))
+	return hex.EncodeToString(sum[:])[:hashLength]
+}
+
+func TestManifest(t *testing.T) {
+	static := fstest.MapFS{
+		"css/styles.css":             {Data: []byte("body { margin: 0; }\n")},
+		"css/styles.css.br":          {Data: []byte("brotli")},
+		"css/styles.css.gz":          {Data: []byte("gzip")},
+		"js/vendor/alpine@3.14.9.js": {Data: []byte("window.Alpine = {};\n")},
+		"LICENSE":                    {Data: []byte("MIT\n")},
+		"archive.tar.gz":             {Data: []byte("no archive.tar next to it")},
+	}
+	m, err := New(static)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Len() != 4 {
+		t.Errorf("Len = %d, want 4 without the variants of styles.css", m.Len())
+	}
+
+	tests := []struct {
+		name   string
+		hashed string
+	}{
+		{"css/styles.css", "css/styles." + hash("body { margin: 0; }\n") + ".css"},
+		{"js/vendor/alpine@3.14.9.js", "js/vendor/alpine@3.14.9." + hash("window.Alpine = {};\n") + ".js"},
+		{"LICENSE", "LICENSE." + hash("MIT\n")},
+		{"archive.tar.gz", "archive.tar." + hash("no archive.tar next to it") + ".gz"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := m.URL(tt.name); got != Prefix+tt.hashed {
+				t.Errorf("URL = %s, want %s", got, Prefix+tt.hashed)
+			}
+			if !m.Hashed(tt.hashed) || m.Hashed(tt.name) {
+				t.Errorf("Hashed(%s) = %t, Hashed(%s) = %t", tt.hashed, m.Hashed(tt.hashed), tt.name, m.Hashed(tt.name))
+			}
+
+			// Both paths open the same file
+			for _, name := range []string{tt.name, tt.hashed} {
+				f, err := m.Open(name)
+				if err != nil {
+					t.Fatalf("Open(%s): %v", name, err)
+				}
+				data, err := io.ReadAll(f)
+				f.Close()
+				if err != nil || string(data) != string(static[tt.name].Data) {
+					t.Errorf("Open(%s) read %q, %v", name, data, err)
+				}
+			}
+		})
+	}
+
+	// Variants and missing files keep their path
+	for _, name := range []string{"css/styles.css.br", "css/missing.css"} {
+		if got := m.URL(name); got != Prefix+name {
+			t.Errorf("URL(%s) = %s, want it unhashed", name, got)
+		}
+	}
+	for _, name := range []string{"css/styles.00000000.css", "css/styles." + hash("other") + ".css", "css/styles.css.br"} {
+		if m.Hashed(name) {
+			t.Errorf("Hashed(%s) = true", name)
+		}
+	}
+
+	// A changed file gets a new path on the next start
+	static["css/styles.css"] = &fstest.MapFile{Data: []byte("body { margin: 1em; }\n")}
+	changed, err := New(static)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changed.URL("css/styles.css") == m.URL("css/styles.css") {
+		t.Error("changed file kept its hashed path")
+	}
+	if changed.Hashed(tests[0].hashed) || changed.URL("LICENSE") != m.URL("LICENSE") {
+		t.Error("only the changed file gets a new path")
+	}
+}
+
+func TestManifestLive(t *testing.T) {
+	static := fstest.MapFS{"css/styles.css": {Data: []byte("body { margin: 0; }\n")}}
+	m := Live(static)
+	hashed := "css/styles." + hash("body { margin: 0; }\n") + ".css"
+	if m.Len() != 0 || m.URL("css/styles.css") != Prefix+"css/styles.css" || m.Hashed(hashed) {
+		t.Errorf("live manifest hashes paths: Len %d, URL %s", m.Len(), m.URL("css/styles.css"))
+	}
+}
+
+func TestDefaultURL(t *testing.T) {
+	t.Cleanup(func() { SetDefault(nil) })
+	m, err := New(fstest.MapFS{"css/styles.css": {Data: []byte("body { margin: 0; }\n")}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	SetDefault(nil)
+	if got := URL("css/styles.css"); got != Prefix+"css/styles.css" {
+		t.Errorf("without a manifest: URL = %s", got)
+	}
+	SetDefault(m)
+	if got := URL("css/styles.css"); got != m.URL("css/styles.css") || got == Prefix+"css/styles.css" {
+		t.Errorf("with a manifest: URL = %s", got)
+	}
+}
@@ -0,0 +1,111 @@
+package assets
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+)
+
+// Content codings, in Content-Encoding and Accept-Encoding
+const (
+	Brotli   = "br"
+	Gzip     = "gzip"
+	Identity = "identity"
+)
+
+// Level trades compression speed for size
+type Level int
+
+const (
+	// Fast is for responses compressed on every request
+	Fast Level = iota
+
+	// Best is for files compressed once
+	Best
+)
+
+// Negotiate picks the coding to send from offers, in order of preference,
+// by the quality values of an Accept-Encoding header. Ties go to the earlier
+// offer. Identity wins only when listed with a higher quality, and is
+// returned when nothing else is acceptable: the client gets the file
+// uncompressed rather than an error.
+func Negotiate(acceptEncoding string, offers ...string) string {
+	weights := make(map[string]float64)
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		coding, params, _ := strings.Cut(part, ";")
+		coding = strings.ToLower(strings.TrimSpace(coding))
+		if coding == "" {
+			continue
+		}
+		if coding == "x-gzip" {
+			coding = Gzip
+		}
+		q := 1.0
+		for _, param := range strings.Split(params, ";") {
+			key, value, _ := strings.Cut(param, "=")
+			if strings.EqualFold(strings.TrimSpace(key), "q") {
+				if v, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil {
+					q = v
+				}
+			}
+		}
+		weights[coding] = q
+	}
+
+	weight := func(coding string) float64 {
+		if q, ok := weights[coding]; ok {
+			return q
+		}
+		return weights["*"]
+	}
+
+	best, bestQ := Identity, 0.0
+	for _, offer := range offers {
+		if q := weight(offer); q > bestQ {
+			best, bestQ = offer, q
+		}
+	}
+	// Identity is only preferred when asked for, otherwise it's the fallback
+	if q, ok := weights[Identity]; ok && best != Identity && q > bestQ {
+		return Identity
+	}
+	return best
+}
+
+// Compress returns data compressed with the coding encoding
+func Compress(encoding string, data []byte, level Level) ([]byte, error) {
+	var b bytes.Buffer
+	var w io.WriteCloser
+	switch encoding {
+	case Brotli:
+		quality := 4
+		if level == Best {
+			quality = brotli.BestCompression
+		}
+		w = brotli.NewWriterLevel(&b, quality)
+	case Gzip:
+		gzipLevel := gzip.DefaultCompression
+		if level == Best {
+			gzipLevel = gzip.BestCompression
+		}
+		var err error
+		if w, err = gzip.NewWriterLevel(&b, gzipLevel); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("assets: unknown content coding %q", encoding)
+	}
+
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
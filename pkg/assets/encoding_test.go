@@ -0,0 +1,80 @@
+package assets
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+)
+
+func TestNegotiate(t *testing.T) {
+	both := []string{Brotli, Gzip}
+	tests := []struct {
+		name   string
+		accept string
+		offers []string
+		want   string
+	}{
+		{"no header", "", both, Identity},
+		{"both, tie to the first offer", "gzip, deflate, br", both, Brotli},
+		{"offers in other order", "br, gzip", []string{Gzip, Brotli}, Gzip},
+		{"only gzip", "gzip", both, Gzip},
+		{"gzip preferred", "br;q=0.5, gzip;q=0.8", both, Gzip},
+		{"br excluded", "br;q=0, gzip", both, Gzip},
+		{"all excluded", "br;q=0, gzip;q=0", both, Identity},
+		{"not offered", "br", []string{Gzip}, Identity},
+		{"nothing offered", "br, gzip", nil, Identity},
+		{"unknown coding", "deflate, zstd", both, Identity},
+		{"any", "*", both, Brotli},
+		{"any but br", "*, br;q=0", both, Gzip},
+		{"any excluded", "*;q=0", both, Identity},
+		{"named over any", "*;q=0.1, gzip;q=0.5", both, Gzip},
+		{"identity preferred", "identity, gzip;q=0.5", both, Identity},
+		{"identity tied", "identity, gzip", both, Gzip},
+		{"identity lower", "identity;q=0.5, gzip", both, Gzip},
+		{"identity excluded", "identity;q=0, gzip", both, Gzip},
+		// Nothing else is acceptable, the file goes out uncompressed anyway
+		{"identity excluded, nothing else", "identity;q=0", both, Identity},
+		{"everything excluded", "identity;q=0, *;q=0", both, Identity},
+		{"x-gzip", "x-gzip", both, Gzip},
+		{"case and spaces", " GZIP ; Q=0.9 ,BR;q=0.1", both, Gzip},
+		{"bad q is 1", "br;q=high, gzip;q=0.9", both, Brotli},
+		{"other params", "gzip;level=9;q=0.2, br;q=0.1", both, Gzip},
+		{"empty parts", ",, gzip,", both, Gzip},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Negotiate(tt.accept, tt.offers...); got != tt.want {
+				t.Errorf("Negotiate(%q, %q) = %q, want %q", tt.accept, tt.offers, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompress(t *testing.T) {
+	data := bytes.Repeat([]byte("body { margin: 0; }\n"), 100)
+	decode := map[string]func(io.Reader) (io.Reader, error){
+		Brotli: func(r io.Reader) (io.Reader, error) { return brotli.NewReader(r), nil },
+		Gzip:   func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) },
+	}
+	for encoding, reader := range decode {
+		for _, level := range []Level{Fast, Best} {
+			compressed, err := Compress(encoding, data, level)
+			if err != nil {
+				t.Fatalf("%s %d: %v", encoding, level, err)
+			}
+			r, err := reader(bytes.NewReader(compressed))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, err := io.ReadAll(r); err != nil || !bytes.Equal(got, data) {
+				t.Errorf("%s %d: didn't round trip: %v", encoding, level, err)
+			}
+		}
+	}
+	if _, err := Compress(Identity, data, Fast); err == nil {
+		t.Error("compressed with identity")
+	}
+}
@@ -0,0 +1,96 @@
+package assets
+
+import (
+	"crypto/sha512"
+	"encoding/base64"
+	"io/fs"
+	"path"
+	"slices"
+	"strings"
+)
+
+// subresourceExtensions are the extensions of the files pages load as
+// scripts or stylesheets, which get a Subresource Integrity digest
+var subresourceExtensions = []string{".js", ".mjs", ".css"}
+
+// Subresource is a script or stylesheet with its Subresource Integrity
+type Subresource struct {
+	URL       string `json:"url"`
+	Integrity string `json:"integrity"`
+}
+
+// isSubresource reports whether the file at name is a script or stylesheet
+func isSubresource(name string) bool {
+	return slices.Contains(subresourceExtensions, path.Ext(name))
+}
+
+// integrity returns the Subresource Integrity of data, like sha384-...
+func integrity(data []byte) string {
+	sum := sha512.Sum384(data)
+	return "sha384-" + base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// Integrity returns the Subresource Integrity of the script or stylesheet at
+// name, or "" for other files and files that don't exist. A Live manifest
+// reads the file again on each call, so the digest matches what's served.
+func (m *Manifest) Integrity(name string) string {
+	if !isSubresource(name) {
+		return ""
+	}
+	if !m.live {
+		if f, ok := m.files[name]; ok {
+			return f.integrity
+		}
+		return ""
+	}
+	data, err := fs.ReadFile(m.fsys, name)
+	if err != nil {
+		return ""
+	}
+	return integrity(data)
+}
+
+// Subresources returns the scripts and stylesheets in the directories dirs
+// and below them with their URLs and digests, sorted by URL, like for the
+// service worker to precache
+func (m *Manifest) Subresources(dirs ...string) []Subresource {
+	var names []string
+	if m.live {
+		for _, dir := range dirs {
+			fs.WalkDir(m.fsys, dir, func(name string, d fs.DirEntry, err error) error {
+				if err == nil && !d.IsDir() {
+					names = append(names, name)
+				}
+				return nil
+			})
+		}
+	} else {
+		for name := range m.files {
+			if slices.ContainsFunc(dirs, func(dir string) bool { return strings.HasPrefix(name, dir+"/") }) {
+				names = append(names, name)
+			}
+		}
+	}
+
+	var subresources []Subresource
+	for _, name := range names {
+		if sri := m.Integrity(name); sri != "" {
+			subresources = append(subresources, Subresource{URL: m.URL(name), Integrity: sri})
+		}
+	}
+	slices.SortFunc(subresources, func(a, b Subresource) int { return strings.Compare(a.URL, b.URL) })
+	return subresources
+}
+
+// Integrity returns the Subresource Integrity of the script or stylesheet at
+// name from the default manifest, or "" without one, see SRI in pkg/ui
+func Integrity(name string) string {
+	defaultMu.RLock()
+	m := defaultManifest
+	defaultMu.RUnlock()
+
+	if m == nil {
+		return ""
+	}
+	return m.Integrity(name)
+}
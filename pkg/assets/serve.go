@@ -0,0 +1,127 @@
+package assets
+
+import (
+	"bytes"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"path"
+	"slices"
+	"strings"
+	"time"
+)
+
+// compressible are the extensions of files worth compressing, others like
+// images and woff2 fonts already are
+var compressible = []string{".css", ".js", ".mjs", ".json", ".map", ".svg", ".html", ".txt", ".xml", ".wasm", ".ico", ".ttf", ".otf"}
+
+// variantExtensions maps the extensions of precompressed files to their coding
+var variantExtensions = map[string]string{".br": Brotli, ".gz": Gzip}
+
+// isVariant reports whether name is a precompressed variant of another file
+func isVariant(name string, names []string) bool {
+	ext := path.Ext(name)
+	_, ok := variantExtensions[ext]
+	return ok && slices.Contains(names, strings.TrimSuffix(name, ext))
+}
+
+// Serve writes the static file at name, its path or its hashed path, to w.
+// It's compressed by the Accept-Encoding of r, with a strong ETag for each
+// coding so conditional and range requests work on either. Files of a Live
+// manifest are served as they are on disk. Returns an fs.ErrNotExist error
+// for files that don't exist, with nothing written.
+func (m *Manifest) Serve(w http.ResponseWriter, r *http.Request, name string) error {
+	if original, ok := m.paths[name]; ok {
+		name = original
+	}
+	if !fs.ValidPath(name) {
+		return fs.ErrNotExist
+	}
+
+	if m.live {
+		// Read on every request so edits show
+		if info, err := fs.Stat(m.fsys, name); err != nil {
+			return err
+		} else if info.IsDir() {
+			return fs.ErrNotExist
+		}
+		http.ServeFileFS(w, r, m.fsys, name)
+		return nil
+	}
+	f, ok := m.files[name]
+	if !ok {
+		return fs.ErrNotExist
+	}
+
+	f.once.Do(func() { f.load(m.fsys, name) })
+	offers := make([]string, 0, len(f.variants))
+	for _, encoding := range []string{Brotli, Gzip} {
+		if _, ok := f.variants[encoding]; ok {
+			offers = append(offers, encoding)
+		}
+	}
+
+	header := w.Header()
+	header.Set("Vary", "Accept-Encoding")
+	encoding := Negotiate(r.Header.Get("Accept-Encoding"), offers...)
+	var content io.ReadSeeker
+	if encoding == Identity {
+		file, err := m.fsys.Open(name)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		if rs, ok := file.(io.ReadSeeker); ok {
+			content = rs
+		} else {
+			data, err := io.ReadAll(file)
+			if err != nil {
+				return err
+			}
+			content = bytes.NewReader(data)
+		}
+		header.Set("ETag", `"`+f.etag+`"`)
+	} else {
+		content = bytes.NewReader(f.variants[encoding])
+		header.Set("Content-Encoding", encoding)
+		header.Set("ETag", `"`+f.etag+"-"+encoding+`"`)
+	}
+
+	// The modification time of embedded files is unknown, the ETag stands in
+	http.ServeContent(w, r, name, time.Time{}, content)
+	return nil
+}
+
+// load finds the variants of the file at name: precompressed ones in fsys,
+// or else compressed once now. Variants that aren't smaller are dropped.
+func (f *file) load(fsys fs.FS, name string) {
+	f.variants = make(map[string][]byte)
+
+	data, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		log.Printf("Not compressing %s: %v", name, err)
+		return
+	}
+	for ext, encoding := range variantExtensions {
+		if variant, err := fs.ReadFile(fsys, name+ext); err == nil && len(variant) < len(data) {
+			f.variants[encoding] = variant
+		}
+	}
+	if !slices.Contains(compressible, path.Ext(name)) {
+		return
+	}
+	for _, encoding := range []string{Brotli, Gzip} {
+		if _, ok := f.variants[encoding]; ok {
+			continue
+		}
+		variant, err := Compress(encoding, data, Best)
+		if err != nil {
+			log.Printf("Not compressing %s with %s: %v", name, encoding, err)
+			continue
+		}
+		if len(variant) < len(data) {
+			f.variants[encoding] = variant
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package assets
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+)
+
+func TestServe(t *testing.T) {
+	css := bytes.Repeat([]byte("body { margin: 0; }\n"), 100)
+	js := bytes.Repeat([]byte("console.log('app');\n"), 100)
+	png := bytes.Repeat([]byte("\x89PNG"), 100)
+	precompressed := []byte("precompressed brotli")
+	static := fstest.MapFS{
+		"css/styles.css":    {Data: css},
+		"css/styles.css.br": {Data: precompressed},
+		"js/app.js":         {Data: js},
+		"icons/icon.png":    {Data: png},
+	}
+	m, err := New(static)
+	if err != nil {
+		t.Fatal(err)
+	}
+	etag := func(data []byte, encoding string) string {
+		sum := sha256.Sum256(data)
+		if encoding == Identity {
+			return `"` + hex.EncodeToString(sum[:]) + `"`
+		}
+		return `"` + hex.EncodeToString(sum[:]) + "-" + encoding + `"`
+	}
+	serve := func(name string, header http.Header) *httptest.ResponseRecorder {
+		t.Helper()
+		r := httptest.NewRequest(http.MethodGet, Prefix+name, nil)
+		r.Header = header
+		w := httptest.NewRecorder()
+		if err := m.Serve(w, r, name); err != nil {
+			t.Fatalf("Serve(%s): %v", name, err)
+		}
+		return w
+	}
+
+	tests := []struct {
+		name     string
+		file     string
+		accept   string
+		encoding string
+		etag     string
+		body     []byte // Compressed by encoding, nil to decode it
+	}{
+		{"precompressed", "css/styles.css", "br, gzip", Brotli, etag(css, Brotli), precompressed},
+		{"compressed on load", "css/styles.css", "gzip", Gzip, etag(css, Gzip), nil},
+		{"not accepted", "css/styles.css", "", Identity, etag(css, Identity), css},
+		{"identity excluded", "css/styles.css", "identity;q=0", Identity, etag(css, Identity), css},
+		{"by hashed path", m.URL("js/app.js")[len(Prefix):], "gzip;q=1, br;q=0", Gzip, etag(js, Gzip), nil},
+		{"not compressible", "icons/icon.png", "br, gzip", Identity, etag(png, Identity), png},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(tt.file, http.Header{"Accept-Encoding": {tt.accept}})
+			header := w.Header()
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d", w.Code)
+			}
+			if got := header.Get("Vary"); got != "Accept-Encoding" {
+				t.Errorf("Vary = %q", got)
+			}
+			encoding := header.Get("Content-Encoding")
+			if encoding == "" {
+				encoding = Identity
+			}
+			if encoding != tt.encoding || header.Get("ETag") != tt.etag {
+				t.Errorf("Content-Encoding %s, ETag %s, want %s, %s", encoding, header.Get("ETag"), tt.encoding, tt.etag)
+			}
+
+			body := w.Body.Bytes()
+			if tt.body == nil {
+				r, err := gzip.NewReader(w.Body)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if body, err = io.ReadAll(r); err != nil {
+					t.Fatal(err)
+				}
+				if tt.file == "css/styles.css" {
+					tt.body = css
+				} else {
+					tt.body = js
+				}
+			}
+			if !bytes.Equal(body, tt.body) {
+				t.Errorf("body of %d bytes, want %d", len(body), len(tt.body))
+			}
+		})
+	}
+
+	// Conditional requests match the ETag of the coding negotiated
+	w := serve("css/styles.css", http.Header{"Accept-Encoding": {"br"}, "If-None-Match": {etag(css, Brotli)}})
+	if w.Code != http.StatusNotModified {
+		t.Errorf("If-None-Match of the brotli variant: status = %d, want 304", w.Code)
+	}
+	w = serve("css/styles.css", http.Header{"Accept-Encoding": {"gzip"}, "If-None-Match": {etag(css, Brotli)}})
+	if w.Code != http.StatusOK {
+		t.Errorf("If-None-Match of the brotli variant, gzip accepted: status = %d, want 200", w.Code)
+	}
+
+	// Ranges are of the coded content
+	w = serve("css/styles.css", http.Header{"Accept-Encoding": {"br"}, "Range": {"bytes=0-3"}})
+	if w.Code != http.StatusPartialContent || w.Body.String() != string(precompressed[:4]) {
+		t.Errorf("range of the brotli variant: status %d, body %q", w.Code, w.Body)
+	}
+	w = serve("css/styles.css", http.Header{"Range": {"bytes=0-3"}})
+	if w.Code != http.StatusPartialContent || w.Body.String() != string(css[:4]) {
+		t.Errorf("range: status %d, body %q", w.Code, w.Body)
+	}
+
+	for _, name := range []string{"css/missing.css", "css", "../css/styles.css", "css/styles.00000000.css"} {
+		w := httptest.NewRecorder()
+		if err := m.Serve(w, httptest.NewRequest(http.MethodGet, Prefix+name, nil), name); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("Serve(%s): err = %v, want fs.ErrNotExist", name, err)
+		}
+		if w.Body.Len() != 0 || len(w.Header()) != 0 {
+			t.Errorf("Serve(%s) wrote a response", name)
+		}
+	}
+}
+
+func TestServeLive(t *testing.T) {
+	static := fstest.MapFS{"css/styles.css": {Data: bytes.Repeat([]byte("body { margin: 0; }\n"), 100)}}
+	m := Live(static)
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/static/css/styles.css", nil)
+	r.Header.Set("Accept-Encoding", "br, gzip")
+	if err := m.Serve(w, r, "css/styles.css"); err != nil {
+		t.Fatal(err)
+	}
+	if w.Header().Get("Content-Encoding") != "" || w.Body.Len() != len(static["css/styles.css"].Data) {
+		t.Errorf("live file compressed: Content-Encoding %q", w.Header().Get("Content-Encoding"))
+	}
+
+	// Edits show on the next request
+	static["css/styles.css"] = &fstest.MapFile{Data: []byte("body { margin: 1em; }\n")}
+	w = httptest.NewRecorder()
+	if err := m.Serve(w, r, "css/styles.css"); err != nil || w.Body.String() != "body { margin: 1em; }\n" {
+		t.Errorf("edited file: %v, body %q", err, w.Body)
+	}
+	if err := m.Serve(httptest.NewRecorder(), r, "css"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("directory: err = %v, want fs.ErrNotExist", err)
+	}
+}
@@ -0,0 +1,48 @@
+package auth
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+)
+
+/*
+ * Package for authentication and authorization
+ *
+ * Accounts sign in with a password, hashed with argon2id, and get a session
+ * kept in a cookie. Accounts are persisted by pkg/storage, sessions live in
+ * memory and end when the server restarts.
+ */
+
+// Guest will be the default role for simplifying the development
+// of the RBAC system
+const (
+	RoleGuest = 0
+	RoleUser  = 1
+	RoleAdmin = 1000
+)
+
+// We don't bother with email
+type Account struct {
+	ID       string    `json:"id,omitempty,nonempty" toml:"id"`
+	UUID     string    `json:"uuid,omitempty" toml:"uuid"`
+	Password string    `json:"-" toml:"password"` // argon2id hash, see HashPassword
+	Creation time.Time `json:"creation,omitempty" toml:"creation"`
+	Role     int       `json:"role,omitempty" xml:"role,omitempty" toml:"role"`
+}
+
+// idPattern matches valid account IDs, which are used as usernames
+var idPattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._-]{0,63}$`)
+
+// ValidID reports why id can't be used for an account, or nil
+func ValidID(id string) error {
+	if !idPattern.MatchString(id) {
+		return fmt.Errorf("%q must be 1-64 letters, digits, '.', '_' or '-', starting with a letter or digit", id)
+	}
+	return nil
+}
+
+// ValidRole reports whether role is one of the defined roles
+func ValidRole(role int) bool {
+	return role == RoleGuest || role == RoleUser || role == RoleAdmin
+}
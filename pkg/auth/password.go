@@ -0,0 +1,146 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"runtime"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/argon2"
+)
+
+/*
+ * Passwords are hashed with argon2id and stored in the PHC string format,
+ * which carries the parameters along with the salt and hash:
+ *
+ *   $argon2id$v=19$m=65536,t=3,p=4$<salt>$<hash>
+ *
+ * Raising the parameters doesn't invalidate stored hashes, NeedsRehash
+ * tells when to replace one after a successful login.
+ */
+
+// Params are the argon2id cost parameters
+type Params struct {
+	Memory  uint32 // KiB
+	Time    uint32
+	Threads uint8
+	SaltLen uint32
+	KeyLen  uint32
+}
+
+// DefaultParams follow the second recommended option of RFC 9106
+var DefaultParams = Params{Memory: 64 * 1024, Time: 3, Threads: 4, SaltLen: 16, KeyLen: 32}
+
+// ErrInvalidHash is returned for stored hashes that can't be parsed, or
+// whose parameters are out of maxParams
+var ErrInvalidHash = errors.New("auth: invalid password hash")
+
+// maxParams bound the parameters of a stored hash, which come from the
+// config file or the database, so one can't make a login take gigabytes
+var maxParams = Params{Memory: 4 * DefaultParams.Memory, Time: 4 * DefaultParams.Time, Threads: 16, SaltLen: 64, KeyLen: 64}
+
+// minSaltLen and minKeyLen are the least RFC 9106 allows
+const minSaltLen, minKeyLen = 8, 16
+
+// hashing bounds the number of concurrent hashes, each of which
+// takes Params.Memory, so a burst of logins can't exhaust memory
+var hashing = make(chan struct{}, max(runtime.NumCPU()/2, 1))
+
+// HashPassword hashes password with DefaultParams
+func HashPassword(password string) (string, error) {
+	p := DefaultParams
+	salt := make([]byte, p.SaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := derive(password, salt, p)
+
+	b64 := base64.RawStdEncoding
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, p.Memory, p.Time, p.Threads, b64.EncodeToString(salt), b64.EncodeToString(key)), nil
+}
+
+// VerifyPassword reports whether password matches hash, in constant time
+func VerifyPassword(hash, password string) (bool, error) {
+	p, salt, key, err := decodeHash(hash)
+	if err != nil {
+		return false, err
+	}
+	p.KeyLen = uint32(len(key))
+	return subtle.ConstantTimeCompare(derive(password, salt, p), key) == 1, nil
+}
+
+// NeedsRehash reports whether hash was made with other parameters than
+// DefaultParams, and should be replaced once the password is known
+func NeedsRehash(hash string) bool {
+	p, salt, key, err := decodeHash(hash)
+	if err != nil {
+		return true
+	}
+	d := DefaultParams
+	return p.Memory != d.Memory || p.Time != d.Time || p.Threads != d.Threads ||
+		uint32(len(salt)) != d.SaltLen || uint32(len(key)) != d.KeyLen
+}
+
+// IsHash reports whether s looks like a hash made by HashPassword,
+// as opposed to a plaintext password
+func IsHash(s string) bool {
+	return strings.HasPrefix(s, "$argon2id$")
+}
+
+// CheckHash returns ErrInvalidHash if hash can't be verified against
+func CheckHash(hash string) error {
+	_, _, _, err := decodeHash(hash)
+	return err
+}
+
+// dummyHash is verified against when an account doesn't exist,
+// so failed logins take the same time whether it does or not
+var dummyHash = sync.OnceValue(func() string {
+	hash, _ := HashPassword("wasmdash")
+	return hash
+})
+
+// VerifyNothing takes as long as VerifyPassword, for unknown accounts
+func VerifyNothing(password string) {
+	VerifyPassword(dummyHash(), password)
+}
+
+func derive(password string, salt []byte, p Params) []byte {
+	hashing <- struct{}{}
+	defer func() { <-hashing }()
+	return argon2.IDKey([]byte(password), salt, p.Time, p.Memory, p.Threads, p.KeyLen)
+}
+
+func decodeHash(hash string) (p Params, salt, key []byte, err error) {
+	// "", "argon2id", "v=19", "m=...,t=...,p=...", salt, key
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return p, nil, nil, ErrInvalidHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return p, nil, nil, ErrInvalidHash
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.Memory, &p.Time, &p.Threads); err != nil {
+		return p, nil, nil, ErrInvalidHash
+	}
+	if p.Memory == 0 || p.Time == 0 || p.Threads == 0 ||
+		p.Memory > maxParams.Memory || p.Time > maxParams.Time || p.Threads > maxParams.Threads {
+		return p, nil, nil, ErrInvalidHash
+	}
+
+	b64 := base64.RawStdEncoding
+	if salt, err = b64.DecodeString(parts[4]); err != nil || len(salt) < minSaltLen || len(salt) > int(maxParams.SaltLen) {
+		return p, nil, nil, ErrInvalidHash
+	}
+	if key, err = b64.DecodeString(parts[5]); err != nil || len(key) < minKeyLen || len(key) > int(maxParams.KeyLen) {
+		return p, nil, nil, ErrInvalidHash
+	}
+	return p, salt, key, nil
+}
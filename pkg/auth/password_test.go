@@ -0,0 +1,93 @@
+package auth
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestPassword(t *testing.T) {
+	hash, err := HashPassword("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(hash, "$argon2id$v=19$m=65536,t=3,p=4$") || !IsHash(hash) {
+		t.Fatalf("hash = %s, want argon2id with DefaultParams", hash)
+	}
+	if other, _ := HashPassword("correct horse"); other == hash {
+		t.Error("two hashes of a password are the same, the salt isn't random")
+	}
+
+	if ok, err := VerifyPassword(hash, "correct horse"); !ok || err != nil {
+		t.Errorf("right password: %t, %v", ok, err)
+	}
+	for _, wrong := range []string{"", "correct hors", "correct horse ", "Correct horse"} {
+		if ok, err := VerifyPassword(hash, wrong); ok || err != nil {
+			t.Errorf("password %q: %t, %v, want false", wrong, ok, err)
+		}
+	}
+	if NeedsRehash(hash) {
+		t.Error("hash with DefaultParams needs a rehash")
+	}
+}
+
+func TestPasswordInvalidHash(t *testing.T) {
+	const (
+		salt = "c2FsdHNhbHRzYWx0c2FsdA"                      // 16 bytes
+		key  = "a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2U" // 32 bytes
+	)
+	tests := []struct {
+		name string
+		hash string
+	}{
+		{"empty", ""},
+		{"plaintext", "hunter2"},
+		{"argon2i", "$argon2i$v=19$m=65536,t=3,p=4$" + salt + "$" + key},
+		{"bcrypt", "$2a$10$N9qo8uLOickgx2ZMRZoMyeIjZAgcfl7p92ldGxad68LJZdL17lhWy"},
+		{"old version", "$argon2id$v=16$m=65536,t=3,p=4$" + salt + "$" + key},
+		{"missing part", "$argon2id$v=19$m=65536,t=3,p=4$" + salt},
+		{"extra part", "$argon2id$v=19$m=65536,t=3,p=4$" + salt + "$" + key + "$"},
+		{"no params", "$argon2id$v=19$$" + salt + "$" + key},
+		{"zero memory", "$argon2id$v=19$m=0,t=3,p=4$" + salt + "$" + key},
+		{"zero time", "$argon2id$v=19$m=65536,t=0,p=4$" + salt + "$" + key},
+		{"zero threads", "$argon2id$v=19$m=65536,t=3,p=0$" + salt + "$" + key},
+		{"4 GiB", "$argon2id$v=19$m=4194304,t=3,p=4$" + salt + "$" + key},
+		{"too many passes", "$argon2id$v=19$m=65536,t=1000,p=4$" + salt + "$" + key},
+		{"too many threads", "$argon2id$v=19$m=65536,t=3,p=255$" + salt + "$" + key},
+		{"short salt", "$argon2id$v=19$m=65536,t=3,p=4$c2FsdA$" + key},
+		{"salt not base64", "$argon2id$v=19$m=65536,t=3,p=4$s@lt$" + key},
+		{"no key", "$argon2id$v=19$m=65536,t=3,p=4$" + salt + "$"},
+		{"short key", "$argon2id$v=19$m=65536,t=3,p=4$" + salt + "$a2V5"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := CheckHash(tt.hash); !errors.Is(err, ErrInvalidHash) {
+				t.Errorf("CheckHash = %v, want ErrInvalidHash", err)
+			}
+			if ok, err := VerifyPassword(tt.hash, "hunter2"); ok || !errors.Is(err, ErrInvalidHash) {
+				t.Errorf("VerifyPassword = %t, %v, want ErrInvalidHash", ok, err)
+			}
+			if !NeedsRehash(tt.hash) {
+				t.Error("invalid hash doesn't need a rehash")
+			}
+		})
+	}
+}
+
+func TestPasswordOtherParams(t *testing.T) {
+	// Hashes made with other parameters still verify, and ask for a rehash
+	p := Params{Memory: 8 * 1024, Time: 1, Threads: 1, SaltLen: 16, KeyLen: 32}
+	salt := []byte("0123456789abcdef")
+	hash := "$argon2id$v=19$m=8192,t=1,p=1$MDEyMzQ1Njc4OWFiY2RlZg$" + base64.RawStdEncoding.EncodeToString(derive("correct horse", salt, p))
+
+	if ok, err := VerifyPassword(hash, "correct horse"); !ok || err != nil {
+		t.Errorf("verify: %t, %v", ok, err)
+	}
+	if ok, _ := VerifyPassword(hash, "wrong horse"); ok {
+		t.Error("wrong password verified")
+	}
+	if !NeedsRehash(hash) {
+		t.Error("hash with other parameters doesn't need a rehash")
+	}
+}
@@ -0,0 +1,115 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"sync"
+	"time"
+)
+
+// Session is a signed in account
+type Session struct {
+	AccountID string
+	Created   time.Time
+	Expires   time.Time
+}
+
+// Sessions keeps the sessions of signed in accounts in memory. Only a hash
+// of each token is kept, the token itself only exists in the cookie.
+type Sessions struct {
+	ttl time.Duration
+
+	mu       sync.Mutex
+	sessions map[[sha256.Size]byte]Session
+}
+
+// NewSessions returns an empty session store whose sessions last ttl
+func NewSessions(ttl time.Duration) *Sessions {
+	return &Sessions{
+		ttl:      ttl,
+		sessions: make(map[[sha256.Size]byte]Session),
+	}
+}
+
+// TTL returns how long sessions last
+func (s *Sessions) TTL() time.Duration {
+	return s.ttl
+}
+
+// Create starts a session for an account and returns its token
+func (s *Sessions) Create(accountID string) (string, Session, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", Session{}, err
+	}
+	token := base64.RawURLEncoding.EncodeToString(raw)
+
+	now := time.Now()
+	session := Session{AccountID: accountID, Created: now, Expires: now.Add(s.ttl)}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.expire(now)
+	s.sessions[sha256.Sum256([]byte(token))] = session
+	return token, session, nil
+}
+
+// Get returns the session of token, if it exists and hasn't expired
+func (s *Sessions) Get(token string) (Session, bool) {
+	key := sha256.Sum256([]byte(token))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, ok := s.sessions[key]
+	if !ok {
+		return Session{}, false
+	}
+	if !time.Now().Before(session.Expires) {
+		delete(s.sessions, key)
+		return Session{}, false
+	}
+	return session, true
+}
+
+// Delete ends the session of token
+func (s *Sessions) Delete(token string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.sessions, sha256.Sum256([]byte(token)))
+}
+
+// DeleteAccount ends every session of an account
+func (s *Sessions) DeleteAccount(accountID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key, session := range s.sessions {
+		if session.AccountID == accountID {
+			delete(s.sessions, key)
+		}
+	}
+}
+
+// Active returns the number of accounts with a session
+func (s *Sessions) Active() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.expire(time.Now())
+	accounts := make(map[string]struct{}, len(s.sessions))
+	for _, session := range s.sessions {
+		accounts[session.AccountID] = struct{}{}
+	}
+	return len(accounts)
+}
+
+// expire drops sessions that expired before now, s.mu must be held
+func (s *Sessions) expire(now time.Time) {
+	for key, session := range s.sessions {
+		if !now.Before(session.Expires) {
+			delete(s.sessions, key)
+		}
+	}
+}
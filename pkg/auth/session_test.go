@@ -0,0 +1,97 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"testing"
+	"time"
+)
+
+func TestSessions(t *testing.T) {
+	s := NewSessions(time.Hour)
+	token, created, err := s.Create("bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created.AccountID != "bob" || created.Expires.Sub(created.Created) != time.Hour {
+		t.Errorf("session = %+v, want bob's for an hour", created)
+	}
+	if other, _, _ := s.Create("bob"); other == token {
+		t.Error("two sessions got the same token")
+	}
+
+	if session, ok := s.Get(token); !ok || session != created {
+		t.Errorf("Get = %+v, %t, want the created session", session, ok)
+	}
+
+	// Only the hash of the token is kept, the token doesn't find a session
+	// through anything else
+	key := sha256.Sum256([]byte(token))
+	if _, ok := s.sessions[key]; !ok {
+		t.Error("session not kept under the hash of its token")
+	}
+	for stored := range s.sessions {
+		if string(stored[:]) == token {
+			t.Error("token stored in the clear")
+		}
+	}
+	for _, wrong := range []string{"", token[:len(token)-1], token + "A", string(key[:])} {
+		if _, ok := s.Get(wrong); ok {
+			t.Errorf("Get(%q) found a session", wrong)
+		}
+	}
+}
+
+func TestSessionsExpire(t *testing.T) {
+	s := NewSessions(time.Hour)
+	expired, _, _ := s.Create("bob")
+	live, _, _ := s.Create("alice")
+	if got := s.Active(); got != 2 {
+		t.Fatalf("Active = %d, want 2", got)
+	}
+
+	key := sha256.Sum256([]byte(expired))
+	session := s.sessions[key]
+	session.Expires = time.Now()
+	s.sessions[key] = session
+
+	if _, ok := s.Get(expired); ok {
+		t.Error("expired session found")
+	}
+	if _, ok := s.sessions[key]; ok {
+		t.Error("expired session kept after Get")
+	}
+	if _, ok := s.Get(live); !ok {
+		t.Error("live session gone")
+	}
+	if got := s.Active(); got != 1 {
+		t.Errorf("Active = %d, want 1", got)
+	}
+}
+
+func TestSessionsRevoke(t *testing.T) {
+	s := NewSessions(time.Hour)
+	first, _, _ := s.Create("bob")
+	second, _, _ := s.Create("bob")
+	other, _, _ := s.Create("alice")
+
+	// Signing out ends that session only
+	s.Delete(first)
+	if _, ok := s.Get(first); ok {
+		t.Error("session found after Delete")
+	}
+	if _, ok := s.Get(second); !ok {
+		t.Error("bob's other session ended too")
+	}
+
+	// Deleting an account, or changing its password, ends all of its sessions
+	s.DeleteAccount("bob")
+	if _, ok := s.Get(second); ok {
+		t.Error("session found after DeleteAccount")
+	}
+	if _, ok := s.Get(other); !ok {
+		t.Error("alice's session ended with bob's")
+	}
+	if got := s.Active(); got != 1 {
+		t.Errorf("Active = %d, want 1", got)
+	}
+}
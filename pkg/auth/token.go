@@ -0,0 +1,281 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+/*
+ * Signed API tokens
+ *
+ * API clients authenticate with a JWT (RFC 7519) acting for an account,
+ * limited to the role its scopes grant. Tokens are signed with HS256 or
+ * EdDSA (Ed25519) by the key in [api] signing_key. Only the JWS compact
+ * form with exactly the configured algorithm is accepted, anything else,
+ * including "none", is invalid.
+ *
+ * Every issued token is also recorded in storage, which is where they're
+ * listed and revoked, see storage.IssueToken and storage.CheckToken.
+ */
+
+// Scopes of API tokens, each granting up to a role
+const (
+	ScopeRead  = "read"  // RoleGuest: read dashboards
+	ScopeWrite = "write" // RoleUser: change the account's own dashboards
+	ScopeAdmin = "admin" // RoleAdmin: everything an admin may do
+)
+
+// Scopes lists the scopes from the least to the most privileged
+var Scopes = []string{ScopeRead, ScopeWrite, ScopeAdmin}
+
+var scopeRoles = map[string]int{
+	ScopeRead:  RoleGuest,
+	ScopeWrite: RoleUser,
+	ScopeAdmin: RoleAdmin,
+}
+
+// ScopeRole returns the role granted by scopes, the highest of them
+func ScopeRole(scopes []string) int {
+	role := RoleGuest
+	for _, scope := range scopes {
+		role = max(role, scopeRoles[scope])
+	}
+	return role
+}
+
+// ValidScopes reports why scopes can't be given to a token, or nil
+func ValidScopes(scopes []string) error {
+	if len(scopes) == 0 {
+		return fmt.Errorf("needs a scope, one of %s", strings.Join(Scopes, ", "))
+	}
+	for _, scope := range scopes {
+		if _, ok := scopeRoles[scope]; !ok {
+			return fmt.Errorf("%q is not a scope, use %s", scope, strings.Join(Scopes, ", "))
+		}
+	}
+	return nil
+}
+
+var (
+	// ErrInvalidToken is returned for tokens that are malformed, not signed
+	// by the configured key, or revoked
+	ErrInvalidToken = errors.New("auth: invalid token")
+
+	// ErrExpiredToken is returned for tokens past their expiry
+	ErrExpiredToken = errors.New("auth: token expired")
+)
+
+// Token is an issued API token. The signed token itself is only shown when
+// it's issued, this is what's kept to list and revoke it.
+type Token struct {
+	ID        string    `json:"id"` // The jti claim
+	Name      string    `json:"name"`
+	Account   string    `json:"account"` // The sub claim, the account it acts for
+	Scopes    []string  `json:"scopes"`
+	IssuedAt  time.Time `json:"issued_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+	RevokedAt time.Time `json:"revoked_at,omitzero"`
+}
+
+// Active reports whether the token is accepted at now
+func (t Token) Active(now time.Time) bool {
+	return t.RevokedAt.IsZero() && now.Before(t.ExpiresAt)
+}
+
+// issuer is the iss claim of every token
+const issuer = "wasmdash"
+
+// Signing algorithms, as in the JWS alg header
+const (
+	AlgHS256 = "HS256"
+	AlgEdDSA = "EdDSA"
+)
+
+// Key prefixes of [api] signing_key for each algorithm
+const (
+	keyPrefixHMAC    = "hmac:"
+	keyPrefixEd25519 = "ed25519:"
+)
+
+// minSecretLength is the shortest HS256 secret accepted, in bytes
+const minSecretLength = 32
+
+// clockSkew is how far in the future a token may have been issued, for
+// clocks of servers sharing the key that are slightly ahead
+const clockSkew = time.Minute
+
+type header struct {
+	Alg string `json:"alg"`
+	Typ string `json:"typ"`
+}
+
+type claims struct {
+	ID        string `json:"jti"`
+	Issuer    string `json:"iss"`
+	Subject   string `json:"sub"`
+	Scope     string `json:"scope"` // Space-separated, as in RFC 8693
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+// Signer signs and verifies tokens with a single key
+type Signer struct {
+	alg     string
+	secret  []byte             // HS256
+	private ed25519.PrivateKey // EdDSA
+	public  ed25519.PublicKey
+}
+
+// ParseSigningKey returns the Signer for an [api] signing_key, which is
+// "hmac:" followed by a base64 secret of at least 32 bytes, or "ed25519:"
+// followed by a base64 Ed25519 seed. See GenerateSigningKey.
+func ParseSigningKey(key string) (*Signer, error) {
+	if secret, ok := strings.CutPrefix(key, keyPrefixHMAC); ok {
+		raw, err := base64.StdEncoding.DecodeString(secret)
+		if err != nil {
+			return nil, fmt.Errorf("hmac key is not base64: %w", err)
+		}
+		if len(raw) < minSecretLength {
+			return nil, fmt.Errorf("hmac key must be at least %d bytes, got %d", minSecretLength, len(raw))
+		}
+		return &Signer{alg: AlgHS256, secret: raw}, nil
+	}
+	if seed, ok := strings.CutPrefix(key, keyPrefixEd25519); ok {
+		raw, err := base64.StdEncoding.DecodeString(seed)
+		if err != nil {
+			return nil, fmt.Errorf("ed25519 key is not base64: %w", err)
+		}
+		if len(raw) != ed25519.SeedSize {
+			return nil, fmt.Errorf("ed25519 key must be a %d byte seed, got %d bytes", ed25519.SeedSize, len(raw))
+		}
+		private := ed25519.NewKeyFromSeed(raw)
+		return &Signer{alg: AlgEdDSA, private: private, public: private.Public().(ed25519.PublicKey)}, nil
+	}
+	return nil, fmt.Errorf("must start with %q or %q", keyPrefixEd25519, keyPrefixHMAC)
+}
+
+// GenerateSigningKey returns a new random key for [api] signing_key,
+// kind being "ed25519" or "hmac"
+func GenerateSigningKey(kind string) (string, error) {
+	var prefix string
+	var raw []byte
+	switch kind {
+	case "ed25519":
+		prefix, raw = keyPrefixEd25519, make([]byte, ed25519.SeedSize)
+	case "hmac":
+		prefix, raw = keyPrefixHMAC, make([]byte, minSecretLength)
+	default:
+		return "", fmt.Errorf("unknown key kind %q, use ed25519 or hmac", kind)
+	}
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return prefix + base64.StdEncoding.EncodeToString(raw), nil
+}
+
+// Algorithm returns the JWS algorithm tokens are signed with
+func (s *Signer) Algorithm() string {
+	return s.alg
+}
+
+// Sign returns the signed token for t
+func (s *Signer) Sign(t Token) (string, error) {
+	h, err := json.Marshal(header{Alg: s.alg, Typ: "JWT"})
+	if err != nil {
+		return "", err
+	}
+	c, err := json.Marshal(claims{
+		ID:        t.ID,
+		Issuer:    issuer,
+		Subject:   t.Account,
+		Scope:     strings.Join(t.Scopes, " "),
+		IssuedAt:  t.IssuedAt.Unix(),
+		ExpiresAt: t.ExpiresAt.Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	signed := encodeSegment(h) + "." + encodeSegment(c)
+	return signed + "." + encodeSegment(s.sign([]byte(signed))), nil
+}
+
+// Verify checks the signature and validity period of a token at now and
+// returns what it claims. Whether it was revoked is up to the caller.
+func (s *Signer) Verify(token string, now time.Time) (Token, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return Token{}, ErrInvalidToken
+	}
+
+	var h header
+	if err := decodeSegment(parts[0], &h); err != nil || h.Alg != s.alg {
+		return Token{}, ErrInvalidToken
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || !s.verify([]byte(parts[0]+"."+parts[1]), signature) {
+		return Token{}, ErrInvalidToken
+	}
+
+	var c claims
+	if err := decodeSegment(parts[1], &c); err != nil || c.Issuer != issuer || c.ID == "" || c.Subject == "" {
+		return Token{}, ErrInvalidToken
+	}
+	t := Token{
+		ID:        c.ID,
+		Account:   c.Subject,
+		Scopes:    strings.Fields(c.Scope),
+		IssuedAt:  time.Unix(c.IssuedAt, 0).UTC(),
+		ExpiresAt: time.Unix(c.ExpiresAt, 0).UTC(),
+	}
+	if t.IssuedAt.After(now.Add(clockSkew)) {
+		return Token{}, ErrInvalidToken
+	}
+	if !now.Before(t.ExpiresAt) {
+		return t, ErrExpiredToken
+	}
+	return t, nil
+}
+
+func (s *Signer) sign(data []byte) []byte {
+	if s.alg == AlgEdDSA {
+		return ed25519.Sign(s.private, data)
+	}
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write(data)
+	return mac.Sum(nil)
+}
+
+func (s *Signer) verify(data, signature []byte) bool {
+	if s.alg == AlgEdDSA {
+		return ed25519.Verify(s.public, data, signature)
+	}
+	return hmac.Equal(s.sign(data), signature)
+}
+
+// LooksLikeToken reports whether a bearer token is a signed token rather
+// than the static [api] token
+func LooksLikeToken(bearer string) bool {
+	return strings.Count(bearer, ".") == 2 && !slices.Contains(strings.Split(bearer, "."), "")
+}
+
+func encodeSegment(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeSegment(segment string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
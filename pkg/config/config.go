@@ -0,0 +1,334 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/pynezz/wasmdash/pkg/auth"
+)
+
+/*
+ * Package for the wasmdash.toml configuration file
+ *
+ * Values are resolved in the following order, later sources winning:
+ *   defaults -> config file -> WASMDASH_* environment variables -> flags
+ */
+
+// Config is the on-disk representation of wasmdash.toml
+type Config struct {
+	Server  Server  `toml:"server"`
+	Theme   Theme   `toml:"theme"`
+	Widgets Widgets `toml:"widgets"`
+	Storage Storage `toml:"storage"`
+	API     API     `toml:"api"`
+	System  System  `toml:"system"`
+	Auth    Auth    `toml:"auth"`
+	Secrets Secrets `toml:"secrets"`
+	Log     Log     `toml:"log"`
+	Metrics Metrics `toml:"metrics"`
+	CSP     CSP     `toml:"csp"`
+}
+
+// Server holds the listen address and identity of the HTTP server
+type Server struct {
+	Host string `toml:"host" env:"WASMDASH_HOST"`
+	Port Port   `toml:"port" env:"WASMDASH_PORT"`
+	Env  string `toml:"env" env:"WASMDASH_ENV"`
+	Name string `toml:"name" env:"WASMDASH_NAME"`
+
+	// ShutdownTimeout is how long requests in flight may take to finish
+	// after SIGINT or SIGTERM
+	ShutdownTimeout time.Duration `toml:"shutdown_timeout" env:"WASMDASH_SERVER_SHUTDOWN_TIMEOUT"`
+
+	// SlowRequest is how long a request may take before it's logged as a
+	// warning with its Server-Timing, 0 never warns
+	SlowRequest time.Duration `toml:"slow_request" env:"WASMDASH_SERVER_SLOW_REQUEST"`
+
+	// HSTSIncludeSubdomains extends Strict-Transport-Security in production
+	// to every subdomain of the host, only when they're all served over HTTPS
+	HSTSIncludeSubdomains bool `toml:"hsts_include_subdomains" env:"WASMDASH_SERVER_HSTS_INCLUDE_SUBDOMAINS"`
+}
+
+// Theme mirrors scripts/theme-config.go, colors are HSL triplets ("262 83% 58%")
+type Theme struct {
+	Primary string `toml:"primary" env:"WASMDASH_THEME_PRIMARY"`
+	Accent  string `toml:"accent" env:"WASMDASH_THEME_ACCENT"`
+	Success string `toml:"success" env:"WASMDASH_THEME_SUCCESS"`
+	Warning string `toml:"warning" env:"WASMDASH_THEME_WARNING"`
+	Dark    bool   `toml:"dark" env:"WASMDASH_THEME_DARK"`
+}
+
+// Widgets configures where widget definitions are loaded from
+type Widgets struct {
+	Dir string `toml:"dir" env:"WASMDASH_WIDGETS_DIR"`
+}
+
+// Storage configures where dashboard layouts are persisted
+type Storage struct {
+	// Path to the SQLite database, created on first run.
+	// Empty keeps layouts in memory, they're lost on restart.
+	Path string `toml:"path" env:"WASMDASH_STORAGE_PATH"`
+}
+
+// API configures the JSON API under /api/v1
+type API struct {
+	Enabled bool `toml:"enabled" env:"WASMDASH_API_ENABLED"`
+
+	// Token lets requests from other machines in with `Authorization: Bearer`.
+	// Without it the API only answers requests from loopback.
+	Token string `toml:"token" env:"WASMDASH_API_TOKEN"`
+
+	// SigningKey signs the expiring, scoped tokens issued with `wasmdash token`
+	// or at /admin/tokens: "ed25519:<seed>" or "hmac:<secret>", base64.
+	// Without it only Token is accepted.
+	SigningKey string `toml:"signing_key" env:"WASMDASH_API_SIGNING_KEY"`
+}
+
+// System configures the host metrics shown in the system status card
+type System struct {
+	Interval time.Duration `toml:"interval" env:"WASMDASH_SYSTEM_INTERVAL"`
+	Mounts   []string      `toml:"mounts" env:"WASMDASH_SYSTEM_MOUNTS"` // Comma-separated in the environment
+
+	// Usage percentages at which the health turns to warning or critical
+	Warning  Thresholds `toml:"warning"`
+	Critical Thresholds `toml:"critical"`
+}
+
+// Thresholds are usage percentages from 0 to 100, 0 disables the check
+type Thresholds struct {
+	CPU    float64 `toml:"cpu"`
+	Memory float64 `toml:"memory"`
+	Disk   float64 `toml:"disk"`
+}
+
+// Auth configures authentication and the initial set of accounts
+type Auth struct {
+	// Enabled requires signing in for the dashboard and the API
+	Enabled    bool          `toml:"enabled" env:"WASMDASH_AUTH_ENABLED"`
+	SessionTTL time.Duration `toml:"session_ttl" env:"WASMDASH_AUTH_SESSION_TTL"`
+
+	// Accounts are created or updated in storage on startup. Passwords are
+	// argon2id hashes from `wasmdash hash-password`, or plaintext.
+	Accounts []auth.Account `toml:"accounts"`
+}
+
+// Secrets configures the encrypted file widget settings reference secrets
+// from as ${secret:name}, see pkg/secrets. It's encrypted with either an
+// identity from `wasmdash secret keygen` or a passphrase.
+type Secrets struct {
+	// Path to the secrets file, created on first use. Empty disables secrets.
+	Path       string `toml:"path" env:"WASMDASH_SECRETS_PATH"`
+	Identity   string `toml:"identity" env:"WASMDASH_SECRETS_IDENTITY"`
+	Passphrase string `toml:"passphrase" env:"WASMDASH_SECRETS_PASSPHRASE"`
+}
+
+// Log configures where the server logs to and how much, see pkg/logging
+type Log struct {
+	Level  string `toml:"level" env:"WASMDASH_LOG_LEVEL"`   // debug, info, warn or error
+	Format string `toml:"format" env:"WASMDASH_LOG_FORMAT"` // text or json
+	Stdout bool   `toml:"stdout" env:"WASMDASH_LOG_STDOUT"`
+
+	// File is also logged to when set. It's rotated once it grows past
+	// MaxSize MiB or gets older than MaxAge, 0 disables either, keeping the
+	// MaxBackups newest rotated files next to it, none for 0.
+	File       string        `toml:"file" env:"WASMDASH_LOG_FILE"`
+	MaxSize    int           `toml:"max_size" env:"WASMDASH_LOG_MAX_SIZE"`
+	MaxAge     time.Duration `toml:"max_age" env:"WASMDASH_LOG_MAX_AGE"`
+	MaxBackups int           `toml:"max_backups" env:"WASMDASH_LOG_MAX_BACKUPS"`
+}
+
+// Metrics configures the Prometheus metrics at /metrics
+type Metrics struct {
+	Enabled bool `toml:"enabled" env:"WASMDASH_METRICS_ENABLED"`
+
+	// Token lets scrapers on other machines in with `Authorization: Bearer`.
+	// Without it /metrics only answers requests from loopback.
+	Token string `toml:"token" env:"WASMDASH_METRICS_TOKEN"`
+}
+
+// CSP configures the Content-Security-Policy of the pages, see pkg/csp
+type CSP struct {
+	// ReportOnly reports violations to /csp-report without blocking anything
+	ReportOnly bool `toml:"report_only" env:"WASMDASH_CSP_REPORT_ONLY"`
+
+	// Directives replace the sources of the default policy, by directive
+	Directives map[string][]string `toml:"directives"`
+
+	// Routes add sources for the pages at a path and below it
+	Routes []CSPRoute `toml:"routes"`
+}
+
+// CSPRoute adds sources to the policy of the pages under Path
+type CSPRoute struct {
+	Path       string              `toml:"path"`
+	Directives map[string][]string `toml:"directives"`
+}
+
+// Port accepts both `port = 8080` and `port = "8080"`
+type Port string
+
+func (p *Port) UnmarshalTOML(v any) error {
+	switch v := v.(type) {
+	case int64:
+		*p = Port(strconv.FormatInt(v, 10))
+	case string:
+		*p = Port(v)
+	default:
+		return fmt.Errorf("expected a number or string, got %T", v)
+	}
+	return nil
+}
+
+const (
+	EnvDevelopment = "development"
+	EnvProduction  = "production"
+)
+
+// Default returns the configuration used when no file is given
+func Default() *Config {
+	return &Config{
+		Server: Server{
+			Host: "localhost",
+			Port: "8080",
+			Env:  EnvDevelopment,
+			Name: "wasmdash",
+
+			ShutdownTimeout: 10 * time.Second,
+			SlowRequest:     500 * time.Millisecond,
+		},
+		Theme: Theme{
+			Primary: "262 83% 58%", // Purple
+			Accent:  "178 60% 48%", // Teal
+			Success: "142 76% 36%", // Green
+			Warning: "43 96% 56%",  // Golden
+			Dark:    true,
+		},
+		Widgets: Widgets{
+			Dir: "widgets",
+		},
+		Storage: Storage{
+			Path: "wasmdash.db",
+		},
+		API: API{
+			Enabled: true,
+		},
+		System: System{
+			Interval: 5 * time.Second,
+			Mounts:   []string{"/"},
+			Warning:  Thresholds{CPU: 80, Memory: 85, Disk: 85},
+			Critical: Thresholds{CPU: 95, Memory: 95, Disk: 95},
+		},
+		Auth: Auth{
+			SessionTTL: 24 * time.Hour,
+		},
+		Metrics: Metrics{
+			Enabled: true,
+		},
+		Log: Log{
+			Level:      "info",
+			Format:     "text",
+			Stdout:     true,
+			File:       "wasmdash.log",
+			MaxSize:    10,
+			MaxAge:     7 * 24 * time.Hour,
+			MaxBackups: 5,
+		},
+	}
+}
+
+// Override sets a setting after the file and the environment, e.g. from a
+// command line flag
+type Override struct {
+	Key    string // The setting, e.g. server.port
+	Source string // Where the value came from, e.g. --port
+	Set    func(cfg *Config)
+}
+
+// Load reads the file at path on top of the defaults, applies WASMDASH_*
+// environment overrides and then overrides, and validates the result.
+// An empty path skips the file and only applies the environment.
+func Load(path string, overrides ...Override) (*Config, error) {
+	cfg := Default()
+
+	var (
+		data   []byte
+		issues []Issue
+	)
+	if path != "" {
+		var err error
+		if data, err = os.ReadFile(path); err != nil {
+			return nil, fmt.Errorf("reading config: %w", err)
+		}
+		if issues, err = cfg.decode(path, data); err != nil {
+			return nil, err
+		}
+	}
+
+	setBy, err := ApplyEnv(cfg)
+	if err != nil {
+		return nil, err
+	}
+	for _, o := range overrides {
+		o.Set(cfg)
+		setBy[o.Key] = o.Source
+	}
+
+	for _, issue := range cfg.Validate() {
+		if name, ok := setBy[issue.Key]; ok {
+			issue.Msg += " (set by " + name + ")"
+		} else {
+			issue.File = path
+			issue.Line = locate(data, issue.Key)
+		}
+		issues = append(issues, issue)
+	}
+	if len(issues) > 0 {
+		return nil, &Error{Issues: issues}
+	}
+
+	return cfg, nil
+}
+
+// decodeErr matches the "toml: line N (last key "k"): msg" errors returned for type mismatches
+var decodeErr = regexp.MustCompile(`^toml: (?:line (\d+) )?(?:\(last key "([^"]*)"\): )?(.*)$`)
+
+// decode parses data into cfg. Syntax errors are fatal and returned as an
+// *Error, unknown keys are returned as issues so validation can continue.
+func (cfg *Config) decode(path string, data []byte) ([]Issue, error) {
+	md, err := toml.NewDecoder(bytes.NewReader(data)).Decode(cfg)
+	if err != nil {
+		issue := Issue{File: path, Msg: err.Error()}
+
+		var perr toml.ParseError
+		if errors.As(err, &perr) {
+			issue.Line, issue.Key, issue.Msg = perr.Position.Line, perr.LastKey, perr.Message
+		} else if m := decodeErr.FindStringSubmatch(err.Error()); m != nil {
+			issue.Line, _ = strconv.Atoi(m[1])
+			issue.Key, issue.Msg = m[2], m[3]
+		}
+		return nil, &Error{Issues: []Issue{issue}}
+	}
+
+	var issues []Issue
+	for _, key := range md.Undecoded() {
+		issues = append(issues, Issue{
+			File: path,
+			Line: locate(data, key.String()),
+			Key:  key.String(),
+			Msg:  "unknown key",
+		})
+	}
+
+	return issues, nil
+}
+
+// IsProduction reports whether the server runs with production settings
+func (cfg *Config) IsProduction() bool {
+	return cfg.Server.Env == EnvProduction
+}
@@ -0,0 +1,289 @@
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pynezz/wasmdash/pkg/auth"
+	"github.com/pynezz/wasmdash/pkg/csp"
+	"github.com/pynezz/wasmdash/pkg/logging"
+	"github.com/pynezz/wasmdash/pkg/secrets"
+)
+
+// Issue is a single problem found in the configuration
+type Issue struct {
+	File string
+	Line int // 0 when the value did not come from the file
+	Key  string
+	Msg  string
+}
+
+func (i Issue) String() string {
+	var b strings.Builder
+	if i.File != "" {
+		b.WriteString(i.File)
+		if i.Line > 0 {
+			b.WriteString(":" + strconv.Itoa(i.Line))
+		}
+		b.WriteString(": ")
+	}
+	if i.Key != "" {
+		b.WriteString(i.Key + ": ")
+	}
+	b.WriteString(i.Msg)
+	return b.String()
+}
+
+// Error collects every issue found while loading the configuration
+type Error struct {
+	Issues []Issue
+}
+
+func (e *Error) Error() string {
+	lines := make([]string, 0, len(e.Issues))
+	for _, issue := range e.Issues {
+		lines = append(lines, issue.String())
+	}
+	return "invalid configuration:\n  " + strings.Join(lines, "\n  ")
+}
+
+// minTokenLength keeps API tokens out of brute-force range
+const minTokenLength = 32
+
+var hslPattern = regexp.MustCompile(`^\d{1,3}(\.\d+)? \d{1,3}(\.\d+)?% \d{1,3}(\.\d+)?%$`)
+
+// Validate checks the semantic rules that the TOML decoder can't express
+func (cfg *Config) Validate() []Issue {
+	var issues []Issue
+	add := func(key, format string, args ...any) {
+		issues = append(issues, Issue{Key: key, Msg: fmt.Sprintf(format, args...)})
+	}
+
+	if cfg.Server.Host == "" {
+		add("server.host", "must not be empty")
+	}
+	if port, err := strconv.Atoi(string(cfg.Server.Port)); err != nil || port < 1 || port > 65535 {
+		add("server.port", "%q is not a port number between 1 and 65535", cfg.Server.Port)
+	}
+	if cfg.Server.Env != EnvDevelopment && cfg.Server.Env != EnvProduction {
+		add("server.env", "%q must be %q or %q", cfg.Server.Env, EnvDevelopment, EnvProduction)
+	}
+	if cfg.Server.Name == "" {
+		add("server.name", "must not be empty")
+	}
+	if cfg.Server.ShutdownTimeout <= 0 {
+		add("server.shutdown_timeout", "must be a positive duration")
+	}
+	if cfg.Server.SlowRequest < 0 {
+		add("server.slow_request", "must be 0 or a positive duration")
+	}
+
+	for _, color := range []struct{ key, value string }{
+		{"theme.primary", cfg.Theme.Primary},
+		{"theme.accent", cfg.Theme.Accent},
+		{"theme.success", cfg.Theme.Success},
+		{"theme.warning", cfg.Theme.Warning},
+	} {
+		if !hslPattern.MatchString(color.value) {
+			add(color.key, "%q is not an HSL triplet like \"262 83%% 58%%\"", color.value)
+		}
+	}
+
+	if cfg.Widgets.Dir != "" {
+		if info, err := os.Stat(cfg.Widgets.Dir); err == nil && !info.IsDir() {
+			add("widgets.dir", "%q is not a directory", cfg.Widgets.Dir)
+		}
+	}
+
+	if cfg.Storage.Path != "" {
+		if info, err := os.Stat(filepath.Dir(cfg.Storage.Path)); err != nil || !info.IsDir() {
+			add("storage.path", "directory of %q does not exist", cfg.Storage.Path)
+		}
+	}
+
+	if cfg.API.Token != "" && len(cfg.API.Token) < minTokenLength {
+		add("api.token", "must be at least %d characters", minTokenLength)
+	}
+	if cfg.API.SigningKey != "" {
+		if _, err := auth.ParseSigningKey(cfg.API.SigningKey); err != nil {
+			add("api.signing_key", "%v, generate one with `wasmdash token keygen`", err)
+		}
+	}
+
+	if cfg.Metrics.Token != "" && len(cfg.Metrics.Token) < minTokenLength {
+		add("metrics.token", "must be at least %d characters", minTokenLength)
+	}
+
+	if cfg.System.Interval < time.Second {
+		add("system.interval", "must be at least 1s")
+	}
+	for _, mount := range cfg.System.Mounts {
+		if !filepath.IsAbs(mount) {
+			add("system.mounts", "%q is not an absolute path", mount)
+		}
+	}
+	for _, t := range []struct {
+		name              string
+		warning, critical float64
+	}{
+		{"cpu", cfg.System.Warning.CPU, cfg.System.Critical.CPU},
+		{"memory", cfg.System.Warning.Memory, cfg.System.Critical.Memory},
+		{"disk", cfg.System.Warning.Disk, cfg.System.Critical.Disk},
+	} {
+		if t.warning < 0 || t.warning > 100 {
+			add("system.warning."+t.name, "%g is not a percentage between 0 and 100", t.warning)
+		}
+		if t.critical < 0 || t.critical > 100 {
+			add("system.critical."+t.name, "%g is not a percentage between 0 and 100", t.critical)
+		}
+		if t.warning > 0 && t.critical > 0 && t.warning >= t.critical {
+			add("system.warning."+t.name, "%g must be below the critical threshold %g", t.warning, t.critical)
+		}
+	}
+
+	if cfg.Auth.SessionTTL <= 0 {
+		add("auth.session_ttl", "must be a positive duration")
+	}
+	seen := make(map[string]bool)
+	for i, account := range cfg.Auth.Accounts {
+		key := fmt.Sprintf("auth.accounts[%d].", i)
+		if err := auth.ValidID(account.ID); err != nil {
+			add(key+"id", "%v", err)
+		} else if seen[account.ID] {
+			add(key+"id", "duplicate account %q", account.ID)
+		}
+		seen[account.ID] = true
+
+		if !auth.ValidRole(account.Role) {
+			add(key+"role", "account %q has unknown role %d, use %d (guest), %d (user) or %d (admin)",
+				account.ID, account.Role, auth.RoleGuest, auth.RoleUser, auth.RoleAdmin)
+		}
+		if account.Password == "" {
+			add(key+"password", "account %q has no password", account.ID)
+		} else if auth.IsHash(account.Password) && auth.CheckHash(account.Password) != nil {
+			add(key+"password", "account %q has an invalid argon2id hash, make one with `wasmdash hash-password`", account.ID)
+		}
+	}
+
+	switch sc := cfg.Secrets; {
+	case sc.Identity != "" && sc.Passphrase != "":
+		add("secrets.identity", "set either an identity or a passphrase, not both")
+	case sc.Identity != "":
+		if _, err := secrets.ParseIdentity(sc.Identity); err != nil {
+			add("secrets.identity", "%v", err)
+		}
+	case sc.Passphrase != "":
+		if len(sc.Passphrase) < secrets.MinPassphraseLength {
+			add("secrets.passphrase", "must be at least %d characters", secrets.MinPassphraseLength)
+		}
+	case sc.Path != "":
+		add("secrets.path", "needs an identity or a passphrase to encrypt the file with")
+	}
+	if path := cfg.Secrets.Path; path != "" {
+		if info, err := os.Stat(filepath.Dir(path)); err != nil || !info.IsDir() {
+			add("secrets.path", "directory of %q does not exist", path)
+		}
+	}
+
+	for directive, sources := range cfg.CSP.Directives {
+		if err := csp.Check(directive, sources); err != nil {
+			add("csp.directives", "%v", err)
+		}
+	}
+	for i, route := range cfg.CSP.Routes {
+		key := fmt.Sprintf("csp.routes[%d].", i)
+		if !strings.HasPrefix(route.Path, "/") {
+			add(key+"path", "%q must start with /", route.Path)
+		}
+		for directive, sources := range route.Directives {
+			if err := csp.Check(directive, sources); err != nil {
+				add(key+"directives", "route %s: %v", route.Path, err)
+			}
+		}
+	}
+
+	if _, err := logging.ParseLevel(cfg.Log.Level); err != nil {
+		add("log.level", "%v", err)
+	}
+	if format := strings.ToLower(cfg.Log.Format); format != logging.FormatText && format != logging.FormatJSON {
+		add("log.format", "%q must be %q or %q", cfg.Log.Format, logging.FormatText, logging.FormatJSON)
+	}
+	if !cfg.Log.Stdout && cfg.Log.File == "" {
+		add("log.stdout", "nothing would be logged, enable stdout or set a file")
+	}
+	if path := cfg.Log.File; path != "" {
+		if info, err := os.Stat(filepath.Dir(path)); err != nil || !info.IsDir() {
+			add("log.file", "directory of %q does not exist", path)
+		}
+	}
+	if cfg.Log.MaxSize < 0 {
+		add("log.max_size", "must be 0 or more MiB")
+	}
+	if cfg.Log.MaxAge < 0 {
+		add("log.max_age", "must be 0 or a positive duration")
+	}
+	if cfg.Log.MaxBackups < 0 {
+		add("log.max_backups", "must be 0 or more")
+	}
+
+	return issues
+}
+
+// locate returns the line a dotted key is defined on, or 0 if it can't be found.
+// It understands [table] and [[array]] headers and `key = value` pairs, which
+// covers what wasmdash.toml needs without re-implementing the TOML grammar.
+// Entries of an array are named by their index, like auth.accounts[1].id,
+// without one a key is looked up in the first entry.
+func locate(data []byte, key string) int {
+	if len(data) == 0 || key == "" {
+		return 0
+	}
+
+	parts := strings.Split(key, ".")
+	table, leaf := strings.Join(parts[:len(parts)-1], "."), parts[len(parts)-1]
+
+	current, base := "", ""
+	entries := make(map[string]int) // Entries of each [[array]] so far
+	tableLine := 0
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		if strings.HasPrefix(text, "[") {
+			current = strings.TrimSpace(strings.Trim(text, "[]"))
+			base = current
+			if strings.HasPrefix(text, "[[") {
+				current = fmt.Sprintf("%s[%d]", base, entries[base])
+				entries[base]++
+			}
+			if (current == key || base == key) && tableLine == 0 {
+				return line
+			}
+			if (current == table || base == table) && tableLine == 0 {
+				tableLine = line
+			}
+			continue
+		}
+
+		name, _, ok := strings.Cut(text, "=")
+		if !ok {
+			continue
+		}
+		name = strings.Trim(strings.TrimSpace(name), `"'`)
+		if ((current == table || base == table) && name == leaf) || (current == "" && name == key) {
+			return line
+		}
+	}
+
+	return tableLine
+}
@@ -0,0 +1,116 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const accountsTOML = `[server]
+port = 8080
+
+[auth]
+enabled = true
+
+[[auth.accounts]]
+id = "admin"
+role = 1000
+password = "adminpass"
+
+[[auth.accounts]]
+id = "bob"
+role = 7
+password = "bobpass12"
+
+[[auth.accounts]]
+id = "gus"
+role = 0
+`
+
+func TestLocate(t *testing.T) {
+	tests := []struct {
+		key  string
+		want int
+	}{
+		{"server.port", 2},
+		{"auth.enabled", 5},
+		{"auth.accounts[0].id", 8},
+		{"auth.accounts[1].role", 14},
+		{"auth.accounts[2].id", 18},
+		{"auth.accounts[2].password", 17}, // Not set, the entry
+		{"auth.accounts.id", 8},           // Without an index, the first entry
+		{"auth.accounts[3].id", 0},
+		{"log.level", 0},
+	}
+	for _, tt := range tests {
+		if got := locate([]byte(accountsTOML), tt.key); got != tt.want {
+			t.Errorf("locate(%q) = %d, want %d", tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestLoadAccountIssues(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "wasmdash.toml")
+	if err := os.WriteFile(path, []byte(accountsTOML), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := Load(path)
+	var cerr *Error
+	if !errors.As(err, &cerr) {
+		t.Fatalf("Load = %v, want an *Error", err)
+	}
+	want := map[string]int{
+		"auth.accounts[1].role":     14,
+		"auth.accounts[2].password": 17,
+	}
+	for _, issue := range cerr.Issues {
+		line, ok := want[issue.Key]
+		if !ok {
+			t.Errorf("unexpected issue %s", issue)
+			continue
+		}
+		if issue.Line != line {
+			t.Errorf("%s: line %d, want %d", issue.Key, issue.Line, line)
+		}
+		delete(want, issue.Key)
+	}
+	for key := range want {
+		t.Errorf("no issue for %s", key)
+	}
+}
+
+func TestLoadOverrides(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "wasmdash.toml")
+	if err := os.WriteFile(path, []byte("[server]\nenv = \"staging\"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	env := func(env string) Override {
+		return Override{Key: "server.env", Source: "--env", Set: func(cfg *Config) { cfg.Server.Env = env }}
+	}
+
+	// The file alone is invalid, the override fixes it
+	if _, err := Load(path); err == nil {
+		t.Fatal("Load without the override succeeded")
+	}
+	cfg, err := Load(path, env(EnvProduction))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cfg.IsProduction() {
+		t.Errorf("env = %q, want %q", cfg.Server.Env, EnvProduction)
+	}
+
+	// An invalid override is reported for the flag, not the file
+	_, err = Load(path, env("test"))
+	var cerr *Error
+	if !errors.As(err, &cerr) || len(cerr.Issues) != 1 {
+		t.Fatalf("Load = %v, want one issue", err)
+	}
+	issue := cerr.Issues[0]
+	if issue.Key != "server.env" || issue.Line != 0 || !strings.HasSuffix(issue.Msg, "(set by --env)") {
+		t.Errorf("issue = %s, want server.env set by --env", issue)
+	}
+}
@@ -0,0 +1,70 @@
+package core
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"sync"
+)
+
+// NonceSize is the number of random bytes in a nonce
+const NonceSize = 16
+
+// poolNonces is how many nonces the default source reads at once
+const poolNonces = 256
+
+// NonceSource hands out nonces from a pool of random bytes read from
+// crypto/rand ahead of time, and again whenever it runs out. It fails closed:
+// when the pool can't be refilled Nonce returns an error, never a weaker
+// nonce.
+type NonceSource struct {
+	mu   sync.Mutex
+	pool []byte
+	next int // Offset of the first unused byte of pool
+}
+
+// NewNonceSource returns a source reading n nonces at a time. Its pool is
+// filled on first use, or by Fill.
+func NewNonceSource(n int) *NonceSource {
+	pool := make([]byte, max(n, 1)*NonceSize)
+	return &NonceSource{pool: pool, next: len(pool)}
+}
+
+// Fill refills the pool with random bytes. Called at startup, it makes sure
+// there's entropy before any page is served.
+func (s *NonceSource) Fill() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.fill()
+}
+
+func (s *NonceSource) fill() error {
+	if _, err := rand.Read(s.pool); err != nil {
+		clear(s.pool)
+		s.next = len(s.pool)
+		return fmt.Errorf("nonce: reading random bytes: %w", err)
+	}
+	s.next = 0
+	return nil
+}
+
+// Nonce returns a new base64 nonce of NonceSize random bytes
+func (s *NonceSource) Nonce() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.next+NonceSize > len(s.pool) {
+		if err := s.fill(); err != nil {
+			return "", err
+		}
+	}
+	b := s.pool[s.next : s.next+NonceSize]
+	nonce := base64.StdEncoding.EncodeToString(b)
+	// Used bytes are wiped so nothing can hand them out twice
+	clear(b)
+	s.next += NonceSize
+	return nonce, nil
+}
+
+// Nonces is the source of GenerateNonce
+var Nonces = NewNonceSource(poolNonces)
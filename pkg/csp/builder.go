@@ -0,0 +1,110 @@
+package csp
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Config is the [csp] section of the configuration
+type Config struct {
+	// Directives replace the sources of the Default policy
+	Directives map[string][]string
+
+	// Routes add sources for the pages under a path, like a frame-src for
+	// the dashboard with an embedded Grafana panel
+	Routes []Route
+
+	// ReportOnly sends Content-Security-Policy-Report-Only: violations are
+	// reported but nothing is blocked, to try out a policy
+	ReportOnly bool
+
+	// Production upgrades requests for http: resources to https:
+	Production bool
+}
+
+// Route adds sources to the policy of the pages at Path and below it
+type Route struct {
+	Path       string
+	Directives map[string][]string
+}
+
+// Builder makes the header of each page, see Header
+type Builder struct {
+	base       Policy
+	routes     []route
+	reportOnly bool
+}
+
+type route struct {
+	path   string
+	policy Policy
+}
+
+// New checks cfg and returns a Builder for it
+func New(cfg Config) (*Builder, error) {
+	b := &Builder{base: Default(), reportOnly: cfg.ReportOnly}
+	for directive, sources := range cfg.Directives {
+		if err := Check(directive, sources); err != nil {
+			return nil, fmt.Errorf("csp: %w", err)
+		}
+		b.base[directive] = sources
+	}
+	if cfg.Production {
+		b.base["upgrade-insecure-requests"] = nil
+	}
+
+	for _, r := range cfg.Routes {
+		if !strings.HasPrefix(r.Path, "/") {
+			return nil, fmt.Errorf("csp: route %q must start with /", r.Path)
+		}
+		policy := b.base.Clone()
+		for directive, sources := range r.Directives {
+			if err := Check(directive, sources); err != nil {
+				return nil, fmt.Errorf("csp: route %s: %w", r.Path, err)
+			}
+			policy.Add(directive, sources...)
+		}
+		b.routes = append(b.routes, route{path: strings.TrimSuffix(r.Path, "/"), policy: policy})
+	}
+	return b, nil
+}
+
+// WithEval returns a copy of b that also allows eval in scripts, for pages
+// served with the stock Alpine build instead of its CSP build
+func (b *Builder) WithEval() *Builder {
+	eval := &Builder{base: b.base.Clone(), reportOnly: b.reportOnly}
+	eval.base.Add("script-src", "'unsafe-eval'")
+	for _, r := range b.routes {
+		policy := r.policy.Clone()
+		policy.Add("script-src", "'unsafe-eval'")
+		eval.routes = append(eval.routes, route{path: r.path, policy: policy})
+	}
+	return eval
+}
+
+// Policy returns the policy of the page at path: that of the longest route
+// it's at or below, or the base policy
+func (b *Builder) Policy(path string) Policy {
+	policy, matched := b.base, -1
+	for _, r := range b.routes {
+		if (path == r.path || strings.HasPrefix(path, r.path+"/") || r.path == "") && len(r.path) > matched {
+			policy, matched = r.policy, len(r.path)
+		}
+	}
+	return policy
+}
+
+// Header returns the name and value of the policy header for the page at
+// path, allowing the scripts carrying nonce
+func (b *Builder) Header(path, nonce string) (name, value string) {
+	name = "Content-Security-Policy"
+	if b.reportOnly {
+		name = "Content-Security-Policy-Report-Only"
+	}
+	return name, b.Policy(path).String(nonce) + "; report-uri " + ReportPath + "; report-to " + ReportGroup
+}
+
+// ReportingEndpoints is the Reporting-Endpoints header naming ReportGroup
+func ReportingEndpoints() string {
+	return ReportGroup + `="` + ReportPath + `"`
+}
@@ -0,0 +1,131 @@
+package csp
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+/*
+ * Package for the Content-Security-Policy of the pages the server renders
+ *
+ * A Policy holds the sources of each directive. The Builder makes the header
+ * of a page from the policy configured under [csp], the additions for the
+ * route of the page and the nonce of its scripts:
+ *
+ *   name, value := builder.Header("/dashboard", nonce)
+ *
+ * Browsers report violations to ReportPath, see handlers.CSPReport.
+ */
+
+// ReportPath is where browsers send violation reports, both with report-uri
+// and the Reporting API
+const ReportPath = "/csp-report"
+
+// ReportGroup is the Reporting-Endpoints name of ReportPath
+const ReportGroup = "csp"
+
+// Directives are the directives a policy may set, in the order they're
+// written. The reporting directives are added by the Builder.
+var Directives = []string{
+	"default-src", "script-src", "script-src-elem", "script-src-attr",
+	"style-src", "style-src-elem", "style-src-attr", "img-src", "font-src",
+	"connect-src", "media-src", "object-src", "frame-src", "child-src",
+	"worker-src", "manifest-src", "base-uri", "form-action",
+	"frame-ancestors", "upgrade-insecure-requests",
+}
+
+// Policy maps directives to their sources. The zero value is an empty policy.
+type Policy map[string][]string
+
+// Default is the policy pages get without [csp] directives
+func Default() Policy {
+	return Policy{
+		"default-src": {"'none'"},
+		// Alpine's CSP build runs without eval, and the pages carry no
+		// inline handlers or style attributes: see static/js/components.js
+		"script-src":   {"'self'"},
+		"style-src":    {"'self'"},
+		"img-src":      {"'self'", "data:"},
+		"font-src":     {"'self'"},
+		"connect-src":  {"'self'"},
+		"media-src":    {"'self'"},
+		"manifest-src": {"'self'"},
+		"worker-src":   {"'self'"},
+		"object-src":   {"'none'"},
+		"frame-src":    {"'none'"},
+		"base-uri":     {"'self'"},
+		"form-action":  {"'self'"},
+
+		// Like X-Frame-Options: DENY, no one may frame the pages
+		"frame-ancestors": {"'none'"},
+	}
+}
+
+// Check returns an error if directive isn't one of Directives, or a source
+// would break the header
+func Check(directive string, sources []string) error {
+	if !slices.Contains(Directives, directive) {
+		return fmt.Errorf("unknown directive %q", directive)
+	}
+	for _, source := range sources {
+		if source == "" || strings.ContainsAny(source, ";,\"\r\n\t ") {
+			return fmt.Errorf("%s: invalid source %q", directive, source)
+		}
+	}
+	return nil
+}
+
+// Clone returns a copy of p that can be changed without changing p
+func (p Policy) Clone() Policy {
+	clone := make(Policy, len(p))
+	for directive, sources := range p {
+		clone[directive] = slices.Clone(sources)
+	}
+	return clone
+}
+
+// Add adds sources to directive, dropping 'none'. A directive the policy
+// doesn't set starts from the sources of default-src, which it would fall
+// back to.
+func (p Policy) Add(directive string, sources ...string) {
+	current, ok := p[directive]
+	if !ok && strings.HasSuffix(directive, "-src") {
+		current = p["default-src"]
+	}
+	merged := slices.DeleteFunc(slices.Clone(current), func(s string) bool { return s == "'none'" })
+	for _, source := range sources {
+		if !slices.Contains(merged, source) {
+			merged = append(merged, source)
+		}
+	}
+	p[directive] = merged
+}
+
+// String formats p for the header, adding nonce to the scripts and styles
+// allowed. An empty nonce adds none.
+func (p Policy) String(nonce string) string {
+	p = p.Clone()
+	if nonce != "" {
+		p.Add("script-src", "'nonce-"+nonce+"'")
+		p.Add("style-src", "'nonce-"+nonce+"'")
+	}
+
+	names := slices.Collect(maps.Keys(p))
+	slices.SortFunc(names, func(a, b string) int {
+		return slices.Index(Directives, a) - slices.Index(Directives, b)
+	})
+	var b strings.Builder
+	for _, name := range names {
+		if b.Len() > 0 {
+			b.WriteString("; ")
+		}
+		b.WriteString(name)
+		for _, source := range p[name] {
+			b.WriteByte(' ')
+			b.WriteString(source)
+		}
+	}
+	return b.String()
+}
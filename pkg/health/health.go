@@ -0,0 +1,148 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+/*
+ * Package for the health of the server, reported at /readyz and /health
+ *
+ * Components register a Check with a Registry: a function returning an error
+ * while the component can't do its job. Run runs them all concurrently, each
+ * bounded by its own timeout. A failing check marks the server not ready,
+ * unless it was registered with RegisterOptional, then it's only degraded.
+ */
+
+// Check reports why a component is unhealthy, or nil. It should give up
+// once ctx is done.
+type Check func(ctx context.Context) error
+
+// Status of a check or of the server
+type Status string
+
+const (
+	StatusOK       Status = "ok"
+	StatusDegraded Status = "degraded" // Optional checks are failing
+	StatusFailing  Status = "failing"
+)
+
+// Result is the outcome of one check
+type Result struct {
+	Name      string  `json:"name"`
+	Status    Status  `json:"status"`
+	Optional  bool    `json:"optional,omitempty"`
+	LatencyMS float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// Report is the outcome of every check, in the order they were registered
+type Report struct {
+	Status Status   `json:"status"`
+	Checks []Result `json:"checks"`
+}
+
+// Ready reports whether no required check failed
+func (r Report) Ready() bool {
+	return r.Status != StatusFailing
+}
+
+type check struct {
+	name     string
+	timeout  time.Duration
+	optional bool
+	fn       Check
+}
+
+// Registry holds the checks of the server. It's safe for concurrent use.
+type Registry struct {
+	mu     sync.RWMutex
+	checks []check
+}
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// Register adds a check the server can't be ready without
+func (r *Registry) Register(name string, timeout time.Duration, fn Check) {
+	r.add(check{name: name, timeout: timeout, fn: fn})
+}
+
+// RegisterOptional adds a check the server works without, like one for an
+// external service only some widgets use
+func (r *Registry) RegisterOptional(name string, timeout time.Duration, fn Check) {
+	r.add(check{name: name, timeout: timeout, optional: true, fn: fn})
+}
+
+func (r *Registry) add(c check) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.checks = append(r.checks, c)
+}
+
+// Run runs every check concurrently and reports their results
+func (r *Registry) Run(ctx context.Context) Report {
+	r.mu.RLock()
+	checks := append([]check(nil), r.checks...)
+	r.mu.RUnlock()
+
+	report := Report{Status: StatusOK, Checks: make([]Result, len(checks))}
+	var wg sync.WaitGroup
+	for i, c := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			report.Checks[i] = run(ctx, c)
+		}()
+	}
+	wg.Wait()
+
+	for _, result := range report.Checks {
+		switch {
+		case result.Status == StatusOK:
+		case !result.Optional:
+			report.Status = StatusFailing
+		case report.Status == StatusOK:
+			report.Status = StatusDegraded
+		}
+	}
+	return report
+}
+
+// run runs one check, giving up on it after its timeout even if it doesn't
+func run(ctx context.Context, c check) Result {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				done <- fmt.Errorf("panicked: %v", r)
+			}
+		}()
+		done <- c.fn(ctx)
+	}()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = fmt.Errorf("no answer within %s", c.timeout)
+	}
+
+	result := Result{
+		Name:      c.name,
+		Status:    StatusOK,
+		Optional:  c.optional,
+		LatencyMS: float64(time.Since(start).Microseconds()) / 1000,
+	}
+	if err != nil {
+		result.Status, result.Error = StatusFailing, err.Error()
+	}
+	return result
+}
@@ -0,0 +1,91 @@
+package logging
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+)
+
+/*
+ * Package for the logs of the server, built on log/slog
+ *
+ * New returns a logger writing text or JSON to stdout, a file rotated by
+ * size and age (see File), or both. Made the default with slog.SetDefault,
+ * it also receives what the standard log package prints.
+ */
+
+// Formats of log lines
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// Config is where and how much is logged
+type Config struct {
+	Level  string // debug, info, warn or error
+	Format string // FormatText or FormatJSON
+	Stdout bool
+
+	// File is the path of the log file, empty for none. It's rotated after
+	// MaxSize bytes or MaxAge, whichever comes first, keeping MaxBackups
+	// rotated files, none for 0.
+	File       string
+	MaxSize    int64
+	MaxAge     time.Duration
+	MaxBackups int
+}
+
+// ParseLevel parses the name of a level, case insensitive
+func ParseLevel(name string) (slog.Level, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(name)); err != nil {
+		return 0, fmt.Errorf("%q must be debug, info, warn or error", name)
+	}
+	return level, nil
+}
+
+// New returns a logger for cfg, and the file it writes to for closing
+func New(cfg Config) (*slog.Logger, io.Closer, error) {
+	level, err := ParseLevel(cfg.Level)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var writers []io.Writer
+	var closer io.Closer = nopCloser{}
+	if cfg.Stdout {
+		writers = append(writers, os.Stdout)
+	}
+	if cfg.File != "" {
+		file, err := OpenFile(cfg.File, cfg.MaxSize, cfg.MaxAge, cfg.MaxBackups)
+		if err != nil {
+			return nil, nil, err
+		}
+		writers, closer = append(writers, file), file
+	}
+	if len(writers) == 0 {
+		return nil, nil, errors.New("logging: neither stdout nor a file to log to")
+	}
+
+	options := &slog.HandlerOptions{Level: level}
+	w := io.MultiWriter(writers...)
+	var handler slog.Handler
+	switch strings.ToLower(cfg.Format) {
+	case FormatText:
+		handler = slog.NewTextHandler(w, options)
+	case FormatJSON:
+		handler = slog.NewJSONHandler(w, options)
+	default:
+		closer.Close()
+		return nil, nil, fmt.Errorf("logging: format %q must be %q or %q", cfg.Format, FormatText, FormatJSON)
+	}
+	return slog.New(handler), closer, nil
+}
+
+type nopCloser struct{}
+
+func (nopCloser) Close() error { return nil }
@@ -0,0 +1,155 @@
+package logging
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// backupTime formats the time a backup was rotated in its name, sorting
+// like the times do
+const backupTime = "2006-01-02T15-04-05.000"
+
+// File is a log file that's rotated once it grows past a size or gets too
+// old: wasmdash.log is renamed to wasmdash-2006-01-02T15-04-05.000.log and
+// a new one is started. Only the newest backups are kept, maxBackups of them.
+type File struct {
+	path       string
+	maxSize    int64
+	maxAge     time.Duration
+	maxBackups int
+
+	mu      sync.Mutex
+	file    *os.File
+	size    int64
+	started time.Time
+}
+
+// OpenFile opens the log file at path for appending, creating it if needed.
+// maxSize or maxAge 0 never rotates by size or age, maxBackups 0 keeps no
+// backups.
+func OpenFile(path string, maxSize int64, maxAge time.Duration, maxBackups int) (*File, error) {
+	f := &File{path: path, maxSize: maxSize, maxAge: maxAge, maxBackups: maxBackups}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// open opens the file, f.mu must be held unless f isn't shared yet
+func (f *File) open() error {
+	file, err := os.OpenFile(f.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o640)
+	if err != nil {
+		return fmt.Errorf("logging: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("logging: %w", err)
+	}
+	f.file, f.size, f.started = file, info.Size(), time.Now()
+	return nil
+}
+
+// Write appends p, rotating the file first if p would make it too large or
+// it's too old
+func (f *File) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		return 0, os.ErrClosed
+	}
+	tooLarge := f.maxSize > 0 && f.size > 0 && f.size+int64(len(p)) > f.maxSize
+	tooOld := f.maxAge > 0 && time.Since(f.started) > f.maxAge
+	if tooLarge || tooOld {
+		if err := f.rotate(); err != nil {
+			// Keep logging to the file we have rather than losing lines
+			fmt.Fprintf(os.Stderr, "logging: rotating %s: %v\n", f.path, err)
+		}
+	}
+
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// rotate renames the file to a backup and opens a new one, f.mu must be held
+func (f *File) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+	ext := filepath.Ext(f.path)
+	backup := strings.TrimSuffix(f.path, ext) + "-" + time.Now().Format(backupTime) + ext
+	renameErr := os.Rename(f.path, backup)
+
+	// Reopen even if renaming failed, appending to the old file
+	if err := f.open(); err != nil {
+		f.file = nil
+		return err
+	}
+	if renameErr != nil {
+		return renameErr
+	}
+	return f.prune()
+}
+
+// prune removes all but the newest maxBackups backups, none for 0. Only
+// files named like rotate names them count, others like wasmdash-old.log
+// are left alone.
+func (f *File) prune() error {
+	dir := filepath.Dir(f.path)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	var backups []string
+	for _, entry := range entries {
+		if entry.Type().IsRegular() && f.isBackup(entry.Name()) {
+			backups = append(backups, entry.Name())
+		}
+	}
+	// The names sort by the time they were rotated
+	slices.Sort(backups)
+	for len(backups) > f.maxBackups {
+		if err := os.Remove(filepath.Join(dir, backups[0])); err != nil {
+			return err
+		}
+		backups = backups[1:]
+	}
+	return nil
+}
+
+// isBackup reports whether name is the name of a backup of the file, like
+// wasmdash-2006-01-02T15-04-05.000.log for wasmdash.log
+func (f *File) isBackup(name string) bool {
+	base := filepath.Base(f.path)
+	ext := filepath.Ext(base)
+	rotated, ok := strings.CutPrefix(name, strings.TrimSuffix(base, ext)+"-")
+	if !ok {
+		return false
+	}
+	rotated, ok = strings.CutSuffix(rotated, ext)
+	if !ok || len(rotated) != len(backupTime) {
+		return false
+	}
+	_, err := time.Parse(backupTime, rotated)
+	return err == nil
+}
+
+// Close closes the file, later writes fail
+func (f *File) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
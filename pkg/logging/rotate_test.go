@@ -0,0 +1,123 @@
+package logging
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// unrelated are files next to the log that aren't its backups
+var unrelated = []string{
+	"wasmdash-old.log",
+	"wasmdash-2026.log",
+	"wasmdash-2026-10-18T10-02-11.412.log.gz",
+	"wasmdash-2026-10-18T10-02-11.412.txt",
+	"other-2026-10-18T10-02-11.412.log",
+	"wasmdash-2026-13-18T10-02-11.412.log",
+}
+
+// list returns the names in dir, backups and others
+func list(t *testing.T, dir string) (backups, others []string) {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		switch {
+		case name == "wasmdash.log":
+		case slices.Contains(unrelated, name):
+			others = append(others, name)
+		default:
+			backups = append(backups, name)
+		}
+	}
+	return backups, others
+}
+
+func TestFileRotate(t *testing.T) {
+	for _, maxBackups := range []int{0, 1, 2} {
+		t.Run("keep "+strconv.Itoa(maxBackups), func(t *testing.T) {
+			dir := t.TempDir()
+			for _, name := range unrelated {
+				if err := os.WriteFile(filepath.Join(dir, name), []byte("keep\n"), 0o640); err != nil {
+					t.Fatal(err)
+				}
+			}
+			path := filepath.Join(dir, "wasmdash.log")
+			f, err := OpenFile(path, 10, 0, maxBackups)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+
+			lines := []string{"first\n", "second\n", "third\n", "fourth\n"}
+			for _, line := range lines {
+				if _, err := f.Write([]byte(line)); err != nil {
+					t.Fatal(err)
+				}
+				// Backups are named to the millisecond
+				time.Sleep(2 * time.Millisecond)
+			}
+
+			backups, others := list(t, dir)
+			if len(others) != len(unrelated) {
+				t.Errorf("other files left: %q, want %q", others, unrelated)
+			}
+			if len(backups) != maxBackups {
+				t.Fatalf("backups %q, want %d", backups, maxBackups)
+			}
+			// The newest are kept, one line each
+			for i, name := range backups {
+				if !f.isBackup(name) {
+					t.Errorf("%s isn't named like a backup", name)
+				}
+				data, _ := os.ReadFile(filepath.Join(dir, name))
+				if want := lines[len(lines)-1-maxBackups+i]; string(data) != want {
+					t.Errorf("%s = %q, want %q", name, data, want)
+				}
+			}
+			if data, _ := os.ReadFile(path); string(data) != "fourth\n" {
+				t.Errorf("log file = %q, want the last line", data)
+			}
+		})
+	}
+}
+
+func TestFileRotateAge(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "wasmdash.log")
+	f, err := OpenFile(path, 0, time.Hour, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	f.Write([]byte("old\n"))
+	f.Write([]byte("still young\n"))
+	if backups, _ := list(t, dir); len(backups) != 0 {
+		t.Fatalf("rotated a young file: %q", backups)
+	}
+	f.started = f.started.Add(-2 * time.Hour)
+	f.Write([]byte("new\n"))
+
+	backups, _ := list(t, dir)
+	if len(backups) != 1 {
+		t.Fatalf("backups %q, want 1", backups)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, backups[0])); string(data) != "old\nstill young\n" {
+		t.Errorf("backup = %q", data)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "new\n" {
+		t.Errorf("log file = %q", data)
+	}
+
+	f.Close()
+	if _, err := f.Write([]byte("closed\n")); err == nil {
+		t.Error("wrote to a closed file")
+	}
+}
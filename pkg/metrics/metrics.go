@@ -0,0 +1,287 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+/*
+ * Package for the metrics of the server, exposed at /metrics in the
+ * Prometheus text format
+ *
+ * Packages declare what they measure once, usually as package variables:
+ *
+ *   var fetches = metrics.NewCounter("wasmdash_widget_fetches_total", "Widget fetches.", "type")
+ *
+ *   fetches.Inc(kind)
+ *
+ * Label values are passed in the order the labels were declared. Keep them
+ * to a small set, like route patterns rather than paths: every combination
+ * is a series kept until the server stops.
+ */
+
+// Registry holds metrics by name. It's safe for concurrent use.
+type Registry struct {
+	mu         sync.Mutex
+	collectors map[string]collector
+}
+
+// collector writes one or more metric families in the text format
+type collector interface {
+	write(w *bufio.Writer)
+}
+
+func NewRegistry() *Registry {
+	return &Registry{collectors: make(map[string]collector)}
+}
+
+// Default is the registry the package functions register with, served at
+// /metrics. It includes the Go runtime metrics.
+var Default = NewRegistry()
+
+func init() {
+	Default.register("go", runtimeCollector{})
+}
+
+// register adds c under name, replacing what was registered under it before
+func (r *Registry) register(name string, c collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.collectors[name] = c
+}
+
+// WriteText writes every metric in the Prometheus text format, by name
+func (r *Registry) WriteText(w io.Writer) error {
+	r.mu.Lock()
+	names := make([]string, 0, len(r.collectors))
+	for name := range r.collectors {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	collectors := make([]collector, len(names))
+	for i, name := range names {
+		collectors[i] = r.collectors[name]
+	}
+	r.mu.Unlock()
+
+	bw := bufio.NewWriter(w)
+	for _, c := range collectors {
+		c.write(bw)
+	}
+	return bw.Flush()
+}
+
+// ContentType is the media type of WriteText
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// family is a metric with one series per combination of label values
+type family struct {
+	name, help, typ string
+	labels          []string
+	buckets         []float64 // Upper bounds of a histogram
+
+	mu     sync.Mutex
+	series map[string]*series
+}
+
+type series struct {
+	values []string
+	value  float64  // Counter or gauge
+	counts []uint64 // Observations per bucket of a histogram, not cumulative
+	sum    float64
+	count  uint64
+}
+
+func newFamily(name, help, typ string, buckets []float64, labels []string) *family {
+	return &family{name: name, help: help, typ: typ, labels: labels, buckets: buckets, series: make(map[string]*series)}
+}
+
+// get returns the series of values, f.mu must be held
+func (f *family) get(values []string) *series {
+	if len(values) != len(f.labels) {
+		panic(fmt.Sprintf("metrics: %s takes %d label values, got %d", f.name, len(f.labels), len(values)))
+	}
+	key := strings.Join(values, "\xff")
+	s, ok := f.series[key]
+	if !ok {
+		s = &series{values: slices.Clone(values)}
+		if f.buckets != nil {
+			s.counts = make([]uint64, len(f.buckets))
+		}
+		f.series[key] = s
+	}
+	return s
+}
+
+func (f *family) write(w *bufio.Writer) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	writeHeader(w, f.name, f.help, f.typ)
+	keys := make([]string, 0, len(f.series))
+	for key := range f.series {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	for _, key := range keys {
+		s := f.series[key]
+		if f.buckets == nil {
+			writeSample(w, f.name, f.labels, s.values, "", "", s.value)
+			continue
+		}
+		var cumulative uint64
+		for i, bound := range f.buckets {
+			cumulative += s.counts[i]
+			writeSample(w, f.name+"_bucket", f.labels, s.values, "le", formatFloat(bound), float64(cumulative))
+		}
+		writeSample(w, f.name+"_bucket", f.labels, s.values, "le", "+Inf", float64(s.count))
+		writeSample(w, f.name+"_sum", f.labels, s.values, "", "", s.sum)
+		writeSample(w, f.name+"_count", f.labels, s.values, "", "", float64(s.count))
+	}
+}
+
+// Counter is a value that only goes up, like the number of requests
+type Counter struct{ f *family }
+
+// NewCounter registers a counter with Default
+func NewCounter(name, help string, labels ...string) *Counter {
+	return Default.NewCounter(name, help, labels...)
+}
+
+func (r *Registry) NewCounter(name, help string, labels ...string) *Counter {
+	f := newFamily(name, help, "counter", nil, labels)
+	r.register(name, f)
+	return &Counter{f}
+}
+
+// Inc adds one to the series of the label values
+func (c *Counter) Inc(values ...string) {
+	c.Add(1, values...)
+}
+
+// Add adds v, which must not be negative, to the series of the label values
+func (c *Counter) Add(v float64, values ...string) {
+	c.f.mu.Lock()
+	defer c.f.mu.Unlock()
+	c.f.get(values).value += v
+}
+
+// Gauge is a value that goes up and down
+type Gauge struct{ f *family }
+
+// NewGauge registers a gauge with Default
+func NewGauge(name, help string, labels ...string) *Gauge {
+	return Default.NewGauge(name, help, labels...)
+}
+
+func (r *Registry) NewGauge(name, help string, labels ...string) *Gauge {
+	f := newFamily(name, help, "gauge", nil, labels)
+	r.register(name, f)
+	return &Gauge{f}
+}
+
+// Set sets the series of the label values to v
+func (g *Gauge) Set(v float64, values ...string) {
+	g.f.mu.Lock()
+	defer g.f.mu.Unlock()
+	g.f.get(values).value = v
+}
+
+// Histogram counts observations, like latencies, in buckets
+type Histogram struct{ f *family }
+
+// DurationBuckets are upper bounds in seconds for request and fetch latencies
+var DurationBuckets = []float64{0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// NewHistogram registers a histogram with Default. The buckets are upper
+// bounds in increasing order, without +Inf.
+func NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	return Default.NewHistogram(name, help, buckets, labels...)
+}
+
+func (r *Registry) NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	f := newFamily(name, help, "histogram", slices.Clone(buckets), labels)
+	r.register(name, f)
+	return &Histogram{f}
+}
+
+// Observe adds v to the series of the label values
+func (h *Histogram) Observe(v float64, values ...string) {
+	h.f.mu.Lock()
+	defer h.f.mu.Unlock()
+	s := h.f.get(values)
+	if i, _ := slices.BinarySearch(h.f.buckets, v); i < len(h.f.buckets) {
+		s.counts[i]++
+	}
+	s.sum += v
+	s.count++
+}
+
+// gaugeFunc is a gauge read when the metrics are written
+type gaugeFunc struct {
+	name, help string
+	fn         func() float64
+}
+
+// NewGaugeFunc registers a gauge reading fn with Default, replacing one
+// registered under name before
+func NewGaugeFunc(name, help string, fn func() float64) {
+	Default.NewGaugeFunc(name, help, fn)
+}
+
+func (r *Registry) NewGaugeFunc(name, help string, fn func() float64) {
+	r.register(name, gaugeFunc{name: name, help: help, fn: fn})
+}
+
+func (g gaugeFunc) write(w *bufio.Writer) {
+	writeHeader(w, g.name, g.help, "gauge")
+	writeSample(w, g.name, nil, nil, "", "", g.fn())
+}
+
+func writeHeader(w *bufio.Writer, name, help, typ string) {
+	help = strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(help)
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+// writeSample writes a line of a series, extraLabel is the le of a bucket
+func writeSample(w *bufio.Writer, name string, labels, values []string, extraLabel, extraValue string, v float64) {
+	w.WriteString(name)
+	if len(labels) > 0 || extraLabel != "" {
+		escape := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+		w.WriteByte('{')
+		for i, label := range labels {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			fmt.Fprintf(w, `%s="%s"`, label, escape.Replace(values[i]))
+		}
+		if extraLabel != "" {
+			if len(labels) > 0 {
+				w.WriteByte(',')
+			}
+			fmt.Fprintf(w, `%s="%s"`, extraLabel, extraValue)
+		}
+		w.WriteByte('}')
+	}
+	w.WriteByte(' ')
+	w.WriteString(formatFloat(v))
+	w.WriteByte('\n')
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,40 @@
+package metrics
+
+import (
+	"bufio"
+	"runtime"
+	"time"
+)
+
+// started is when the process started, near enough
+var started = time.Now()
+
+// runtimeCollector writes the Go runtime metrics under their usual names,
+// reading the memory statistics once per scrape
+type runtimeCollector struct{}
+
+func (runtimeCollector) write(w *bufio.Writer) {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	for _, m := range []struct {
+		name, help, typ string
+		value           float64
+	}{
+		{"go_goroutines", "Number of goroutines that currently exist.", "gauge", float64(runtime.NumGoroutine())},
+		{"go_gc_cycles_total", "Number of completed GC cycles.", "counter", float64(mem.NumGC)},
+		{"go_gc_pause_seconds_total", "Total time the world was stopped for GC.", "counter", float64(mem.PauseTotalNs) / 1e9},
+		{"go_memstats_heap_alloc_bytes", "Bytes of allocated heap objects.", "gauge", float64(mem.HeapAlloc)},
+		{"go_memstats_heap_inuse_bytes", "Bytes in in-use heap spans.", "gauge", float64(mem.HeapInuse)},
+		{"go_memstats_heap_objects", "Number of allocated heap objects.", "gauge", float64(mem.HeapObjects)},
+		{"go_memstats_mallocs_total", "Total number of heap objects allocated.", "counter", float64(mem.Mallocs)},
+		{"go_memstats_sys_bytes", "Bytes of memory obtained from the OS.", "gauge", float64(mem.Sys)},
+		{"process_start_time_seconds", "Start time of the process since the Unix epoch in seconds.", "gauge", float64(started.UnixNano()) / 1e9},
+	} {
+		writeHeader(w, m.name, m.help, m.typ)
+		writeSample(w, m.name, nil, nil, "", "", m.value)
+	}
+
+	writeHeader(w, "go_info", "Version of Go the server was built with.", "gauge")
+	writeSample(w, "go_info", []string{"version"}, []string{runtime.Version()}, "", "", 1)
+}
@@ -0,0 +1,113 @@
+package secrets
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"filippo.io/age"
+)
+
+/*
+ * Encryption of a Vault, with age (https://age-encryption.org)
+ *
+ * The secrets file is an armored age file, readable with the age CLI:
+ *
+ *   age -d -i key.txt secrets.age
+ *
+ * X25519: the file is encrypted to the recipient of an identity from
+ * `wasmdash secret keygen`, an AGE-SECRET-KEY-1... like age-keygen prints.
+ *
+ * Passphrase: the file is encrypted with age's scrypt recipient. The work
+ * factor is read from the file, files asking for more than scryptWorkFactor
+ * are rejected before deriving anything, so a crafted file can't make the
+ * server spend gigabytes or minutes unlocking it.
+ *
+ * Names and values are both encrypted, so they're bound to each other and
+ * any change to the file fails authentication.
+ */
+
+// Key opens a Vault, see ParseIdentity and Passphrase
+type Key interface {
+	// recipient encrypts the file
+	recipient() (age.Recipient, error)
+
+	// identity decrypts the file
+	identity() (age.Identity, error)
+}
+
+// ErrWrongKey is returned when the key doesn't open the secrets file
+var ErrWrongKey = errors.New("secrets: the key doesn't open this secrets file")
+
+// identityPrefix starts the identities of GenerateIdentity
+const identityPrefix = "AGE-SECRET-KEY-1"
+
+type identity struct {
+	id *age.X25519Identity
+}
+
+// GenerateIdentity returns a new X25519 identity for [secrets] identity,
+// and the recipient it encrypts to
+func GenerateIdentity() (id, recipient string, err error) {
+	i, err := age.GenerateX25519Identity()
+	if err != nil {
+		return "", "", err
+	}
+	return i.String(), i.Recipient().String(), nil
+}
+
+// ParseIdentity returns the Key for an identity from GenerateIdentity
+func ParseIdentity(s string) (Key, error) {
+	if !strings.HasPrefix(s, identityPrefix) {
+		return nil, fmt.Errorf("must start with %q, generate one with `wasmdash secret keygen`", identityPrefix)
+	}
+	id, err := age.ParseX25519Identity(s)
+	if err != nil {
+		return nil, fmt.Errorf("identity: %w", err)
+	}
+	return identity{id: id}, nil
+}
+
+func (i identity) recipient() (age.Recipient, error) {
+	return i.id.Recipient(), nil
+}
+
+func (i identity) identity() (age.Identity, error) {
+	return i.id, nil
+}
+
+// MinPassphraseLength is the shortest passphrase accepted
+const MinPassphraseLength = 12
+
+// scryptWorkFactor is the log2 of the scrypt cost files are encrypted
+// with, and the most a file may ask for: 2^18 takes 256 MiB and about a
+// second
+const scryptWorkFactor = 18
+
+type passphrase string
+
+// Passphrase returns the Key for a passphrase-encrypted file
+func Passphrase(p string) Key {
+	return passphrase(p)
+}
+
+func (p passphrase) recipient() (age.Recipient, error) {
+	if len(p) < MinPassphraseLength {
+		return nil, fmt.Errorf("secrets: the passphrase must be at least %d characters", MinPassphraseLength)
+	}
+	r, err := age.NewScryptRecipient(string(p))
+	if err != nil {
+		return nil, err
+	}
+	r.SetWorkFactor(scryptWorkFactor)
+	return r, nil
+}
+
+func (p passphrase) identity() (age.Identity, error) {
+	i, err := age.NewScryptIdentity(string(p))
+	if err != nil {
+		return nil, err
+	}
+	i.SetMaxWorkFactor(scryptWorkFactor)
+	return i, nil
+}
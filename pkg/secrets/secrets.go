@@ -0,0 +1,249 @@
+package secrets
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+)
+
+/*
+ * Package for secrets used by widgets, like the credentials of an API
+ *
+ * Secrets are kept in a Vault, an age file encrypted at rest to an X25519
+ * identity or with a passphrase, see key.go.
+ * Widget settings never hold them in plaintext, they reference them as
+ * ${secret:name}. Settings of type Secret are resolved from the default vault
+ * when they're decoded, from widget.toml or the JSON kept in storage.
+ *
+ * A resolved Secret formats, encodes and logs as "[redacted]". Only Reveal
+ * returns the value, to hand it to whatever needs it, never to a template,
+ * a log or an API response.
+ */
+
+// redacted is what a Secret shows instead of its value
+const redacted = "[redacted]"
+
+var (
+	// ErrNotFound is returned for a secret that isn't in the vault
+	ErrNotFound = errors.New("secrets: not found")
+
+	// ErrNoVault is returned when resolving without a vault configured
+	ErrNoVault = errors.New("secrets: no secrets file configured, see [secrets] path")
+)
+
+// Secret is a resolved secret value. It's held behind a pointer so even
+// fmt printing a struct with a Secret in an unexported field, where it
+// can't call Format, only shows an address.
+type Secret struct {
+	value *string
+	ref   Ref // As written in the settings it was decoded from
+}
+
+func newSecret(value string) Secret {
+	return Secret{value: &value}
+}
+
+// Reveal returns the value of the secret
+func (s Secret) Reveal() string {
+	if s.value == nil {
+		return ""
+	}
+	return *s.value
+}
+
+// IsZero reports whether the secret is empty
+func (s Secret) IsZero() bool {
+	return s.Reveal() == ""
+}
+
+func (s Secret) String() string {
+	return redacted
+}
+
+func (s Secret) GoString() string {
+	return redacted
+}
+
+// Format keeps every fmt verb, %x and %q included, from printing the value
+func (s Secret) Format(f fmt.State, verb rune) {
+	f.Write([]byte(redacted))
+}
+
+func (s Secret) MarshalText() ([]byte, error) {
+	return []byte(redacted), nil
+}
+
+func (s Secret) MarshalJSON() ([]byte, error) {
+	return []byte(`"` + redacted + `"`), nil
+}
+
+func (s Secret) LogValue() slog.Value {
+	return slog.StringValue(redacted)
+}
+
+// UnmarshalText resolves a setting referencing secrets, like
+// "Bearer ${secret:token}", from the default vault. A value without a
+// reference is rejected, settings can't hold secrets in plaintext.
+func (s *Secret) UnmarshalText(text []byte) error {
+	r := Ref(text)
+	if len(r.Names()) == 0 {
+		return errors.New("must reference a secret as ${secret:name}, add it with `wasmdash secret set`")
+	}
+	if err := r.Validate(); err != nil {
+		return err
+	}
+	resolved, err := r.Resolve()
+	if err != nil {
+		return err
+	}
+	resolved.ref = r
+	*s = resolved
+	return nil
+}
+
+// namePattern matches valid secret names
+var namePattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._-]{0,63}$`)
+
+// ValidName reports why name can't be used for a secret, or nil
+func ValidName(name string) error {
+	if !namePattern.MatchString(name) {
+		return fmt.Errorf("%q must be 1-64 letters, digits, '.', '_' or '-', starting with a letter or digit", name)
+	}
+	return nil
+}
+
+// refPattern matches ${secret:name}, and malformed references for Validate
+var refPattern = regexp.MustCompile(`\$\{secret:([^}]*)\}`)
+
+// Ref is a setting that may reference secrets as ${secret:name}, alone or
+// within a longer value like "Bearer ${secret:token}". It's stored, encoded
+// and shown as written, so only the references ever leave the vault.
+type Ref string
+
+// Names returns the names of the secrets r references
+func (r Ref) Names() []string {
+	var names []string
+	for _, m := range refPattern.FindAllStringSubmatch(string(r), -1) {
+		names = append(names, m[1])
+	}
+	return names
+}
+
+// IsReference reports whether r is a single reference and nothing else
+func (r Ref) IsReference() bool {
+	m := refPattern.FindStringSubmatchIndex(string(r))
+	return m != nil && m[0] == 0 && m[1] == len(r)
+}
+
+// Validate checks that every reference in r names a valid secret
+func (r Ref) Validate() error {
+	for _, name := range r.Names() {
+		if err := ValidName(name); err != nil {
+			return fmt.Errorf("secret name %w", err)
+		}
+	}
+	return nil
+}
+
+// Resolve returns r with its references replaced by the secrets from the
+// default vault, see SetDefault
+func (r Ref) Resolve() (Secret, error) {
+	var b strings.Builder
+	last := 0
+	for _, m := range refPattern.FindAllStringSubmatchIndex(string(r), -1) {
+		secret, err := Lookup(string(r[m[2]:m[3]]))
+		if err != nil {
+			return Secret{}, err
+		}
+		b.WriteString(string(r[last:m[0]]))
+		b.WriteString(secret.Reveal())
+		last = m[1]
+	}
+	b.WriteString(string(r[last:]))
+	return newSecret(b.String()), nil
+}
+
+// PasswordAuth is a username and a password kept in the vault, for widgets
+// signing in to a service. The password is resolved when it's decoded.
+type PasswordAuth struct {
+	Username string `toml:"username" json:"username"`
+	Password Secret `toml:"password" json:"password"` // Must be a ${secret:name}
+}
+
+// Validate requires both to be set and the password to be a single
+// reference. field prefixes the names in errors, like "spond.auth".
+func (a PasswordAuth) Validate(field string) error {
+	if a.Username == "" {
+		return fmt.Errorf("%s.username: must be set", field)
+	}
+	if !a.Password.ref.IsReference() {
+		return fmt.Errorf("%s.password: must be a ${secret:name} reference, add the password with `wasmdash secret set`", field)
+	}
+	return nil
+}
+
+var (
+	defaultMu    sync.RWMutex
+	defaultVault *Vault
+)
+
+// SetDefault makes v the vault Lookup, Ref.Resolve and decoding a Secret
+// read from
+func SetDefault(v *Vault) {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	defaultVault = v
+}
+
+// Lookup returns a secret from the default vault
+func Lookup(name string) (Secret, error) {
+	defaultMu.RLock()
+	v := defaultVault
+	defaultMu.RUnlock()
+
+	if v == nil {
+		return Secret{}, ErrNoVault
+	}
+	return v.Get(name)
+}
+
+// Has reports whether the default vault has a secret, without revealing it
+func Has(name string) (bool, error) {
+	defaultMu.RLock()
+	v := defaultVault
+	defaultMu.RUnlock()
+
+	if v == nil {
+		return false, ErrNoVault
+	}
+	names, err := v.Names()
+	return slices.Contains(names, name), err
+}
+
+// References returns the names of the secrets referenced anywhere in v,
+// which may be a string or nested maps and slices as decoded from TOML or
+// JSON, like widget settings
+func References(v any) []string {
+	var names []string
+	switch v := v.(type) {
+	case string:
+		names = Ref(v).Names()
+	case map[string]any:
+		for _, item := range v {
+			names = append(names, References(item)...)
+		}
+	case []any:
+		for _, item := range v {
+			names = append(names, References(item)...)
+		}
+	case []map[string]any:
+		for _, item := range v {
+			names = append(names, References(item)...)
+		}
+	}
+	return names
+}
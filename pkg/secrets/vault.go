@@ -0,0 +1,234 @@
+package secrets
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+)
+
+// fileVersion is the format of the payload written by this build
+const fileVersion = 1
+
+// file is the JSON encrypted in a secrets file
+type file struct {
+	Version int              `json:"version"`
+	Secrets map[string]entry `json:"secrets"`
+}
+
+type entry struct {
+	Value     string    `json:"value"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Vault is a file of named secrets, encrypted at rest with age, see key.go.
+// Changes made by another process, like `wasmdash secret` while the server
+// runs, are picked up on the next read.
+type Vault struct {
+	path string
+	key  Key
+
+	mu      sync.Mutex
+	file    file
+	modTime time.Time
+}
+
+// Open opens the secrets file at path with key, creating it if it doesn't
+// exist. The file is only readable by its owner.
+func Open(path string, key Key) (*Vault, error) {
+	v := &Vault{path: path, key: key}
+	if err := v.load(); errors.Is(err, fs.ErrNotExist) {
+		v.file = file{Version: fileVersion, Secrets: make(map[string]entry)}
+		if err := v.save(); err != nil {
+			return nil, err
+		}
+	} else if err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// Path returns the path of the secrets file
+func (v *Vault) Path() string {
+	return v.path
+}
+
+// Names lists the names of the secrets, sorted
+func (v *Vault) Names() ([]string, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if err := v.reload(); err != nil {
+		return nil, err
+	}
+	return slices.Sorted(maps.Keys(v.file.Secrets)), nil
+}
+
+// Get returns a secret, or ErrNotFound
+func (v *Vault) Get(name string) (Secret, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if err := v.reload(); err != nil {
+		return Secret{}, err
+	}
+	e, ok := v.file.Secrets[name]
+	if !ok {
+		return Secret{}, fmt.Errorf("secret %q: %w", name, ErrNotFound)
+	}
+	return newSecret(e.Value), nil
+}
+
+// Set encrypts and stores a secret, replacing one with the same name
+func (v *Vault) Set(name, value string) error {
+	if err := ValidName(name); err != nil {
+		return fmt.Errorf("secret name %w", err)
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if err := v.reload(); err != nil {
+		return err
+	}
+	v.file.Secrets[name] = entry{Value: value, UpdatedAt: time.Now().UTC()}
+	return v.save()
+}
+
+// Delete removes a secret, or returns ErrNotFound
+func (v *Vault) Delete(name string) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if err := v.reload(); err != nil {
+		return err
+	}
+	if _, ok := v.file.Secrets[name]; !ok {
+		return fmt.Errorf("secret %q: %w", name, ErrNotFound)
+	}
+	delete(v.file.Secrets, name)
+	return v.save()
+}
+
+// reload reads the file again if it changed since it was read, v.mu must be held
+func (v *Vault) reload() error {
+	info, err := os.Stat(v.path)
+	if err != nil {
+		return fmt.Errorf("secrets: %w", err)
+	}
+	if info.ModTime().Equal(v.modTime) {
+		return nil
+	}
+	return v.load()
+}
+
+// load reads and decrypts the file
+func (v *Vault) load() error {
+	info, err := os.Stat(v.path)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(v.path)
+	if err != nil {
+		return err
+	}
+
+	id, err := v.key.identity()
+	if err != nil {
+		return err
+	}
+	r, err := age.Decrypt(armor.NewReader(bytes.NewReader(data)), id)
+	var noMatch *age.NoIdentityMatchError
+	if errors.As(err, &noMatch) {
+		return fmt.Errorf("%s: %w", v.path, ErrWrongKey)
+	}
+	if err != nil {
+		return fmt.Errorf("secrets: %s can't be decrypted: %w", v.path, err)
+	}
+	plaintext, err := io.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("secrets: %s can't be decrypted, it was changed or is corrupt: %w", v.path, err)
+	}
+
+	var f file
+	if err := json.Unmarshal(plaintext, &f); err != nil {
+		return fmt.Errorf("secrets: %s is not a secrets file: %w", v.path, err)
+	}
+	if f.Version != fileVersion {
+		return fmt.Errorf("secrets: %s has version %d, this build reads version %d", v.path, f.Version, fileVersion)
+	}
+	if f.Secrets == nil {
+		f.Secrets = make(map[string]entry)
+	}
+
+	v.file, v.modTime = f, info.ModTime()
+	return nil
+}
+
+// save encrypts and replaces the file atomically, v.mu must be held
+func (v *Vault) save() error {
+	plaintext, err := json.Marshal(v.file)
+	if err != nil {
+		return err
+	}
+	recipient, err := v.key.recipient()
+	if err != nil {
+		return err
+	}
+	var data bytes.Buffer
+	aw := armor.NewWriter(&data)
+	w, err := age.Encrypt(aw, recipient)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(plaintext); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	if err := aw.Close(); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(v.path), "."+filepath.Base(v.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := tmp.Chmod(0o600); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(data.Bytes()); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), v.path); err != nil {
+		return err
+	}
+
+	if info, err := os.Stat(v.path); err == nil {
+		v.modTime = info.ModTime()
+	}
+	return nil
+}
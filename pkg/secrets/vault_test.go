@@ -0,0 +1,201 @@
+package secrets
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+
+	"filippo.io/age/armor"
+)
+
+// newIdentity returns the Key of a new X25519 identity
+func newIdentity(t *testing.T) Key {
+	t.Helper()
+	id, _, err := GenerateIdentity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := ParseIdentity(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestVaultRoundTrip(t *testing.T) {
+	keys := map[string]Key{
+		"identity":   newIdentity(t),
+		"passphrase": Passphrase("correct horse battery"),
+	}
+	for name, key := range keys {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "secrets.age")
+			v, err := Open(path, key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := v.Set("api-token", "t0k3n"); err != nil {
+				t.Fatal(err)
+			}
+			if err := v.Set("password", "hunter2"); err != nil {
+				t.Fatal(err)
+			}
+			if err := v.Delete("password"); err != nil {
+				t.Fatal(err)
+			}
+
+			// A second process opening the file sees the same secrets
+			reopened, err := Open(path, key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			secret, err := reopened.Get("api-token")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if secret.Reveal() != "t0k3n" {
+				t.Errorf("api-token = %q, want t0k3n", secret.Reveal())
+			}
+			if _, err := reopened.Get("password"); !errors.Is(err, ErrNotFound) {
+				t.Errorf("deleted secret: err = %v, want ErrNotFound", err)
+			}
+			if names, _ := reopened.Names(); len(names) != 1 || names[0] != "api-token" {
+				t.Errorf("names = %v, want [api-token]", names)
+			}
+
+			// Neither names nor values are readable in the file
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.HasPrefix(data, []byte("-----BEGIN AGE ENCRYPTED FILE-----")) {
+				t.Errorf("not an armored age file:\n%s", data)
+			}
+			for _, s := range []string{"api-token", "t0k3n", "hunter2"} {
+				if bytes.Contains(data, []byte(s)) {
+					t.Errorf("file shows %q", s)
+				}
+			}
+		})
+	}
+}
+
+func TestVaultWrongKey(t *testing.T) {
+	identityFile := filepath.Join(t.TempDir(), "identity.age")
+	if _, err := Open(identityFile, newIdentity(t)); err != nil {
+		t.Fatal(err)
+	}
+	passphraseFile := filepath.Join(t.TempDir(), "passphrase.age")
+	if _, err := Open(passphraseFile, Passphrase("correct horse battery")); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		path string
+		key  Key
+	}{
+		{"other identity", identityFile, newIdentity(t)},
+		{"passphrase for an identity", identityFile, Passphrase("correct horse battery")},
+		{"wrong passphrase", passphraseFile, Passphrase("incorrect horse battery")},
+		{"identity for a passphrase", passphraseFile, newIdentity(t)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Open(tt.path, tt.key); !errors.Is(err, ErrWrongKey) {
+				t.Errorf("err = %v, want ErrWrongKey", err)
+			}
+		})
+	}
+}
+
+func TestVaultTampered(t *testing.T) {
+	key := newIdentity(t)
+	path := filepath.Join(t.TempDir(), "secrets.age")
+	v, err := Open(path, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := v.Set("api-token", "t0k3n"); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(string(data), "\n")
+	for i := 1; i < len(lines)-2; i++ {
+		for _, at := range []int{0, len(lines[i]) / 2, len(lines[i]) - 1} {
+			tampered := slices.Clone(lines)
+			b := []byte(tampered[i])
+			if b[at] == 'A' {
+				b[at] = 'B'
+			} else {
+				b[at] = 'A'
+			}
+			tampered[i] = string(b)
+			if err := os.WriteFile(path, []byte(strings.Join(tampered, "\n")), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := Open(path, key); err == nil {
+				t.Errorf("line %d, byte %d changed: opened", i, at)
+			}
+		}
+	}
+}
+
+func TestVaultWorkFactor(t *testing.T) {
+	key := Passphrase("correct horse battery")
+	path := filepath.Join(t.TempDir(), "secrets.age")
+	if _, err := Open(path, key); err != nil {
+		t.Fatal(err)
+	}
+	armored, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(armor.NewReader(bytes.NewReader(armored)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	header := regexp.MustCompile(`(?m)^(-> scrypt \S+) 18$`)
+	if !header.Match(data) {
+		t.Fatalf("no scrypt stanza in\n%s", data)
+	}
+
+	// Ask for twice the work, and 256 times
+	for _, logN := range []string{"19", "26"} {
+		var crafted bytes.Buffer
+		w := armor.NewWriter(&crafted)
+		w.Write(header.ReplaceAll(data, []byte("${1} "+logN)))
+		w.Close()
+		if err := os.WriteFile(path, crafted.Bytes(), 0o600); err != nil {
+			t.Fatal(err)
+		}
+
+		_, err := Open(path, key)
+		if err == nil || !strings.Contains(err.Error(), "work factor too large") {
+			t.Errorf("work factor %s: err = %v, want it rejected", logN, err)
+		}
+	}
+}
+
+func TestVaultInvalidName(t *testing.T) {
+	v, err := Open(filepath.Join(t.TempDir(), "secrets.age"), newIdentity(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"", "-token", "a b", "a}b", strings.Repeat("a", 65)} {
+		if err := v.Set(name, "x"); err == nil {
+			t.Errorf("Set(%q) succeeded", name)
+		}
+	}
+}
@@ -1,26 +1,44 @@
 package server
 
-import "time"
+import (
+	"context"
+	"time"
 
-/*
- * Package for server authentication and authorization
- *
- * Implements JWT-based authentication and authorization
- */
-
-// Guest will be the default role for simplifying the development
-// of the RBAC system
-const (
-	RoleGuest = 0
-	RoleUser  = 1
-	RoleAdmin = 1000
+	"github.com/labstack/echo/v4"
+	"github.com/pynezz/wasmdash/pkg/auth"
+	"github.com/pynezz/wasmdash/pkg/server/handlers"
+	"github.com/pynezz/wasmdash/pkg/server/middleware"
+	"github.com/pynezz/wasmdash/pkg/storage"
 )
 
-// We don't bother with email
-type Account struct {
-	ID       string    `json:"id,omitempty,nonempty" toml:"id"`
-	UUID     string    `json:"uuid,omitempty" toml:"uuid"`
-	Password string    `json:"password,omitempty" toml:"password"`
-	Creation time.Time `json:"creation,omitempty" toml:"creation"`
-	Role     int       `json:"role,omitempty" xml:"role,omitempty" toml:"role"`
+// setupAuthRoutes configures signing in and out, see handlers/auth.go, and
+// the admin pages, which need someone signed in to be safe
+func (s *Server) setupAuthRoutes() {
+	a := handlers.NewAuth(s.store, s.sessions, s.cookie)
+
+	s.echo.GET("/login", a.LoginPage)
+	s.echo.POST("/login", a.Login, middleware.SameOrigin)
+	s.echo.POST("/logout", a.Logout, middleware.SameOrigin)
+
+	// Admin pages
+	admin := s.echo.Group("/admin", s.requireRole(auth.RoleAdmin)...)
+	t := handlers.NewTokens(s.store, s.config.TokenSigner)
+	admin.GET("/tokens", t.Page)
+	admin.POST("/tokens", t.Issue, middleware.SameOrigin)
+	admin.POST("/tokens/:id/revoke", t.Revoke, middleware.SameOrigin)
+}
+
+// checkToken resolves a signed API token, see storage.CheckToken
+func (s *Server) checkToken(ctx context.Context, token string) (auth.Account, error) {
+	account, _, err := storage.CheckToken(ctx, s.store, s.config.TokenSigner, token, time.Now())
+	return account, err
+}
+
+// requireRole returns the middleware letting only accounts with at least
+// role into a route or group, none if authentication is disabled
+func (s *Server) requireRole(role int) []echo.MiddlewareFunc {
+	if !s.config.AuthEnabled {
+		return nil
+	}
+	return []echo.MiddlewareFunc{middleware.RequireRole(role)}
 }
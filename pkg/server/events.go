@@ -0,0 +1,270 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/pynezz/wasmdash/pkg/auth"
+	"github.com/pynezz/wasmdash/pkg/server/middleware"
+)
+
+/*
+ * Server-sent events
+ *
+ * The Hub fans events out to every browser connected to /events. Publishing
+ * never blocks: a client that can't keep up is disconnected, and replays
+ * what it missed from a bounded history when EventSource reconnects with
+ * Last-Event-ID. Clients that missed more than the history holds, or that
+ * connected to a previous run of the server, get a "resync" event instead.
+ */
+
+var (
+	// HeartbeatInterval is how often an idle stream gets a comment,
+	// which keeps proxies from closing it
+	HeartbeatInterval = 15 * time.Second
+
+	// HistorySize is the number of events kept for replay
+	HistorySize = 256
+
+	// ClientBuffer is the number of events a client may fall behind
+	ClientBuffer = 32
+
+	// writeTimeout bounds a single write to a client
+	writeTimeout = 10 * time.Second
+)
+
+// Event is a server-sent event, Data is JSON
+type Event struct {
+	ID      string
+	Name    string
+	Data    []byte
+	MinRole int // Least role of the clients receiving it, see pkg/auth
+	MaxRole int // Highest role of the clients receiving it
+}
+
+// reaches reports whether a client with role receives the event
+func (e Event) reaches(role int) bool {
+	return e.MinRole <= role && role <= e.MaxRole
+}
+
+// Hub distributes events to the connected clients
+type Hub struct {
+	epoch string // Distinguishes event IDs from previous runs
+
+	mu      sync.Mutex
+	seq     uint64
+	history []Event            // Oldest first
+	clients map[chan Event]int // Role of each client
+	closed  bool
+}
+
+func NewHub() *Hub {
+	return &Hub{
+		epoch:   strconv.FormatInt(time.Now().UnixNano(), 36),
+		clients: make(map[chan Event]int),
+	}
+}
+
+// Publish sends data, encoded as JSON, to every client as event name
+func (h *Hub) Publish(name string, data any) error {
+	return h.PublishTo(auth.RoleGuest, name, data)
+}
+
+// PublishTo sends data like Publish, but only to clients with at least minRole
+func (h *Hub) PublishTo(minRole int, name string, data any) error {
+	return h.PublishRoles(minRole, math.MaxInt, name, data)
+}
+
+// PublishRoles sends data like Publish, but only to clients with a role
+// from minRole to maxRole
+func (h *Hub) PublishRoles(minRole, maxRole int, name string, data any) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("event %s: %w", name, err)
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closed {
+		return nil
+	}
+
+	h.seq++
+	event := Event{ID: h.epoch + "-" + strconv.FormatUint(h.seq, 10), Name: name, Data: payload, MinRole: minRole, MaxRole: maxRole}
+	if len(h.history) == HistorySize {
+		h.history = append(h.history[:0], h.history[1:]...)
+	}
+	h.history = append(h.history, event)
+
+	for client, role := range h.clients {
+		if !event.reaches(role) {
+			continue
+		}
+		select {
+		case client <- event:
+		default:
+			// Too slow, it'll catch up from the history after reconnecting
+			h.drop(client)
+		}
+	}
+	return nil
+}
+
+// Clients returns the number of connected clients
+func (h *Hub) Clients() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.clients)
+}
+
+// Close disconnects every client and stops accepting new ones
+func (h *Hub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.closed = true
+	for client := range h.clients {
+		h.drop(client)
+	}
+}
+
+// drop disconnects a client, h.mu must be held
+func (h *Hub) drop(client chan Event) {
+	delete(h.clients, client)
+	close(client)
+}
+
+// subscribe registers a client with role and returns the events it missed
+// since lastID. complete is false if they can't all be replayed.
+func (h *Hub) subscribe(lastID string, role int) (client chan Event, missed []Event, complete bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closed {
+		return nil, nil, false
+	}
+	client = make(chan Event, ClientBuffer)
+	h.clients[client] = role
+
+	if lastID == "" {
+		return client, nil, true
+	}
+	epoch, seqText, _ := strings.Cut(lastID, "-")
+	seq, err := strconv.ParseUint(seqText, 10, 64)
+	if err != nil || epoch != h.epoch || seq > h.seq {
+		return client, nil, false
+	}
+	// Anything between seq and the oldest event kept is lost
+	complete = seq == h.seq || (len(h.history) > 0 && eventSeq(h.history[0]) <= seq+1)
+	for _, event := range h.history {
+		if eventSeq(event) > seq && event.reaches(role) {
+			missed = append(missed, event)
+		}
+	}
+	return client, missed, complete
+}
+
+func (h *Hub) unsubscribe(client chan Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, ok := h.clients[client]; ok {
+		h.drop(client)
+	}
+}
+
+func eventSeq(event Event) uint64 {
+	_, seq, _ := strings.Cut(event.ID, "-")
+	n, _ := strconv.ParseUint(seq, 10, 64)
+	return n
+}
+
+// Handler streams events to a client until it disconnects, falls too far
+// behind, or the hub is closed. Clients only get events for their role.
+func (h *Hub) Handler(c echo.Context) error {
+	role, _ := middleware.Role(c)
+	client, missed, complete := h.subscribe(c.Request().Header.Get("Last-Event-ID"), role)
+	if client == nil {
+		return echo.NewHTTPError(http.StatusServiceUnavailable, "shutting down")
+	}
+	defer h.unsubscribe(client)
+
+	w := c.Response()
+	w.Header().Set(echo.HeaderContentType, "text/event-stream")
+	w.Header().Set(echo.HeaderCacheControl, "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no") // Don't let nginx buffer the stream
+	w.WriteHeader(http.StatusOK)
+
+	rc := http.NewResponseController(w)
+	send := func(chunk []byte) error {
+		if err := rc.SetWriteDeadline(time.Now().Add(writeTimeout)); err != nil && !errors.Is(err, http.ErrNotSupported) {
+			return err
+		}
+		if _, err := w.Write(chunk); err != nil {
+			return err
+		}
+		return rc.Flush()
+	}
+
+	// Reconnect quickly, the stream only ends on purpose
+	var start bytes.Buffer
+	start.WriteString("retry: 3000\n\n")
+	if !complete {
+		writeEvent(&start, Event{Name: "resync", Data: []byte("{}")})
+	}
+	for _, event := range missed {
+		writeEvent(&start, event)
+	}
+	if err := send(start.Bytes()); err != nil {
+		return nil
+	}
+
+	heartbeat := time.NewTicker(HeartbeatInterval)
+	defer heartbeat.Stop()
+
+	var buf bytes.Buffer
+	for {
+		buf.Reset()
+		select {
+		case <-c.Request().Context().Done():
+			return nil
+		case event, ok := <-client:
+			if !ok {
+				return nil
+			}
+			writeEvent(&buf, event)
+		case <-heartbeat.C:
+			buf.WriteString(": heartbeat\n\n")
+		}
+		if err := send(buf.Bytes()); err != nil {
+			return nil
+		}
+	}
+}
+
+// writeEvent encodes an event in the text/event-stream format
+func writeEvent(buf *bytes.Buffer, event Event) {
+	if event.ID != "" {
+		buf.WriteString("id: " + event.ID + "\n")
+	}
+	if event.Name != "" {
+		buf.WriteString("event: " + event.Name + "\n")
+	}
+	// JSON has no raw newlines, but keep the framing safe regardless
+	for _, line := range bytes.Split(event.Data, []byte("\n")) {
+		buf.WriteString("data: ")
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+	buf.WriteByte('\n')
+}
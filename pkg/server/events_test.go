@@ -0,0 +1,239 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/pynezz/wasmdash/pkg/auth"
+	"github.com/pynezz/wasmdash/pkg/storage"
+	"github.com/pynezz/wasmdash/pkg/ui/widgets"
+)
+
+// publish publishes n events named after their number, for clients with
+// at least minRole
+func publish(t *testing.T, h *Hub, minRole int, names ...string) {
+	t.Helper()
+	for _, name := range names {
+		if err := h.PublishTo(minRole, name, map[string]string{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// names returns the names of events
+func names(events []Event) []string {
+	var list []string
+	for _, e := range events {
+		list = append(list, e.Name)
+	}
+	return list
+}
+
+// withSizes sets HistorySize and ClientBuffer for a test
+func withSizes(t *testing.T, history, buffer int) {
+	oldHistory, oldBuffer := HistorySize, ClientBuffer
+	HistorySize, ClientBuffer = history, buffer
+	t.Cleanup(func() { HistorySize, ClientBuffer = oldHistory, oldBuffer })
+}
+
+func TestHubReplay(t *testing.T) {
+	withSizes(t, 4, 8)
+	h := NewHub()
+	publish(t, h, auth.RoleGuest, "1", "2", "3")
+	publish(t, h, auth.RoleAdmin, "4")
+	id := func(seq string) string { return h.epoch + "-" + seq }
+
+	tests := []struct {
+		name     string
+		lastID   string
+		role     int
+		missed   []string
+		complete bool
+	}{
+		{"new", "", auth.RoleGuest, nil, true},
+		{"missed some", id("1"), auth.RoleAdmin, []string{"2", "3", "4"}, true},
+		{"missed some, not for its role", id("1"), auth.RoleGuest, []string{"2", "3"}, true},
+		{"up to date", id("4"), auth.RoleGuest, nil, true},
+		{"oldest kept", id("0"), auth.RoleAdmin, []string{"1", "2", "3", "4"}, true},
+		{"ahead of the server", id("5"), auth.RoleGuest, nil, false},
+		{"previous run", "l0ngag0-2", auth.RoleGuest, nil, false},
+		{"not an ID", "2", auth.RoleGuest, nil, false},
+		{"no sequence", h.epoch + "-", auth.RoleGuest, nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, missed, complete := h.subscribe(tt.lastID, tt.role)
+			defer h.unsubscribe(client)
+			if !slices.Equal(names(missed), tt.missed) || complete != tt.complete {
+				t.Errorf("missed %v, complete %t, want %v, %t", names(missed), complete, tt.missed, tt.complete)
+			}
+		})
+	}
+
+	// Two more push the first two out of the history, a client that last
+	// saw 1 lost 2
+	publish(t, h, auth.RoleGuest, "5", "6")
+	client, missed, complete := h.subscribe(id("1"), auth.RoleGuest)
+	defer h.unsubscribe(client)
+	if complete || !slices.Equal(names(missed), []string{"3", "5", "6"}) {
+		t.Errorf("older than the history: missed %v, complete %t, want [3 5 6] incomplete", names(missed), complete)
+	}
+	if _, _, complete := h.subscribe(id("2"), auth.RoleGuest); !complete {
+		t.Error("last saw the event before the oldest kept: incomplete")
+	}
+}
+
+func TestHubSlowClient(t *testing.T) {
+	withSizes(t, 16, 2)
+	h := NewHub()
+	slow, _, _ := h.subscribe("", auth.RoleGuest)
+	fast, _, _ := h.subscribe("", auth.RoleGuest)
+	admin, _, _ := h.subscribe("", auth.RoleAdmin)
+
+	for _, name := range []string{"1", "2", "3", "4"} {
+		publish(t, h, auth.RoleGuest, name)
+		if e := <-fast; e.Name != name {
+			t.Fatalf("fast client got %s, want %s", e.Name, name)
+		}
+		<-admin
+	}
+
+	// The slow client got what fit its buffer, then was disconnected
+	var got []string
+	for e := range slow {
+		got = append(got, e.Name)
+	}
+	if !slices.Equal(got, []string{"1", "2"}) {
+		t.Errorf("slow client got %v, want [1 2]", got)
+	}
+	if n := h.Clients(); n != 2 {
+		t.Errorf("Clients = %d, want 2", n)
+	}
+
+	// Events for other roles don't count against a client's buffer
+	publish(t, h, auth.RoleAdmin, "5", "6", "7")
+	if n := h.Clients(); n != 1 {
+		t.Errorf("Clients = %d, want only the admin dropped", n)
+	}
+	h.unsubscribe(fast)
+	h.unsubscribe(fast)
+
+	h.Close()
+	if client, _, _ := h.subscribe("", auth.RoleGuest); client != nil {
+		t.Error("subscribed to a closed hub")
+	}
+	if err := h.Publish("8", nil); err != nil {
+		t.Errorf("publishing on a closed hub: %v", err)
+	}
+}
+
+func TestHubHandler(t *testing.T) {
+	withSizes(t, 2, 8)
+	h := NewHub()
+	publish(t, h, auth.RoleGuest, "1", "2", "3")
+
+	stream := func(lastID string) string {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, "/events", nil)
+		if lastID != "" {
+			req.Header.Set("Last-Event-ID", lastID)
+		}
+		ctx, cancel := context.WithTimeout(req.Context(), 50*time.Millisecond)
+		defer cancel()
+		rec := httptest.NewRecorder()
+		if err := h.Handler(echo.New().NewContext(req.WithContext(ctx), rec)); err != nil {
+			t.Fatal(err)
+		}
+		if ct := rec.Header().Get(echo.HeaderContentType); ct != "text/event-stream" {
+			t.Errorf("Content-Type = %q", ct)
+		}
+		return rec.Body.String()
+	}
+
+	// Replayed after the retry delay, with their IDs
+	body := stream(h.epoch + "-2")
+	if want := "retry: 3000\n\nid: " + h.epoch + "-3\nevent: 3\ndata: {}\n\n"; body != want {
+		t.Errorf("replay:\n%q\nwant\n%q", body, want)
+	}
+
+	// 1 isn't kept anymore, the client resyncs before getting the rest
+	body = stream(h.epoch + "-0")
+	if !strings.HasPrefix(body, "retry: 3000\n\nevent: resync\ndata: {}\n\nid: "+h.epoch+"-2\n") {
+		t.Errorf("resync:\n%q", body)
+	}
+	if body := stream("other-3"); !strings.Contains(body, "event: resync\n") || strings.Contains(body, "id: ") {
+		t.Errorf("other epoch:\n%q", body)
+	}
+	if n := h.Clients(); n != 0 {
+		t.Errorf("%d clients left after their streams ended", n)
+	}
+}
+
+func TestPublishDashboardLayout(t *testing.T) {
+	store := storage.NewMemory()
+	_, err := store.SaveDashboard(context.Background(), storage.Dashboard{ID: "ops", Widgets: []storage.Widget{
+		{ID: "clock", Type: "clock", Position: widgets.Position{W: 1, H: 1}},
+		{ID: "users", Type: "clock", MinRole: auth.RoleUser, Style: "color: red", Position: widgets.Position{X: 1, W: 1, H: 1}},
+		{ID: "admin", Type: "clock", MinRole: auth.RoleAdmin, Position: widgets.Position{X: 2, W: 1, H: 1}},
+		{ID: "hidden", Type: "clock", Hidden: true, Position: widgets.Position{X: 3, W: 1, H: 1}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Server{config: &Config{Store: store}, hub: NewHub()}
+
+	clients := map[int]chan Event{}
+	for _, role := range []int{auth.RoleGuest, auth.RoleUser, 500, auth.RoleAdmin} {
+		clients[role], _, _ = s.hub.subscribe("", role)
+	}
+	if err := s.publishDashboard(context.Background(), "ops"); err != nil {
+		t.Fatal(err)
+	}
+	s.hub.Close()
+
+	want := map[int][]string{
+		auth.RoleGuest: {"clock"},
+		auth.RoleUser:  {"clock", "users"},
+		500:            {"clock", "users"},
+		auth.RoleAdmin: {"clock", "users", "admin"},
+	}
+	for role, client := range clients {
+		var layouts [][]string
+		var styles []string
+		var swaps []string
+		for e := range client {
+			switch e.Name {
+			case "layout":
+				var layout layoutEvent
+				if err := json.Unmarshal(e.Data, &layout); err != nil {
+					t.Fatal(err)
+				}
+				layouts = append(layouts, layout.Widgets)
+				styles = append(styles, layout.Styles)
+			case "swap":
+				var swap swapEvent
+				if err := json.Unmarshal(e.Data, &swap); err != nil {
+					t.Fatal(err)
+				}
+				swaps = append(swaps, strings.TrimPrefix(swap.Target, "widget-"))
+			}
+		}
+		if len(layouts) != 1 || !slices.Equal(layouts[0], want[role]) {
+			t.Errorf("role %d: layouts %v, want one with %v", role, layouts, want[role])
+		}
+		// Only roles seeing the widget with a style have its version
+		if hasStyle := slices.Contains(want[role], "users"); len(styles) != 1 || (styles[0] != "") != hasStyle {
+			t.Errorf("role %d: styles %q, want one for %v", role, styles, want[role])
+		}
+		if !slices.Equal(swaps, want[role]) {
+			t.Errorf("role %d: cards of %v, want %v", role, swaps, want[role])
+		}
+	}
+}
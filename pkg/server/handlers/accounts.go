@@ -0,0 +1,203 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/pynezz/wasmdash/pkg/auth"
+	"github.com/pynezz/wasmdash/pkg/server/middleware"
+	"github.com/pynezz/wasmdash/pkg/storage"
+)
+
+/*
+ * Account management under /api/v1/accounts, for admins only
+ *
+ * Accounts from the config file get their role and password from there
+ * again on the next start, see storage.SyncAccounts.
+ */
+
+// minPasswordLength is the shortest password accepted through the API
+const minPasswordLength = 8
+
+// roleList names the roles in problems, see pkg/auth
+var roleList = fmt.Sprintf("%d (guest), %d (user) or %d (admin)", auth.RoleGuest, auth.RoleUser, auth.RoleAdmin)
+
+// accountBody is an account as returned by the API, with the role even if
+// it's RoleGuest. The shallower field wins in JSON.
+type accountBody struct {
+	auth.Account
+	Role int `json:"role"`
+}
+
+func newAccountBody(a auth.Account) accountBody {
+	return accountBody{Account: a, Role: a.Role}
+}
+
+// ListAccounts returns all accounts, without their password hashes
+func (a *API) ListAccounts(c echo.Context) error {
+	list, err := a.store.Accounts(c.Request().Context())
+	if err != nil {
+		return err
+	}
+	body := make([]accountBody, 0, len(list))
+	for _, account := range list {
+		body = append(body, newAccountBody(account))
+	}
+	return c.JSON(http.StatusOK, body)
+}
+
+// CreateAccount creates an account from {"id", "password", "role"}
+func (a *API) CreateAccount(c echo.Context) error {
+	var req struct {
+		ID       string `json:"id"`
+		Password string `json:"password"`
+		Role     int    `json:"role"`
+	}
+	if err := decodeJSON(c, &req); err != nil {
+		return err
+	}
+
+	var problems []FieldProblem
+	if err := auth.ValidID(req.ID); err != nil {
+		problems = append(problems, FieldProblem{"id", err.Error()})
+	}
+	problems = append(problems, validatePassword(req.Password)...)
+	problems = append(problems, validateRole(req.Role)...)
+	if len(problems) > 0 {
+		return invalid(problems)
+	}
+
+	ctx := c.Request().Context()
+	if _, err := a.store.Account(ctx, req.ID); err == nil {
+		return problem(http.StatusConflict, "account %q already exists", req.ID)
+	} else if !errors.Is(err, storage.ErrNotFound) {
+		return err
+	}
+
+	hash, err := auth.HashPassword(req.Password)
+	if err != nil {
+		return err
+	}
+	account := auth.Account{
+		ID:       req.ID,
+		UUID:     uuid.NewString(),
+		Password: hash,
+		Creation: time.Now().UTC(),
+		Role:     req.Role,
+	}
+	if err := a.store.SaveAccount(ctx, account); err != nil {
+		return err
+	}
+
+	middleware.Logger(c).Info("Account created", "account", account.ID, "role", account.Role)
+	c.Response().Header().Set(echo.HeaderLocation, strings.TrimSuffix(c.Request().URL.Path, "/")+"/"+account.ID)
+	return c.JSON(http.StatusCreated, newAccountBody(account))
+}
+
+// UpdateAccount changes the role or password of an account, from
+// {"role", "password"}. A new password signs the account out everywhere.
+func (a *API) UpdateAccount(c echo.Context) error {
+	account, err := a.account(c)
+	if err != nil {
+		return err
+	}
+
+	var req struct {
+		Password *string `json:"password"`
+		Role     *int    `json:"role"`
+	}
+	if err := decodeJSON(c, &req); err != nil {
+		return err
+	}
+
+	var problems []FieldProblem
+	if req.Password != nil {
+		problems = append(problems, validatePassword(*req.Password)...)
+	}
+	if req.Role != nil {
+		problems = append(problems, validateRole(*req.Role)...)
+	}
+	if len(problems) > 0 {
+		return invalid(problems)
+	}
+	if req.Role != nil && *req.Role < auth.RoleAdmin && isSelf(c, account.ID) {
+		// Someone has to be left to manage accounts
+		return problem(http.StatusConflict, "you can't take the admin role from your own account")
+	}
+
+	if req.Role != nil {
+		account.Role = *req.Role
+	}
+	if req.Password != nil {
+		if account.Password, err = auth.HashPassword(*req.Password); err != nil {
+			return err
+		}
+	}
+	if err := a.store.SaveAccount(c.Request().Context(), account); err != nil {
+		return err
+	}
+	if req.Password != nil {
+		a.sessions.DeleteAccount(account.ID)
+	}
+
+	middleware.Logger(c).Info("Account updated", "account", account.ID)
+	return c.JSON(http.StatusOK, newAccountBody(account))
+}
+
+// DeleteAccount removes an account and ends its sessions. Dashboards it
+// owns are kept, admins can hand them to someone else.
+func (a *API) DeleteAccount(c echo.Context) error {
+	account, err := a.account(c)
+	if err != nil {
+		return err
+	}
+	if isSelf(c, account.ID) {
+		return problem(http.StatusConflict, "you can't delete your own account")
+	}
+
+	if err := a.store.DeleteAccount(c.Request().Context(), account.ID); err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return problem(http.StatusNotFound, "account %q not found", account.ID)
+		}
+		return err
+	}
+	a.sessions.DeleteAccount(account.ID)
+
+	middleware.Logger(c).Info("Account deleted", "account", account.ID)
+	return c.NoContent(http.StatusNoContent)
+}
+
+// account loads the account named by the :account parameter
+func (a *API) account(c echo.Context) (auth.Account, error) {
+	id := c.Param("account")
+	account, err := a.store.Account(c.Request().Context(), id)
+	if errors.Is(err, storage.ErrNotFound) {
+		return account, problem(http.StatusNotFound, "account %q not found", id)
+	}
+	return account, err
+}
+
+// isSelf reports whether the request is signed in as the account id
+func isSelf(c echo.Context, id string) bool {
+	account, ok := middleware.Account(c)
+	return ok && account.ID == id
+}
+
+func validatePassword(password string) []FieldProblem {
+	if len(password) < minPasswordLength {
+		return []FieldProblem{{"password", fmt.Sprintf("must be at least %d characters", minPasswordLength)}}
+	}
+	return nil
+}
+
+func validateRole(role int) []FieldProblem {
+	if !auth.ValidRole(role) {
+		return []FieldProblem{{"role", "must be " + roleList}}
+	}
+	return nil
+}
@@ -0,0 +1,637 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/pynezz/wasmdash/pkg/auth"
+	"github.com/pynezz/wasmdash/pkg/secrets"
+	"github.com/pynezz/wasmdash/pkg/server/middleware"
+	"github.com/pynezz/wasmdash/pkg/storage"
+	"github.com/pynezz/wasmdash/pkg/ui/widgets"
+)
+
+/*
+ * JSON API for dashboards and their widgets, mounted at /api/v1
+ *
+ * Responses for a dashboard or any of its widgets carry the dashboard version
+ * as ETag. Every change has to send it back in If-Match, or "*" to overwrite
+ * whatever is stored. A stale ETag is rejected with 412 Precondition Failed.
+ *
+ * Errors are RFC 9457 problem details, see Problem.
+ *
+ * Anyone let into the API may read dashboards, but widgets are left out for
+ * roles below their min_role. Accounts with RoleUser may create dashboards
+ * and change those they own, RoleAdmin may change all of them and manage
+ * accounts, see accounts.go. Requests with the API token act as RoleAdmin.
+ */
+
+const (
+	HeaderETag        = "ETag"
+	HeaderIfMatch     = "If-Match"
+	HeaderIfNoneMatch = "If-None-Match"
+
+	// MIMEProblemJSON is the content type of Problem bodies
+	MIMEProblemJSON = "application/problem+json"
+)
+
+// Problem is an RFC 9457 problem details body, returned for every API error
+type Problem struct {
+	Type   string         `json:"type"`
+	Title  string         `json:"title"`
+	Status int            `json:"status"`
+	Detail string         `json:"detail,omitempty"`
+	Errors []FieldProblem `json:"errors,omitempty"` // Invalid fields of the request body
+}
+
+// FieldProblem is a single invalid field of a request body
+type FieldProblem struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+func (p *Problem) Error() string {
+	return p.Title + ": " + p.Detail
+}
+
+func problem(status int, format string, args ...any) *Problem {
+	return &Problem{
+		Type:   "about:blank",
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: fmt.Sprintf(format, args...),
+	}
+}
+
+// API serves dashboards, widgets and accounts from a store
+type API struct {
+	store    storage.Store
+	sessions *auth.Sessions // Ended when an account is deleted or its password changes
+}
+
+func NewAPI(store storage.Store, sessions *auth.Sessions) *API {
+	return &API{store: store, sessions: sessions}
+}
+
+// ListDashboards returns all dashboards, without their widgets
+func (a *API) ListDashboards(c echo.Context) error {
+	list, err := a.store.Dashboards(c.Request().Context())
+	if err != nil {
+		return err
+	}
+
+	// Listings leave the widgets out, the shallower field wins in JSON
+	type listed struct {
+		storage.Dashboard
+		Widgets []storage.Widget `json:"widgets,omitempty"`
+	}
+	body := make([]listed, 0, len(list))
+	for _, d := range list {
+		body = append(body, listed{Dashboard: d})
+	}
+	return c.JSON(http.StatusOK, body)
+}
+
+// CreateDashboard creates a dashboard, optionally with widgets
+func (a *API) CreateDashboard(c echo.Context) error {
+	var d storage.Dashboard
+	if err := decodeJSON(c, &d); err != nil {
+		return err
+	}
+
+	d.Version = 0
+	role, _ := middleware.Role(c)
+	account, signedIn := middleware.Account(c)
+	// Only admins may hand a new dashboard to someone else
+	if role < auth.RoleAdmin || (d.Owner == "" && signedIn) {
+		d.Owner = account.ID
+	}
+
+	var problems []FieldProblem
+	if !idPattern.MatchString(d.ID) {
+		problems = append(problems, FieldProblem{"id", idRule})
+	}
+	problems = append(problems, validateTitle(d.Title)...)
+	problems = append(problems, validateOwner(d.Owner)...)
+	for i := range d.Widgets {
+		field := "widgets[" + strconv.Itoa(i) + "]."
+		prepareWidget(&d.Widgets[i], d.Widgets[:i])
+		if !idPattern.MatchString(d.Widgets[i].ID) {
+			problems = append(problems, FieldProblem{field + "id", idRule})
+		} else if slices.ContainsFunc(d.Widgets[:i], func(w storage.Widget) bool { return w.ID == d.Widgets[i].ID }) {
+			problems = append(problems, FieldProblem{field + "id", "is used by another widget"})
+		}
+		problems = append(problems, validateWidget(field, d.Widgets[i], role)...)
+	}
+	if len(problems) > 0 {
+		return invalid(problems)
+	}
+
+	saved, err := a.store.SaveDashboard(c.Request().Context(), d)
+	if err != nil {
+		return storeError(err, d.ID)
+	}
+	c.Response().Header().Set(echo.HeaderLocation, strings.TrimSuffix(c.Request().URL.Path, "/")+"/"+saved.ID)
+	return respond(c, http.StatusCreated, saved, withWidgets(visible(c, saved)))
+}
+
+// GetDashboard returns a dashboard with its widgets
+func (a *API) GetDashboard(c echo.Context) error {
+	d, err := a.dashboard(c)
+	if err != nil {
+		return err
+	}
+	return respond(c, http.StatusOK, d, withWidgets(visible(c, d)))
+}
+
+// UpdateDashboard changes the title of a dashboard, and its owner if an
+// admin asks. Widgets are changed through their own endpoints.
+func (a *API) UpdateDashboard(c echo.Context) error {
+	d, err := a.editableDashboard(c)
+	if err != nil {
+		return err
+	}
+	if err := ifMatch(c, d); err != nil {
+		return err
+	}
+
+	var update struct {
+		Title *string `json:"title"`
+		Owner *string `json:"owner"`
+	}
+	if err := decodeJSON(c, &update); err != nil {
+		return err
+	}
+	var problems []FieldProblem
+	if update.Title != nil {
+		problems = append(problems, validateTitle(*update.Title)...)
+		d.Title = *update.Title
+	}
+	if update.Owner != nil {
+		if role, _ := middleware.Role(c); role < auth.RoleAdmin {
+			return problem(http.StatusForbidden, "only admins may change the owner of dashboard %q", d.ID)
+		}
+		problems = append(problems, validateOwner(*update.Owner)...)
+		d.Owner = *update.Owner
+	}
+	if len(problems) > 0 {
+		return invalid(problems)
+	}
+
+	return a.save(c, http.StatusOK, d, func(saved storage.Dashboard) any { return withWidgets(visible(c, saved)) })
+}
+
+// DeleteDashboard removes a dashboard and all of its widgets
+func (a *API) DeleteDashboard(c echo.Context) error {
+	d, err := a.editableDashboard(c)
+	if err != nil {
+		return err
+	}
+	if err := ifMatch(c, d); err != nil {
+		return err
+	}
+
+	if err := a.store.DeleteDashboard(c.Request().Context(), d.ID, d.Version); err != nil {
+		return storeError(err, d.ID)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// ListWidgets returns the widgets of a dashboard in layout order
+func (a *API) ListWidgets(c echo.Context) error {
+	d, err := a.dashboard(c)
+	if err != nil {
+		return err
+	}
+	return respond(c, http.StatusOK, d, withWidgets(visible(c, d)).Widgets)
+}
+
+// CreateWidget adds a widget to a dashboard, below the existing ones
+// unless the request places it
+func (a *API) CreateWidget(c echo.Context) error {
+	d, err := a.editableDashboard(c)
+	if err != nil {
+		return err
+	}
+	if err := ifMatch(c, d); err != nil {
+		return err
+	}
+
+	var w storage.Widget
+	if err := decodeJSON(c, &w); err != nil {
+		return err
+	}
+	prepareWidget(&w, d.Widgets)
+
+	var problems []FieldProblem
+	if !idPattern.MatchString(w.ID) {
+		problems = append(problems, FieldProblem{"id", idRule})
+	}
+	role, _ := middleware.Role(c)
+	problems = append(problems, validateWidget("", w, role)...)
+	if len(problems) > 0 {
+		return invalid(problems)
+	}
+	if _, ok := findWidget(d, w.ID); ok {
+		return problem(http.StatusConflict, "dashboard %q already has a widget %q", d.ID, w.ID)
+	}
+
+	d.Widgets = append(d.Widgets, w)
+	return a.save(c, http.StatusCreated, d, func(storage.Dashboard) any {
+		c.Response().Header().Set(echo.HeaderLocation, strings.TrimSuffix(c.Request().URL.Path, "/")+"/"+w.ID)
+		return w
+	})
+}
+
+// GetWidget returns a single widget
+func (a *API) GetWidget(c echo.Context) error {
+	d, err := a.dashboard(c)
+	if err != nil {
+		return err
+	}
+	shown := visible(c, d)
+	i, ok := findWidget(shown, c.Param("widget"))
+	if !ok {
+		return problem(http.StatusNotFound, "dashboard %q has no widget %q", d.ID, c.Param("widget"))
+	}
+	return respond(c, http.StatusOK, d, shown.Widgets[i])
+}
+
+// UpdateWidget replaces a widget. It keeps its position if none is given.
+func (a *API) UpdateWidget(c echo.Context) error {
+	d, i, err := a.editableWidget(c)
+	if err != nil {
+		return err
+	}
+
+	var w storage.Widget
+	if err := decodeJSON(c, &w); err != nil {
+		return err
+	}
+	if w.ID != "" && w.ID != d.Widgets[i].ID {
+		return invalid([]FieldProblem{{"id", "can't be changed, delete and recreate the widget instead"}})
+	}
+	w.ID = d.Widgets[i].ID
+	if w.Position == (widgets.Position{}) {
+		w.Position = d.Widgets[i].Position
+	}
+	prepareWidget(&w, d.Widgets)
+	role, _ := middleware.Role(c)
+	if problems := validateWidget("", w, role); len(problems) > 0 {
+		return invalid(problems)
+	}
+
+	d.Widgets[i] = w
+	return a.save(c, http.StatusOK, d, func(storage.Dashboard) any { return w })
+}
+
+// DeleteWidget removes a widget from its dashboard
+func (a *API) DeleteWidget(c echo.Context) error {
+	d, i, err := a.editableWidget(c)
+	if err != nil {
+		return err
+	}
+
+	d.Widgets = slices.Delete(d.Widgets, i, i+1)
+	if _, err := a.store.SaveDashboard(c.Request().Context(), d); err != nil {
+		return storeError(err, d.ID)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// UpdateLayout moves and resizes widgets, as a list of {"id", "position"}.
+// Widgets that aren't listed keep their position.
+func (a *API) UpdateLayout(c echo.Context) error {
+	d, err := a.editableDashboard(c)
+	if err != nil {
+		return err
+	}
+	if err := ifMatch(c, d); err != nil {
+		return err
+	}
+
+	var layout []struct {
+		ID       string           `json:"id"`
+		Position widgets.Position `json:"position"`
+	}
+	if err := decodeJSON(c, &layout); err != nil {
+		return err
+	}
+
+	role, _ := middleware.Role(c)
+	var problems []FieldProblem
+	for n, entry := range layout {
+		field := "[" + strconv.Itoa(n) + "]."
+		i, ok := findWidget(d, entry.ID)
+		if !ok || d.Widgets[i].MinRole > role {
+			problems = append(problems, FieldProblem{field + "id", fmt.Sprintf("dashboard %q has no widget %q", d.ID, entry.ID)})
+			continue
+		}
+		if perr := entry.Position.Validate(); perr != nil {
+			problems = append(problems, FieldProblem{field + "position." + perr.Field, perr.Msg})
+			continue
+		}
+		d.Widgets[i].Position = entry.Position
+	}
+	if len(problems) > 0 {
+		return invalid(problems)
+	}
+
+	return a.save(c, http.StatusOK, d, func(saved storage.Dashboard) any { return withWidgets(visible(c, saved)) })
+}
+
+// WidgetTypes lists the registered widget types
+func (a *API) WidgetTypes(c echo.Context) error {
+	return c.JSON(http.StatusOK, widgets.Types())
+}
+
+// dashboard loads the dashboard named by the :id parameter
+func (a *API) dashboard(c echo.Context) (storage.Dashboard, error) {
+	id := c.Param("id")
+	d, err := a.store.Dashboard(c.Request().Context(), id)
+	if err != nil {
+		return d, storeError(err, id)
+	}
+	return d, nil
+}
+
+// editableDashboard loads the dashboard named by the :id parameter for a
+// change, which only its owner and admins may make
+func (a *API) editableDashboard(c echo.Context) (storage.Dashboard, error) {
+	d, err := a.dashboard(c)
+	if err != nil {
+		return d, err
+	}
+	if !canEdit(c, d) {
+		if d.Owner == "" {
+			return d, problem(http.StatusForbidden, "only admins may change dashboard %q", d.ID)
+		}
+		return d, problem(http.StatusForbidden, "dashboard %q belongs to %q", d.ID, d.Owner)
+	}
+	return d, nil
+}
+
+// editableWidget loads the widget named by the :widget parameter for a change
+// guarded by If-Match. Widgets synced from widget.toml can only be moved,
+// anything else would be undone by the next sync.
+func (a *API) editableWidget(c echo.Context) (storage.Dashboard, int, error) {
+	d, err := a.editableDashboard(c)
+	if err != nil {
+		return d, 0, err
+	}
+	role, _ := middleware.Role(c)
+	i, ok := findWidget(d, c.Param("widget"))
+	if !ok || d.Widgets[i].MinRole > role {
+		return d, 0, problem(http.StatusNotFound, "dashboard %q has no widget %q", d.ID, c.Param("widget"))
+	}
+	if err := ifMatch(c, d); err != nil {
+		return d, 0, err
+	}
+	if source := d.Widgets[i].Source; source != "" {
+		return d, 0, problem(http.StatusConflict, "widget %q is defined in %s, edit the file instead", d.Widgets[i].ID, source)
+	}
+	return d, i, nil
+}
+
+// save stores d, which was loaded at the version it's based on,
+// and responds with the body built from the saved dashboard
+func (a *API) save(c echo.Context, status int, d storage.Dashboard, body func(storage.Dashboard) any) error {
+	saved, err := a.store.SaveDashboard(c.Request().Context(), d)
+	if err != nil {
+		return storeError(err, d.ID)
+	}
+	return respond(c, status, saved, body(saved))
+}
+
+// canEdit reports whether the request may change d: admins may change any
+// dashboard, users those they own
+func canEdit(c echo.Context, d storage.Dashboard) bool {
+	role, ok := middleware.Role(c)
+	if !ok {
+		return false
+	}
+	if role >= auth.RoleAdmin {
+		return true
+	}
+	account, signedIn := middleware.Account(c)
+	return signedIn && role >= auth.RoleUser && d.Owner != "" && d.Owner == account.ID
+}
+
+// visible leaves out the widgets of d above the role of the request
+func visible(c echo.Context, d storage.Dashboard) storage.Dashboard {
+	role, _ := middleware.Role(c)
+	d.Widgets = slices.DeleteFunc(slices.Clone(d.Widgets), func(w storage.Widget) bool { return w.MinRole > role })
+	return d
+}
+
+// respond writes body with the dashboard version as ETag, or 304 Not Modified
+// for a GET whose If-None-Match already has it
+func respond(c echo.Context, status int, d storage.Dashboard, body any) error {
+	tag := etag(d)
+	c.Response().Header().Set(HeaderETag, tag)
+
+	if c.Request().Method == http.MethodGet && slices.Contains(etags(c.Request().Header.Get(HeaderIfNoneMatch)), tag) {
+		return c.NoContent(http.StatusNotModified)
+	}
+	return c.JSON(status, body)
+}
+
+func etag(d storage.Dashboard) string {
+	return `"` + strconv.FormatInt(d.Version, 10) + `"`
+}
+
+// etags splits a list of entity tags as sent in If-Match and If-None-Match
+func etags(header string) []string {
+	var tags []string
+	for _, tag := range strings.Split(header, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// ifMatch requires the request to be based on the current version of d
+func ifMatch(c echo.Context, d storage.Dashboard) error {
+	tags := etags(c.Request().Header.Get(HeaderIfMatch))
+	if len(tags) == 0 {
+		return problem(http.StatusPreconditionRequired, "send the ETag of dashboard %q in If-Match, or \"*\" to overwrite it", d.ID)
+	}
+	if !slices.Contains(tags, "*") && !slices.Contains(tags, etag(d)) {
+		return problem(http.StatusPreconditionFailed, "dashboard %q changed and is now at version %d, fetch it again", d.ID, d.Version)
+	}
+	return nil
+}
+
+// storeError maps storage errors to problems
+func storeError(err error, id string) error {
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		return problem(http.StatusNotFound, "dashboard %q not found", id)
+	case errors.Is(err, storage.ErrExists):
+		return problem(http.StatusConflict, "dashboard %q already exists", id)
+	case errors.Is(err, storage.ErrConflict):
+		return problem(http.StatusPreconditionFailed, "dashboard %q was changed concurrently, fetch it again", id)
+	}
+	return err
+}
+
+func invalid(problems []FieldProblem) error {
+	p := problem(http.StatusUnprocessableEntity, "the request body has %d invalid field(s)", len(problems))
+	p.Errors = problems
+	return p
+}
+
+// decodeJSON decodes the request body into v. Only JSON is accepted, which
+// also keeps browsers from sending cross-site requests without a preflight.
+func decodeJSON(c echo.Context, v any) error {
+	mediaType, _, _ := mime.ParseMediaType(c.Request().Header.Get(echo.HeaderContentType))
+	if mediaType != echo.MIMEApplicationJSON {
+		return problem(http.StatusUnsupportedMediaType, "the request body must be %s", echo.MIMEApplicationJSON)
+	}
+
+	dec := json.NewDecoder(c.Request().Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return problem(http.StatusBadRequest, "invalid JSON: %v", err)
+	}
+	if dec.More() {
+		return problem(http.StatusBadRequest, "invalid JSON: unexpected data after the body")
+	}
+	return nil
+}
+
+const idRule = "must be 1-64 lowercase letters, digits, - or _, starting with a letter or digit"
+
+var idPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,63}$`)
+
+// maxTitleLength keeps titles within what a card header can show
+const maxTitleLength = 200
+
+func validateTitle(title string) []FieldProblem {
+	if len(title) > maxTitleLength {
+		return []FieldProblem{{"title", fmt.Sprintf("must be at most %d characters", maxTitleLength)}}
+	}
+	return nil
+}
+
+// validateOwner checks the owner of a dashboard, which may be left empty
+// to only let admins change it
+func validateOwner(owner string) []FieldProblem {
+	if owner == "" {
+		return nil
+	}
+	if err := auth.ValidID(owner); err != nil {
+		return []FieldProblem{{"owner", err.Error()}}
+	}
+	return nil
+}
+
+// prepareWidget normalizes a widget sent by a client. Widgets without a
+// position are placed in the first row below others, sizes default to 1.
+func prepareWidget(w *storage.Widget, others []storage.Widget) {
+	w.Source = ""
+	if w.Position == (widgets.Position{}) {
+		w.Position.Y = storage.Bottom(others)
+	}
+	if w.Position.W == 0 {
+		w.Position.W = 1
+	}
+	if w.Position.H == 0 {
+		w.Position.H = 1
+	}
+
+	if settings := bytes.TrimSpace(w.Settings); len(settings) == 0 || string(settings) == "null" {
+		w.Settings = nil
+	} else {
+		var compact bytes.Buffer
+		if json.Compact(&compact, settings) == nil {
+			w.Settings = compact.Bytes()
+		}
+	}
+}
+
+// validateWidget checks the type, settings, position and min_role of a
+// widget sent with role. field prefixes the names of invalid fields.
+func validateWidget(field string, w storage.Widget, role int) []FieldProblem {
+	var problems []FieldProblem
+	add := func(name, format string, args ...any) {
+		problems = append(problems, FieldProblem{field + name, fmt.Sprintf(format, args...)})
+	}
+
+	if len(w.Title) > maxTitleLength {
+		add("title", "must be at most %d characters", maxTitleLength)
+	}
+	if perr := widgets.CheckStyle(w.Style); perr != nil {
+		add(perr.Field, "%s", perr.Msg)
+	}
+	if perr := w.Position.Validate(); perr != nil {
+		add("position."+perr.Field, "%s", perr.Msg)
+	}
+	switch {
+	case !auth.ValidRole(w.MinRole):
+		add("min_role", "must be %s", roleList)
+	case w.MinRole > role:
+		// Nobody should hide a widget from themselves
+		add("min_role", "can't be above your own role %d", role)
+	}
+
+	// Secrets are referenced, never stored in settings, see pkg/secrets
+	var settings any
+	if w.Settings != nil && json.Unmarshal(w.Settings, &settings) == nil {
+		for _, name := range secrets.References(settings) {
+			if ok, err := secrets.Has(name); err != nil {
+				add("settings", "references secret %q: %v", name, err)
+			} else if !ok {
+				add("settings", "references secret %q, which doesn't exist", name)
+			}
+		}
+	}
+
+	types := widgets.Types()
+	switch {
+	case !slices.Contains(types, w.Type):
+		add("type", "%q is not a known widget type (%s)", w.Type, strings.Join(types, ", "))
+	case w.Settings != nil && w.Settings[0] != '{':
+		add("settings", "must be a JSON object")
+	default:
+		// Creating the widget runs the same validation as widget.toml
+		if _, err := widgets.New(w.Type, w.Base(), widgets.JSONSettings(w.Settings)); err != nil {
+			var ferr *widgets.FieldError
+			if !errors.As(err, &ferr) {
+				add("settings", "%v", err)
+				break
+			}
+			name := "settings"
+			if setting, ok := strings.CutPrefix(ferr.Field, w.Type+"."); ok {
+				name += "." + setting
+			}
+			add(name, "%s", ferr.Msg)
+		}
+	}
+
+	return problems
+}
+
+// withWidgets makes a dashboard without widgets encode them as [], not null
+func withWidgets(d storage.Dashboard) storage.Dashboard {
+	if d.Widgets == nil {
+		d.Widgets = []storage.Widget{}
+	}
+	return d
+}
+
+// findWidget returns the index of the widget with the given ID
+func findWidget(d storage.Dashboard, id string) (int, bool) {
+	i := slices.IndexFunc(d.Widgets, func(w storage.Widget) bool { return w.ID == id })
+	return i, i >= 0
+}
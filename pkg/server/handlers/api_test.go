@@ -0,0 +1,199 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/pynezz/wasmdash/pkg/auth"
+	"github.com/pynezz/wasmdash/pkg/server/middleware"
+	"github.com/pynezz/wasmdash/pkg/storage"
+)
+
+// Bearer tokens of the accounts the API tests act for
+const (
+	adminToken = "t.admin.0"
+	bobToken   = "t.bob.0"
+)
+
+// newTestAPI returns the API routes over a store with two dashboards: ops
+// owned by bob and infra owned by alice, both at version 1
+func newTestAPI(t *testing.T) *echo.Echo {
+	t.Helper()
+	store := storage.NewMemory()
+	for _, d := range []storage.Dashboard{
+		{ID: "ops", Owner: "bob", Widgets: []storage.Widget{{ID: "clock", Type: "clock"}}},
+		{ID: "infra", Owner: "alice", Widgets: []storage.Widget{{ID: "clock", Type: "clock"}}},
+	} {
+		if _, err := store.SaveDashboard(context.Background(), d); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	accounts := map[string]auth.Account{
+		adminToken: {ID: "admin", Role: auth.RoleAdmin},
+		bobToken:   {ID: "bob", Role: auth.RoleUser},
+	}
+	tokens := middleware.Tokens{Signed: func(_ context.Context, token string) (auth.Account, error) {
+		if account, ok := accounts[token]; ok {
+			return account, nil
+		}
+		return auth.Account{}, auth.ErrInvalidToken
+	}}
+
+	api := NewAPI(store, auth.NewSessions(0))
+	e := echo.New()
+	e.HTTPErrorHandler = ErrorHandler
+	v1 := e.Group("/api/v1", middleware.LoopbackOrToken("localhost", tokens))
+	v1.PATCH("/dashboards/:id", api.UpdateDashboard)
+	v1.DELETE("/dashboards/:id", api.DeleteDashboard)
+	v1.POST("/dashboards/:id/widgets", api.CreateWidget)
+	v1.DELETE("/dashboards/:id/widgets/:widget", api.DeleteWidget)
+	return e
+}
+
+// apiRequest sends a request with token, If-Match and a JSON body, each left
+// out when empty
+func apiRequest(e *echo.Echo, method, path, token, ifMatch, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.RemoteAddr = "192.0.2.7:5555"
+	if token != "" {
+		req.Header.Set(echo.HeaderAuthorization, "Bearer "+token)
+	}
+	if ifMatch != "" {
+		req.Header.Set(HeaderIfMatch, ifMatch)
+	}
+	if body != "" {
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	}
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+// decodeProblem checks rec is a problem+json body with its status
+func decodeProblem(t *testing.T, rec *httptest.ResponseRecorder) Problem {
+	t.Helper()
+	if got := rec.Header().Get(echo.HeaderContentType); got != MIMEProblemJSON {
+		t.Errorf("Content-Type = %q, want %q", got, MIMEProblemJSON)
+	}
+	var p Problem
+	if err := json.Unmarshal(rec.Body.Bytes(), &p); err != nil {
+		t.Fatalf("body %s: %v", rec.Body, err)
+	}
+	if p.Status != rec.Code || p.Title != http.StatusText(rec.Code) || p.Type != "about:blank" {
+		t.Errorf("problem = %+v, want status %d", p, rec.Code)
+	}
+	return p
+}
+
+func TestAPIPreconditions(t *testing.T) {
+	tests := []struct {
+		name, method, path, token, ifMatch, body string
+		want                                     int
+	}{
+		{"no If-Match", http.MethodPatch, "/api/v1/dashboards/ops", adminToken, "", `{"title": "Ops"}`, http.StatusPreconditionRequired},
+		{"stale If-Match", http.MethodPatch, "/api/v1/dashboards/ops", adminToken, `"0"`, `{"title": "Ops"}`, http.StatusPreconditionFailed},
+		{"future If-Match", http.MethodPatch, "/api/v1/dashboards/ops", adminToken, `"2"`, `{"title": "Ops"}`, http.StatusPreconditionFailed},
+		{"delete without", http.MethodDelete, "/api/v1/dashboards/ops", adminToken, "", "", http.StatusPreconditionRequired},
+		{"delete stale", http.MethodDelete, "/api/v1/dashboards/ops", adminToken, `"0", "2"`, "", http.StatusPreconditionFailed},
+		{"widget without", http.MethodDelete, "/api/v1/dashboards/ops/widgets/clock", adminToken, "", "", http.StatusPreconditionRequired},
+		{"create widget stale", http.MethodPost, "/api/v1/dashboards/ops/widgets", adminToken, `"7"`, `{"id": "more", "type": "clock"}`, http.StatusPreconditionFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := apiRequest(newTestAPI(t), tt.method, tt.path, tt.token, tt.ifMatch, tt.body)
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.want, rec.Body)
+			}
+			decodeProblem(t, rec)
+		})
+	}
+
+	// The ETag a change returns is the one the next change must send
+	e := newTestAPI(t)
+	rec := apiRequest(e, http.MethodPatch, "/api/v1/dashboards/ops", adminToken, `"1"`, `{"title": "Ops"}`)
+	if rec.Code != http.StatusOK || rec.Header().Get(HeaderETag) != `"2"` {
+		t.Fatalf("update: status %d, ETag %s: %s", rec.Code, rec.Header().Get(HeaderETag), rec.Body)
+	}
+	if rec := apiRequest(e, http.MethodPatch, "/api/v1/dashboards/ops", adminToken, `"1"`, `{"title": "Again"}`); rec.Code != http.StatusPreconditionFailed {
+		t.Errorf("update from the old version: status %d, want 412", rec.Code)
+	}
+	if rec := apiRequest(e, http.MethodPatch, "/api/v1/dashboards/ops", adminToken, "*", `{"title": "Again"}`); rec.Code != http.StatusOK {
+		t.Errorf("overwrite with *: status %d, want 200", rec.Code)
+	}
+}
+
+func TestAPIOwner(t *testing.T) {
+	tests := []struct {
+		name, method, path, token, body string
+		want                            int
+	}{
+		{"owner updates", http.MethodPatch, "/api/v1/dashboards/ops", bobToken, `{"title": "Mine"}`, http.StatusOK},
+		{"non-owner updates", http.MethodPatch, "/api/v1/dashboards/infra", bobToken, `{"title": "Mine"}`, http.StatusForbidden},
+		{"non-owner deletes", http.MethodDelete, "/api/v1/dashboards/infra", bobToken, "", http.StatusForbidden},
+		{"non-owner adds a widget", http.MethodPost, "/api/v1/dashboards/infra/widgets", bobToken, `{"id": "more", "type": "clock"}`, http.StatusForbidden},
+		{"non-owner removes a widget", http.MethodDelete, "/api/v1/dashboards/infra/widgets/clock", bobToken, "", http.StatusForbidden},
+		{"owner may not give it away", http.MethodPatch, "/api/v1/dashboards/ops", bobToken, `{"owner": "alice"}`, http.StatusForbidden},
+		{"admin updates any", http.MethodPatch, "/api/v1/dashboards/infra", adminToken, `{"title": "Theirs"}`, http.StatusOK},
+		{"admin changes the owner", http.MethodPatch, "/api/v1/dashboards/infra", adminToken, `{"owner": "bob"}`, http.StatusOK},
+		{"no token", http.MethodPatch, "/api/v1/dashboards/ops", "", `{"title": "Mine"}`, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := apiRequest(newTestAPI(t), tt.method, tt.path, tt.token, `"1"`, tt.body)
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.want, rec.Body)
+			}
+			if rec.Code >= 400 {
+				decodeProblem(t, rec)
+			}
+		})
+	}
+}
+
+func TestAPIInvalidWidget(t *testing.T) {
+	tests := []struct {
+		name   string
+		token  string
+		body   string
+		status int
+		fields []string
+	}{
+		{"unknown type", adminToken, `{"id": "w", "type": "nope"}`, http.StatusUnprocessableEntity, []string{"type"}},
+		{"invalid setting", adminToken, `{"id": "w", "type": "clock", "settings": {"format": "25h"}}`, http.StatusUnprocessableEntity, []string{"settings.format"}},
+		{"style escaping its rule", adminToken, `{"id": "w", "type": "clock", "style": "color: red } body { display: none"}`, http.StatusUnprocessableEntity, []string{"style"}},
+		{"settings not an object", adminToken, `{"id": "w", "type": "clock", "settings": [1]}`, http.StatusUnprocessableEntity, []string{"settings"}},
+		{"everything", adminToken, `{"id": "-w", "type": "clock", "min_role": 3, "position": {"x": 9, "w": 1, "h": 1}}`,
+			http.StatusUnprocessableEntity, []string{"id", "position.x", "min_role"}},
+		{"above own role", bobToken, `{"id": "w", "type": "clock", "min_role": 1000}`, http.StatusUnprocessableEntity, []string{"min_role"}},
+		{"taken id", adminToken, `{"id": "clock", "type": "clock"}`, http.StatusConflict, nil},
+		{"unknown field", adminToken, `{"id": "w", "type": "clock", "colour": "red"}`, http.StatusBadRequest, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := apiRequest(newTestAPI(t), http.MethodPost, "/api/v1/dashboards/ops/widgets", tt.token, `"1"`, tt.body)
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.status, rec.Body)
+			}
+			p := decodeProblem(t, rec)
+			var fields []string
+			for _, e := range p.Errors {
+				if e.Message == "" {
+					t.Errorf("%s: no message", e.Field)
+				}
+				fields = append(fields, e.Field)
+			}
+			slices.Sort(fields)
+			slices.Sort(tt.fields)
+			if !slices.Equal(fields, tt.fields) {
+				t.Errorf("invalid fields = %v, want %v", fields, tt.fields)
+			}
+		})
+	}
+}
@@ -1,16 +1,30 @@
 package handlers
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io/fs"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/a-h/templ"
 	"github.com/labstack/echo/v4"
-	"github.com/pynezz/pynezzentials/ansi"
+	"github.com/pynezz/wasmdash/pkg/assets"
+	"github.com/pynezz/wasmdash/pkg/auth"
 	"github.com/pynezz/wasmdash/pkg/core"
+	"github.com/pynezz/wasmdash/pkg/metrics"
 	"github.com/pynezz/wasmdash/pkg/server/middleware"
+	"github.com/pynezz/wasmdash/pkg/storage"
+	"github.com/pynezz/wasmdash/pkg/system"
+	"github.com/pynezz/wasmdash/pkg/timing"
 	"github.com/pynezz/wasmdash/pkg/ui"
 	"github.com/pynezz/wasmdash/pkg/ui/pages"
+	"github.com/pynezz/wasmdash/pkg/ui/widgets"
 )
 
 func HomeHandler(c echo.Context) error {
@@ -21,15 +35,82 @@ func AboutHandler(c echo.Context) error {
 	return Render(c, http.StatusOK, pages.About(c.Path()))
 }
 
-func DashboardHandler(c echo.Context) error {
-	return Render(c, http.StatusOK, pages.Dashboard())
+// DashboardHandler returns a handler rendering the default dashboard from the
+// store, together with the latest host metrics
+func DashboardHandler(store storage.Store, metrics *system.Collector, sessions *auth.Sessions) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		ctx := c.Request().Context()
+
+		dashboard, err := store.Dashboard(ctx, storage.DefaultDashboard)
+		if err != nil && !errors.Is(err, storage.ErrNotFound) {
+			return err
+		}
+
+		// Widgets above the role aren't fetched at all
+		role, _ := middleware.Role(c)
+		views := widgets.FetchAll(ctx, widgets.VisibleTo(dashboard.Definitions(), role))
+		status := pages.NewSystemStatus(metrics.Snapshot())
+		status.ActiveUsers = sessions.Active()
+
+		data := pages.NewDashboardData(storage.DefaultDashboard, views, status)
+		if account, ok := middleware.Account(c); ok {
+			data.Username, data.SignedIn = account.ID, true
+		}
+		return Render(c, http.StatusOK, pages.Dashboard(data))
+	}
+}
+
+// ServiceWorkerHandler serves service-worker.js from static. It's served
+// from the root rather than /static so its scope covers the whole site.
+// The script starts with PRECACHE, the hashed scripts and stylesheets of
+// manifest with their digests, so it changes whenever one of them does.
+// Only those are served from the cache, their content never changes.
+func ServiceWorkerHandler(static fs.FS, manifest *assets.Manifest) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		script, err := fs.ReadFile(static, "service-worker.js")
+		if err != nil {
+			return echo.ErrNotFound
+		}
+		hashed := []assets.Subresource{}
+		for _, s := range manifest.Subresources("js", "css") {
+			if manifest.Hashed(strings.TrimPrefix(s.URL, assets.Prefix)) {
+				hashed = append(hashed, s)
+			}
+		}
+		precache, err := json.Marshal(hashed)
+		if err != nil {
+			return err
+		}
+		var body bytes.Buffer
+		fmt.Fprintf(&body, "const PRECACHE = %s;\n\n", precache)
+		body.Write(script)
+
+		// Browsers check for a new worker on every visit, don't let them cache it
+		sum := sha256.Sum256(body.Bytes())
+		header := c.Response().Header()
+		header.Set(echo.HeaderCacheControl, "no-cache")
+		header.Set(echo.HeaderContentType, "text/javascript; charset=utf-8")
+		header.Set("ETag", `"`+hex.EncodeToString(sum[:16])+`"`)
+		http.ServeContent(c.Response(), c.Request(), "service-worker.js", time.Time{}, bytes.NewReader(body.Bytes()))
+		return nil
+	}
+}
+
+// ManifestHandler serves the web app manifest from static
+func ManifestHandler(static fs.FS) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		return serveFile(c, static, "manifest.json", "application/manifest+json")
+	}
 }
 
-func ServiceWorkerHandler(c echo.Context) error {
-	if err := middleware.Log(c); err != nil {
-		ansi.PrintError("Error logging request: " + err.Error())
+// serveFile serves name from fsys, with conditional and range requests
+func serveFile(c echo.Context, fsys fs.FS, name, contentType string) error {
+	if _, err := fs.Stat(fsys, name); err != nil {
+		return echo.ErrNotFound
 	}
-	return Render(c, http.StatusOK, ui.ServiceWorker())
+	c.Response().Header().Set(echo.HeaderContentType, contentType)
+	http.ServeFileFS(c.Response(), c.Request(), fsys, name)
+	return nil
 }
 
 func RobotsHandler(c echo.Context) error {
@@ -40,53 +121,59 @@ func NotFoundHandler(c echo.Context) error {
 	return Render(c, http.StatusNotFound, pages.NotFound())
 }
 
-func HealthHandler(c echo.Context) error {
-	return c.JSON(http.StatusOK, map[string]any{
-		"status":    "healthy",
-		"timestamp": http.StatusOK,
-		"version":   "1.0.1",
-		"services": map[string]string{
-			"css":    "available",
-			"static": "available",
-			"templ":  "available",
-		},
-	})
-}
-
-func prodcsp(ctx echo.Context) string {
-	if ctx.Get("environment") == "prod" {
-		return "upgrade-insecure-requests; block-all-mixed-content"
-	}
-	return ""
-}
-
-func getcsp(ctx echo.Context) {
-	ctx.Response().Header().Set("Content-Security-Policy",
-		fmt.Sprintf("default-src 'none'; script-src 'self' 'unsafe-eval' 'nonce-%s'; style-src 'self' 'unsafe-inline'; img-src 'self' *.github.com; font-src 'self'; connect-src 'self'; media-src 'self'; object-src 'none'; frame-src 'none'; base-uri 'self'; form-action 'self'; %s",
-			ctx.Get("nonce"), prodcsp(ctx)))
-}
+var renderDuration = metrics.NewHistogram("wasmdash_render_duration_seconds",
+	"Time taken to render pages with templ, by route.", metrics.DurationBuckets, "route")
 
 // Render replaces Echo's echo.Context.Render() with templ's templ.Component.Render()
 func Render(ctx echo.Context, statusCode int, t templ.Component) error {
 	buf := templ.GetBuffer()
 	defer templ.ReleaseBuffer(buf)
 
+	// Fail closed: without a secure nonce the page isn't rendered, there's
+	// no weaker one to fall back to
+	templCtx := ctx.Request().Context()
 	nonce, err := core.GenerateNonce()
 	if err != nil {
-		ansi.PrintError("Error generating nonce: " + err.Error())
+		middleware.Logger(ctx).Error("No nonce for the page, sending an error instead", "err", err)
+		statusCode, t = http.StatusInternalServerError, pages.ServerError()
+	} else {
+		templCtx = templ.WithNonce(templCtx, nonce)
+	}
+
+	// Set Content Security Policy with the nonce, if any
+	middleware.SetCSP(ctx, nonce)
 
-		nonce = "fallback-nonce"
+	start := time.Now()
+	err = ui.Layout(t, ctx.Path()).Render(templCtx, buf)
+	elapsed := time.Since(start)
+	timing.FromContext(templCtx).Add("render", "Render", elapsed)
+	renderDuration.Observe(elapsed.Seconds(), ctx.Path())
+	if err != nil {
+		return err
 	}
 
-	templCtx := templ.WithNonce(ctx.Request().Context(), nonce)
+	return writeHTML(ctx, statusCode, buf.Bytes())
+}
 
-	// Set Content Security Policy with proper nonce
-	ctx.Set("nonce", nonce)
-	getcsp(ctx)
+// compressMin is the smallest page worth compressing, about one packet
+const compressMin = 1400
 
-	if err := ui.Layout(t, nonce, ctx.Path()).Render(templCtx, buf); err != nil {
-		return err
+// writeHTML writes a page, compressed if the client accepts it
+func writeHTML(ctx echo.Context, statusCode int, page []byte) error {
+	if len(page) < compressMin {
+		return ctx.HTMLBlob(statusCode, page)
 	}
 
-	return ctx.HTML(statusCode, buf.String())
+	header := ctx.Response().Header()
+	header.Add(echo.HeaderVary, echo.HeaderAcceptEncoding)
+	encoding := assets.Negotiate(ctx.Request().Header.Get(echo.HeaderAcceptEncoding), assets.Brotli, assets.Gzip)
+	if encoding == assets.Identity {
+		return ctx.HTMLBlob(statusCode, page)
+	}
+	compressed, err := assets.Compress(encoding, page, assets.Fast)
+	if err != nil {
+		return err
+	}
+	header.Set(echo.HeaderContentEncoding, encoding)
+	return ctx.HTMLBlob(statusCode, compressed)
 }
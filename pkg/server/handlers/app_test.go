@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/labstack/echo/v4"
+	"github.com/pynezz/wasmdash/pkg/assets"
+)
+
+// TestServiceWorkerPrecache checks the PRECACHE of the service worker lists
+// the hashed scripts and stylesheets with the integrity pages load them with
+func TestServiceWorkerPrecache(t *testing.T) {
+	const script = "self.addEventListener(\"fetch\", () => {});\n"
+	static := fstest.MapFS{
+		"service-worker.js":    {Data: []byte(script)},
+		"js/app.js":            {Data: []byte("console.log('app');\n")},
+		"js/components.js":     {Data: []byte("document.addEventListener('alpine:init', () => {});\n")},
+		"css/styles.css":       {Data: []byte("body { margin: 0; }\n")},
+		"css/styles.css.br":    {Data: []byte("not a stylesheet of its own")},
+		"icons/icon-192.png":   {Data: []byte("\x89PNG")},
+		"fonts/inter.woff2":    {Data: []byte("wOF2")},
+		"manifest.json":        {Data: []byte("{}")},
+		"js/vendor/module.mjs": {Data: []byte("export default 1;\n")},
+	}
+	manifest, err := assets.New(static)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	get := func(manifest *assets.Manifest) string {
+		t.Helper()
+		e := echo.New()
+		rec := httptest.NewRecorder()
+		c := e.NewContext(httptest.NewRequest(http.MethodGet, "/service-worker.js", nil), rec)
+		if err := ServiceWorkerHandler(static, manifest)(c); err != nil {
+			t.Fatal(err)
+		}
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d", rec.Code)
+		}
+		return rec.Body.String()
+	}
+	precache := regexp.MustCompile(`^const PRECACHE = (.*);\n\n`)
+	parse := func(body string) []assets.Subresource {
+		t.Helper()
+		m := precache.FindStringSubmatch(body)
+		if m == nil {
+			t.Fatalf("no PRECACHE in\n%s", body)
+		}
+		if rest := strings.TrimPrefix(body, m[0]); rest != script {
+			t.Errorf("script after PRECACHE = %q, want %q", rest, script)
+		}
+		var entries []assets.Subresource
+		if err := json.Unmarshal([]byte(m[1]), &entries); err != nil {
+			t.Fatal(err)
+		}
+		return entries
+	}
+
+	entries := parse(get(manifest))
+	want := []string{"css/styles.css", "js/app.js", "js/components.js", "js/vendor/module.mjs"}
+	if len(entries) != len(want) {
+		t.Fatalf("PRECACHE = %v, want %v", entries, want)
+	}
+	for i, name := range want {
+		data, _ := static.ReadFile(name)
+		sum := sha512.Sum384(data)
+		integrity := "sha384-" + base64.StdEncoding.EncodeToString(sum[:])
+
+		got := entries[i]
+		if got.URL != manifest.URL(name) || !manifest.Hashed(strings.TrimPrefix(got.URL, assets.Prefix)) {
+			t.Errorf("%s: url = %s, want the hashed %s", name, got.URL, manifest.URL(name))
+		}
+		if got.Integrity != integrity || got.Integrity != manifest.Integrity(name) {
+			t.Errorf("%s: integrity = %s, want %s", name, got.Integrity, integrity)
+		}
+	}
+
+	// Nothing is hashed while files may change, so nothing is cached
+	if entries := parse(get(assets.Live(static))); len(entries) != 0 {
+		t.Errorf("live PRECACHE = %v, want none", entries)
+	}
+}
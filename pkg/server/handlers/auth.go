@@ -1 +1,107 @@
 package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/pynezz/wasmdash/pkg/auth"
+	"github.com/pynezz/wasmdash/pkg/server/middleware"
+	"github.com/pynezz/wasmdash/pkg/storage"
+	"github.com/pynezz/wasmdash/pkg/ui/pages"
+)
+
+// Auth serves the login page and signs accounts in and out
+type Auth struct {
+	store    storage.Store
+	sessions *auth.Sessions
+	cookie   middleware.SessionCookie
+}
+
+func NewAuth(store storage.Store, sessions *auth.Sessions, cookie middleware.SessionCookie) *Auth {
+	return &Auth{store: store, sessions: sessions, cookie: cookie}
+}
+
+// LoginPage handles GET /login
+func (a *Auth) LoginPage(c echo.Context) error {
+	next := safeNext(c.QueryParam("next"))
+	if _, ok := middleware.Account(c); ok {
+		return c.Redirect(http.StatusSeeOther, next)
+	}
+	return Render(c, http.StatusOK, pages.Login(pages.LoginData{Next: next}))
+}
+
+// Login handles POST /login
+func (a *Auth) Login(c echo.Context) error {
+	ctx := c.Request().Context()
+	data := pages.LoginData{
+		ID:   strings.TrimSpace(c.FormValue("id")),
+		Next: safeNext(c.FormValue("next")),
+	}
+	password := c.FormValue("password")
+
+	account, err := a.store.Account(ctx, data.ID)
+	if errors.Is(err, storage.ErrNotFound) || data.ID == "" {
+		auth.VerifyNothing(password)
+		return a.failed(c, data)
+	} else if err != nil {
+		return err
+	}
+
+	ok, err := auth.VerifyPassword(account.Password, password)
+	if err != nil {
+		middleware.Logger(c).Error("Verifying password", "account", account.ID, "error", err)
+	}
+	if !ok {
+		return a.failed(c, data)
+	}
+
+	// Upgrade hashes made with older parameters while the password is at hand
+	if auth.NeedsRehash(account.Password) {
+		if hash, err := auth.HashPassword(password); err == nil {
+			account.Password = hash
+			if err := a.store.SaveAccount(ctx, account); err != nil {
+				middleware.Logger(c).Warn("Rehashing password", "account", account.ID, "error", err)
+			}
+		}
+	}
+
+	// A new token on every login, a session planted before can't be taken over
+	if token, ok := a.cookie.Token(c.Request()); ok {
+		a.sessions.Delete(token)
+	}
+	token, session, err := a.sessions.Create(account.ID)
+	if err != nil {
+		return err
+	}
+	c.SetCookie(a.cookie.New(token, session))
+	middleware.Logger(c).Info("Account signed in", "account", account.ID)
+	return c.Redirect(http.StatusSeeOther, data.Next)
+}
+
+// Logout handles POST /logout
+func (a *Auth) Logout(c echo.Context) error {
+	if token, ok := a.cookie.Token(c.Request()); ok {
+		a.sessions.Delete(token)
+	}
+	c.SetCookie(a.cookie.Clear())
+	return c.Redirect(http.StatusSeeOther, "/login")
+}
+
+// failed renders the login page again, without telling whether the account
+// or the password was wrong
+func (a *Auth) failed(c echo.Context, data pages.LoginData) error {
+	middleware.Logger(c).Warn("Failed login", "account", data.ID, "remote", c.RealIP())
+	data.Error = "Invalid username or password"
+	return Render(c, http.StatusUnauthorized, pages.Login(data))
+}
+
+// safeNext returns where to go after signing in, only allowing paths on
+// this site so the login page can't be used as an open redirect
+func safeNext(next string) string {
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.ContainsAny(next, "\\\r\n") {
+		return "/dashboard"
+	}
+	return next
+}
@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/pynezz/wasmdash/pkg/csp"
+	"github.com/pynezz/wasmdash/pkg/metrics"
+	"github.com/pynezz/wasmdash/pkg/server/middleware"
+)
+
+var cspViolations = metrics.NewCounter("wasmdash_csp_violations_total",
+	"Content-Security-Policy violations reported by browsers, by directive.", "directive")
+
+// maxReports bounds the violations logged from one request
+const maxReports = 20
+
+// violation is a CSP violation report, in either format
+type violation struct {
+	Document  string
+	Blocked   string
+	Directive string
+	Source    string
+	Line      int
+	Sample    string
+	Mode      string // enforce or report
+}
+
+// legacyReport is the body browsers send to report-uri, as application/csp-report
+type legacyReport struct {
+	Report struct {
+		DocumentURI        string `json:"document-uri"`
+		BlockedURI         string `json:"blocked-uri"`
+		ViolatedDirective  string `json:"violated-directive"`
+		EffectiveDirective string `json:"effective-directive"`
+		SourceFile         string `json:"source-file"`
+		LineNumber         int    `json:"line-number"`
+		ScriptSample       string `json:"script-sample"`
+		Disposition        string `json:"disposition"`
+	} `json:"csp-report"`
+}
+
+// report is an entry of the Reporting API, sent as application/reports+json
+type report struct {
+	Type string `json:"type"`
+	Body struct {
+		DocumentURL        string `json:"documentURL"`
+		BlockedURL         string `json:"blockedURL"`
+		EffectiveDirective string `json:"effectiveDirective"`
+		SourceFile         string `json:"sourceFile"`
+		LineNumber         int    `json:"lineNumber"`
+		Sample             string `json:"sample"`
+		Disposition        string `json:"disposition"`
+	} `json:"body"`
+}
+
+// CSPReport handles POST /csp-report, logging and counting the violations
+// browsers report with report-uri or the Reporting API
+func CSPReport(c echo.Context) error {
+	body, err := io.ReadAll(c.Request().Body)
+	if err != nil {
+		return err
+	}
+	violations, err := parseViolations(body)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "not a CSP violation report")
+	}
+
+	logger := middleware.Logger(c)
+	for i, v := range violations {
+		directive := v.Directive
+		if !slices.Contains(csp.Directives, directive) {
+			directive = "other"
+		}
+		cspViolations.Inc(directive)
+		if i < maxReports {
+			logger.Warn("CSP violation", "directive", v.Directive, "blocked", v.Blocked, "document", v.Document,
+				"source", v.Source, "line", v.Line, "sample", v.Sample, "mode", v.Mode)
+		}
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// parseViolations reads a report-uri body, an object, or a Reporting API
+// body, an array of reports of which only csp-violation ones are kept
+func parseViolations(body []byte) ([]violation, error) {
+	body = bytes.TrimSpace(body)
+	if bytes.HasPrefix(body, []byte("[")) {
+		var reports []report
+		if err := json.Unmarshal(body, &reports); err != nil {
+			return nil, err
+		}
+		var violations []violation
+		for _, r := range reports {
+			if r.Type != "csp-violation" {
+				continue
+			}
+			violations = append(violations, violation{
+				Document:  r.Body.DocumentURL,
+				Blocked:   r.Body.BlockedURL,
+				Directive: r.Body.EffectiveDirective,
+				Source:    r.Body.SourceFile,
+				Line:      r.Body.LineNumber,
+				Sample:    r.Body.Sample,
+				Mode:      r.Body.Disposition,
+			})
+		}
+		return violations, nil
+	}
+
+	var legacy legacyReport
+	if err := json.Unmarshal(body, &legacy); err != nil {
+		return nil, err
+	}
+	r := legacy.Report
+	directive := r.EffectiveDirective
+	if directive == "" {
+		// Older browsers only send the violated directive with its sources
+		directive, _, _ = strings.Cut(r.ViolatedDirective, " ")
+	}
+	if directive == "" {
+		return nil, errors.New("no directive")
+	}
+	return []violation{{
+		Document:  r.DocumentURI,
+		Blocked:   r.BlockedURI,
+		Directive: directive,
+		Source:    r.SourceFile,
+		Line:      r.LineNumber,
+		Sample:    r.ScriptSample,
+		Mode:      r.Disposition,
+	}}, nil
+}
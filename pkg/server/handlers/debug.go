@@ -313,7 +313,7 @@ func MobileDetectHandler(port string) echo.HandlerFunc {
 				"test_urls": []string{
 					"/test/css - Interactive CSS test",
 					"/debug/css - Detailed CSS debug info",
-					"/health - Server health check",
+					"/health - Health checks, version and uptime",
 					cssURL + " - Direct CSS file access",
 				},
 			},
@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/pynezz/wasmdash/pkg/server/middleware"
+	"github.com/pynezz/wasmdash/pkg/ui/pages"
+)
+
+// ErrorHandler answers the errors handlers and middleware return, Echo's
+// HTTPErrorHandler. The API, health, metrics and clients asking for JSON get
+// problem details, browsers an error page, static files a line of text.
+// Errors other than a Problem or echo.HTTPError are a 500, their detail
+// stays in the request log: Metrics returns the error after passing it
+// here, and RequestLog logs it with statuses from 500.
+func ErrorHandler(err error, c echo.Context) {
+	if c.Response().Committed {
+		return
+	}
+
+	var (
+		p  *Problem
+		he *echo.HTTPError
+	)
+	switch {
+	case errors.As(err, &p):
+	case errors.As(err, &he):
+		p = problem(he.Code, "%v", he.Message)
+	default:
+		p = problem(http.StatusInternalServerError, "the request could not be completed")
+	}
+
+	// Headers set for the response that failed, like the type of a
+	// static file, don't describe this one
+	c.Response().Header().Del(echo.HeaderContentType)
+
+	r := c.Request()
+	switch {
+	case r.Method == http.MethodHead:
+		err = c.NoContent(p.Status)
+	case wantsProblem(r):
+		c.Response().Header().Set(echo.HeaderContentType, MIMEProblemJSON)
+		err = c.JSON(p.Status, p)
+	case middleware.Classify(r.URL.Path) == middleware.ClassStatic:
+		err = c.String(p.Status, p.Title)
+	default:
+		// Server errors don't tell visitors more than the status
+		detail := p.Detail
+		if p.Status >= 500 || detail == p.Title {
+			detail = ""
+		}
+		if err = Render(c, p.Status, pages.Error(p.Status, detail)); err != nil {
+			err = c.String(p.Status, p.Title)
+		}
+	}
+	if err != nil {
+		middleware.Logger(c).Error("Sending error response", "err", err)
+	}
+}
+
+// wantsProblem reports whether r is answered with problem details: requests
+// to the API, health and metrics, and clients asking for JSON but not HTML
+func wantsProblem(r *http.Request) bool {
+	if middleware.Classify(r.URL.Path) == middleware.ClassAPI {
+		return true
+	}
+	accept := r.Header.Get(echo.HeaderAccept)
+	return strings.Contains(accept, "json") && !strings.Contains(accept, echo.MIMETextHTML)
+}
@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/pynezz/wasmdash/pkg/server/middleware"
+)
+
+// TestErrorHandlerInternal checks errors other than a Problem are answered
+// with a 500 that doesn't tell their detail, which the request log keeps
+func TestErrorHandlerInternal(t *testing.T) {
+	const detail = "disk on fire"
+
+	tests := []struct {
+		name, path, accept, contentType string
+	}{
+		{"page", "/dashboard", echo.MIMETextHTML, echo.MIMETextHTMLCharsetUTF8},
+		{"json", "/dashboard", echo.MIMEApplicationJSON, MIMEProblemJSON},
+		{"api", "/api/widgets", "", MIMEProblemJSON},
+		{"static", "/static/js/app.js", "", echo.MIMETextPlainCharsetUTF8},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var log bytes.Buffer
+			e := echo.New()
+			e.HTTPErrorHandler = ErrorHandler
+			e.Use(middleware.RequestLog(slog.New(slog.NewTextHandler(&log, nil)), 0))
+			e.Use(middleware.Metrics())
+			e.GET(tt.path, func(c echo.Context) error { return errors.New(detail) })
+
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.accept != "" {
+				req.Header.Set(echo.HeaderAccept, tt.accept)
+			}
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusInternalServerError {
+				t.Errorf("status = %d, want 500", rec.Code)
+			}
+			if got := rec.Header().Get(echo.HeaderContentType); got != tt.contentType {
+				t.Errorf("Content-Type = %q, want %q", got, tt.contentType)
+			}
+			if strings.Contains(rec.Body.String(), detail) {
+				t.Errorf("response tells the error: %s", rec.Body)
+			}
+			if !strings.Contains(log.String(), `error="`+detail+`"`) {
+				t.Errorf("request log lacks the error: %s", log.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/pynezz/wasmdash/pkg/auth"
+	"github.com/pynezz/wasmdash/pkg/health"
+	"github.com/pynezz/wasmdash/pkg/server/middleware"
+)
+
+// Health serves the health of the server for monitoring and orchestrators
+type Health struct {
+	checks  *health.Registry
+	version string
+	built   string
+	started time.Time
+}
+
+func NewHealth(checks *health.Registry, version, built string) *Health {
+	return &Health{checks: checks, version: version, built: built, started: time.Now()}
+}
+
+// Livez handles GET /livez: the process is up and serving, nothing is checked
+func (h *Health) Livez(c echo.Context) error {
+	c.Response().Header().Set(echo.HeaderCacheControl, "no-store")
+	return c.JSON(http.StatusOK, map[string]health.Status{"status": health.StatusOK})
+}
+
+// Readyz handles GET /readyz, 503 while a required check fails
+func (h *Health) Readyz(c echo.Context) error {
+	report := h.run(c)
+	return c.JSON(statusCode(report), report)
+}
+
+// Health handles GET /health, the report of /readyz with the build and uptime
+func (h *Health) Health(c echo.Context) error {
+	report := h.run(c)
+	return c.JSON(statusCode(report), struct {
+		health.Report
+		Version string `json:"version"`
+		Built   string `json:"built,omitempty"`
+		Uptime  string `json:"uptime"`
+	}{report, h.version, h.built, time.Since(h.started).Round(time.Second).String()})
+}
+
+// run runs the checks. Their errors may name files and hosts, only admins
+// see them.
+func (h *Health) run(c echo.Context) health.Report {
+	c.Response().Header().Set(echo.HeaderCacheControl, "no-store")
+	report := h.checks.Run(c.Request().Context())
+	if role, _ := middleware.Role(c); role < auth.RoleAdmin {
+		for i := range report.Checks {
+			report.Checks[i].Error = ""
+		}
+	}
+	return report
+}
+
+func statusCode(report health.Report) int {
+	if report.Ready() {
+		return http.StatusOK
+	}
+	return http.StatusServiceUnavailable
+}
@@ -0,0 +1,19 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/pynezz/wasmdash/pkg/metrics"
+)
+
+// MetricsHandler serves the metrics of registry in the Prometheus text format
+func MetricsHandler(registry *metrics.Registry) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		header := c.Response().Header()
+		header.Set(echo.HeaderContentType, metrics.ContentType)
+		header.Set(echo.HeaderCacheControl, "no-store")
+		c.Response().WriteHeader(http.StatusOK)
+		return registry.WriteText(c.Response())
+	}
+}
@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/pynezz/wasmdash/pkg/auth"
+	"github.com/pynezz/wasmdash/pkg/server/middleware"
+	"github.com/pynezz/wasmdash/pkg/storage"
+	"github.com/pynezz/wasmdash/pkg/ui/pages"
+)
+
+// tokenTTLs are the choices of how long a token issued at /admin/tokens is valid
+var tokenTTLs = []pages.TokenTTL{
+	{Label: "1 day", Value: "24h0m0s"},
+	{Label: "7 days", Value: "168h0m0s"},
+	{Label: "30 days", Value: "720h0m0s"},
+	{Label: "90 days", Value: "2160h0m0s"},
+	{Label: "1 year", Value: "8760h0m0s"},
+}
+
+// Tokens serves the admin page listing, issuing and revoking API tokens
+type Tokens struct {
+	store  storage.Store
+	signer *auth.Signer // Nil if tokens can't be issued
+}
+
+func NewTokens(store storage.Store, signer *auth.Signer) *Tokens {
+	return &Tokens{store: store, signer: signer}
+}
+
+// Page handles GET /admin/tokens
+func (t *Tokens) Page(c echo.Context) error {
+	return t.render(c, http.StatusOK, pages.TokensData{
+		Form: pages.TokenForm{Scope: auth.ScopeRead, TTL: tokenTTLs[2].Value},
+	})
+}
+
+// Issue handles POST /admin/tokens, showing the new token once
+func (t *Tokens) Issue(c echo.Context) error {
+	form := pages.TokenForm{
+		Name:    strings.TrimSpace(c.FormValue("name")),
+		Account: c.FormValue("account"),
+		Scope:   c.FormValue("scope"),
+		TTL:     c.FormValue("ttl"),
+	}
+	data := pages.TokensData{Form: form}
+	if t.signer == nil {
+		return echo.NewHTTPError(http.StatusNotFound, "issuing tokens needs [api] signing_key")
+	}
+
+	ttl, err := time.ParseDuration(form.TTL)
+	if err != nil {
+		data.Error = "Choose how long the token is valid"
+		return t.render(c, http.StatusUnprocessableEntity, data)
+	}
+	signed, issued, err := storage.IssueToken(c.Request().Context(), t.store, t.signer, auth.Token{
+		Name:    form.Name,
+		Account: form.Account,
+		Scopes:  []string{form.Scope},
+	}, ttl)
+	if err != nil {
+		data.Error = "Can't issue the token: " + err.Error()
+		return t.render(c, http.StatusUnprocessableEntity, data)
+	}
+
+	middleware.Logger(c).Info("API token issued", "token", issued.ID, "account", issued.Account, "scope", form.Scope)
+	data.Issued, data.Form = signed, pages.TokenForm{Scope: form.Scope, TTL: form.TTL}
+	// The token is in the page, keep it out of caches and history
+	c.Response().Header().Set(echo.HeaderCacheControl, "no-store")
+	return t.render(c, http.StatusCreated, data)
+}
+
+// Revoke handles POST /admin/tokens/:id/revoke
+func (t *Tokens) Revoke(c echo.Context) error {
+	id := c.Param("id")
+	if err := t.store.RevokeToken(c.Request().Context(), id, time.Now()); errors.Is(err, storage.ErrNotFound) {
+		return echo.NewHTTPError(http.StatusNotFound, "no such token")
+	} else if err != nil {
+		return err
+	}
+	middleware.Logger(c).Info("API token revoked", "token", id)
+	return c.Redirect(http.StatusSeeOther, "/admin/tokens")
+}
+
+// render fills in the tokens and accounts and renders the page
+func (t *Tokens) render(c echo.Context, status int, data pages.TokensData) error {
+	ctx := c.Request().Context()
+	tokens, err := t.store.Tokens(ctx)
+	if err != nil {
+		return err
+	}
+	accounts, err := t.store.Accounts(ctx)
+	if err != nil {
+		return err
+	}
+
+	data.Tokens, data.TTLs, data.Now = tokens, tokenTTLs, time.Now()
+	data.CanIssue = t.signer != nil
+	for _, account := range accounts {
+		data.Accounts = append(data.Accounts, account.ID)
+	}
+	return Render(c, status, pages.Tokens(data))
+}
@@ -0,0 +1,44 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/pynezz/wasmdash/pkg/ui/widgets"
+)
+
+// widgetFailures is how far back the widgets check looks for failed fetches
+const widgetFailures = 5 * time.Minute
+
+// registerChecks adds the health checks of the server's own components to
+// Config.Health, see pkg/health
+func (s *Server) registerChecks() {
+	checks := s.config.Health
+	checks.Register("server", time.Second, func(context.Context) error {
+		if s.ctx.Err() != nil {
+			return errors.New("shutting down")
+		}
+		return nil
+	})
+	checks.Register("store", 2*time.Second, s.store.Ping)
+	checks.Register("static", time.Second, func(context.Context) error {
+		_, err := fs.Stat(s.static, "css/styles.css")
+		return err
+	})
+	// A widget failing, say because its service is down, doesn't stop the
+	// dashboard from working
+	checks.RegisterOptional("widgets", time.Second, func(context.Context) error {
+		failed := widgets.FetchErrors(time.Now().Add(-widgetFailures))
+		if len(failed) == 0 {
+			return nil
+		}
+		ids := slices.Sorted(maps.Keys(failed))
+		return fmt.Errorf("%d widget(s) failed to fetch their data: %s", len(ids), strings.Join(ids, ", "))
+	})
+}
@@ -0,0 +1,213 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math"
+	"slices"
+	"time"
+
+	"github.com/a-h/templ"
+	"github.com/pynezz/wasmdash/pkg/auth"
+	"github.com/pynezz/wasmdash/pkg/storage"
+	"github.com/pynezz/wasmdash/pkg/system"
+	"github.com/pynezz/wasmdash/pkg/ui/pages"
+	"github.com/pynezz/wasmdash/pkg/ui/widgets"
+)
+
+/*
+ * Live dashboard updates, published on the Hub and applied by static/js/live.js:
+ *
+ *   swap    {"dashboard", "target", "html"}  Replace the element with ID target
+ *   layout  {"dashboard", "widgets",         IDs of the widgets in layout order and the
+ *            "styles"}                       version of their styles, the page reloads if
+ *                                            either differs from its own
+ *   resync  {}                               Events were lost, the page reloads
+ *
+ * Widgets are re-rendered whenever their dashboard is changed through the
+ * store, and those implementing widgets.Refresher on their own interval
+ * while anyone is watching. The system status card follows the metrics.
+ * Cards of widgets with a min_role only go to clients with that role, and
+ * each client gets the layout of only the widgets its role may see.
+ */
+
+// swapEvent replaces an element of a dashboard page, or of any page
+// showing the target if Dashboard is empty
+type swapEvent struct {
+	Dashboard string `json:"dashboard,omitempty"`
+	Target    string `json:"target"`
+	HTML      string `json:"html"`
+}
+
+type layoutEvent struct {
+	Dashboard string   `json:"dashboard"`
+	Widgets   []string `json:"widgets"`
+	Styles    string   `json:"styles"` // See pages.StylesVersion
+}
+
+// dashboardChanged queues a changed dashboard for publishing, without
+// blocking the request that changed it
+func (s *Server) dashboardChanged(id string) {
+	select {
+	case s.changed <- id:
+	default:
+		log.Printf("Live updates are behind, dropped change of dashboard %s", id)
+	}
+}
+
+// publishChanges publishes queued dashboard changes until ctx is done
+func (s *Server) publishChanges(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case id := <-s.changed:
+			if err := s.publishDashboard(ctx, id); err != nil {
+				log.Printf("Publishing dashboard %s: %v", id, err)
+			}
+		}
+	}
+}
+
+// publishDashboard pushes the layout and every widget of a dashboard
+func (s *Server) publishDashboard(ctx context.Context, id string) error {
+	d, err := s.config.Store.Dashboard(ctx, id)
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		return err
+	}
+	defs := d.Definitions()
+
+	// Roles between two min_roles see the same widgets, each range gets
+	// the layout of those
+	levels := []int{auth.RoleGuest}
+	for _, def := range defs {
+		levels = append(levels, def.Widget.MinRole)
+	}
+	slices.Sort(levels)
+	levels = slices.Compact(levels)
+	for i, level := range levels {
+		maxRole := math.MaxInt
+		if i+1 < len(levels) {
+			maxRole = levels[i+1] - 1
+		}
+		visible := widgets.VisibleTo(defs, level)
+		layout := layoutEvent{Dashboard: id, Widgets: []string{}, Styles: pages.StylesVersion(visible)}
+		for _, def := range visible {
+			// Hidden widgets have no card on the page to compare with
+			if !def.Widget.Hidden {
+				layout.Widgets = append(layout.Widgets, def.Widget.ID)
+			}
+		}
+		if err := s.hub.PublishRoles(level, maxRole, "layout", layout); err != nil {
+			return err
+		}
+	}
+	return s.publishWidgets(ctx, id, widgets.FetchAll(ctx, defs))
+}
+
+// publishWidgets pushes the cards of fetched widgets
+func (s *Server) publishWidgets(ctx context.Context, id string, views []widgets.View) error {
+	for _, view := range views {
+		html, err := renderHTML(ctx, pages.WidgetCard(view))
+		if err != nil {
+			return err
+		}
+		event := swapEvent{Dashboard: id, Target: pages.WidgetElementID(view), HTML: html}
+		if err := s.hub.PublishTo(view.Widget.MinRole, "swap", event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// refreshWidgets re-publishes widgets implementing widgets.Refresher as
+// their intervals pass, until ctx is done
+func (s *Server) refreshWidgets(ctx context.Context) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	due := make(map[string]time.Time) // By dashboard and widget ID
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if s.hub.Clients() == 0 {
+				continue
+			}
+			var err error
+			if due, err = s.refreshDue(ctx, now, due); err != nil {
+				log.Printf("Refreshing widgets: %v", err)
+			}
+		}
+	}
+}
+
+// refreshDue publishes the widgets due at now, and returns when they're
+// due next. Widgets that no longer exist are forgotten.
+func (s *Server) refreshDue(ctx context.Context, now time.Time, due map[string]time.Time) (map[string]time.Time, error) {
+	list, err := s.config.Store.Dashboards(ctx)
+	if err != nil {
+		return due, err
+	}
+
+	next := make(map[string]time.Time, len(due))
+	for _, summary := range list {
+		d, err := s.config.Store.Dashboard(ctx, summary.ID)
+		if errors.Is(err, storage.ErrNotFound) {
+			continue
+		} else if err != nil {
+			return due, err
+		}
+
+		var stale []widgets.Definition
+		for _, def := range d.Definitions() {
+			r, ok := def.Kind.(widgets.Refresher)
+			if !ok || r.RefreshInterval() <= 0 {
+				continue
+			}
+			key := d.ID + "/" + def.Widget.ID
+			next[key] = due[key]
+			if now.Before(due[key]) {
+				continue
+			}
+			next[key] = now.Add(r.RefreshInterval())
+			stale = append(stale, def)
+		}
+		if len(stale) == 0 {
+			continue
+		}
+		if err := s.publishWidgets(ctx, d.ID, widgets.FetchAll(ctx, stale)); err != nil {
+			return next, err
+		}
+	}
+	return next, nil
+}
+
+// publishSystemStatus pushes the system status card for a new metrics sample
+func (s *Server) publishSystemStatus(snap system.Snapshot) {
+	if s.hub.Clients() == 0 {
+		return
+	}
+	status := pages.NewSystemStatus(snap)
+	status.ActiveUsers = s.sessions.Active()
+	html, err := renderHTML(context.Background(), pages.SystemStatusCard(status))
+	if err != nil {
+		log.Printf("Rendering system status: %v", err)
+		return
+	}
+	if err := s.hub.Publish("swap", swapEvent{Target: pages.SystemStatusID, HTML: html}); err != nil {
+		log.Printf("Publishing system status: %v", err)
+	}
+}
+
+func renderHTML(ctx context.Context, c templ.Component) (string, error) {
+	buf := templ.GetBuffer()
+	defer templ.ReleaseBuffer(buf)
+
+	if err := c.Render(ctx, buf); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
@@ -0,0 +1,19 @@
+package server
+
+import "github.com/pynezz/wasmdash/pkg/metrics"
+
+// buildInfo describes the build in its labels, like /health does
+var buildInfo = metrics.NewGauge("wasmdash_build_info", "Version of wasmdash running, always 1.", "version", "built")
+
+// registerMetrics adds the metrics of the server's own components to
+// metrics.Default, see pkg/metrics. Requests, renders and widget fetches are
+// counted where they happen.
+func (s *Server) registerMetrics() {
+	buildInfo.Set(1, s.config.Version, s.config.BuildTime)
+	metrics.NewGaugeFunc("wasmdash_sse_clients", "Clients connected to /events for live updates.", func() float64 {
+		return float64(s.hub.Clients())
+	})
+	metrics.NewGaugeFunc("wasmdash_sessions_active", "Signed in sessions that haven't expired.", func() float64 {
+		return float64(s.sessions.Active())
+	})
+}
@@ -0,0 +1,140 @@
+package middleware
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/pynezz/wasmdash/pkg/auth"
+)
+
+// TokenCheck resolves a signed API token to the account it acts for,
+// see storage.CheckToken
+type TokenCheck func(ctx context.Context, token string) (auth.Account, error)
+
+// Tokens are the bearer tokens the API accepts
+type Tokens struct {
+	Static string     // [api] token, acting as admin
+	Signed TokenCheck // Signed tokens, nil without [api] signing_key
+}
+
+// LoopbackOrToken lets requests from the local machine through, and requests
+// from anywhere else only with `Authorization: Bearer <token>`.
+// Without any tokens, only loopback is allowed. host is the configured
+// host, the only name besides localhost loopback requests may be sent to.
+func LoopbackOrToken(host string, tokens Tokens) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if _, ok := BearerToken(c.Request()); ok {
+				return checkToken(c, tokens, next)
+			}
+
+			if IsLoopback(c.Request(), host) {
+				c.Set(trustedKey, true)
+				return next(c)
+			}
+			if tokens.Static == "" && tokens.Signed == nil {
+				return echo.NewHTTPError(http.StatusForbidden, "the API only accepts requests from loopback, set [api] token to allow remote access")
+			}
+			c.Response().Header().Set(echo.HeaderWWWAuthenticate, "Bearer")
+			return echo.NewHTTPError(http.StatusUnauthorized, "missing API token")
+		}
+	}
+}
+
+// checkToken lets the request through if its bearer token is the static
+// token, or a signed token acting for an account, see Account and Role
+func checkToken(c echo.Context, tokens Tokens, next echo.HandlerFunc) error {
+	bearer, _ := BearerToken(c.Request())
+	if tokens.Static != "" && subtle.ConstantTimeCompare([]byte(bearer), []byte(tokens.Static)) == 1 {
+		c.Set(trustedKey, true)
+		return next(c)
+	}
+
+	if tokens.Signed != nil && auth.LooksLikeToken(bearer) {
+		account, err := tokens.Signed(c.Request().Context(), bearer)
+		switch {
+		case err == nil:
+			c.Set(accountKey, account)
+			return next(c)
+		case errors.Is(err, auth.ErrExpiredToken):
+			c.Response().Header().Set(echo.HeaderWWWAuthenticate, `Bearer error="invalid_token", error_description="expired"`)
+			return echo.NewHTTPError(http.StatusUnauthorized, "API token expired")
+		case !errors.Is(err, auth.ErrInvalidToken):
+			return err
+		}
+	}
+
+	c.Response().Header().Set(echo.HeaderWWWAuthenticate, `Bearer error="invalid_token"`)
+	return echo.NewHTTPError(http.StatusUnauthorized, "invalid API token")
+}
+
+// BearerToken returns the token of an `Authorization: Bearer` header
+func BearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get(echo.HeaderAuthorization), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") || token == "" {
+		return "", false
+	}
+	return strings.TrimSpace(token), true
+}
+
+// IsLoopback reports whether the request was made from the local machine.
+// Proxied requests are never local: behind a reverse proxy on the same host
+// every connection comes from loopback, whoever made the original request.
+//
+// A browser on the local machine connects from loopback too, for any site
+// it shows. So the request must also be addressed to localhost or host,
+// which a DNS rebinding site can't send, and not come from another origin.
+func IsLoopback(r *http.Request, host string) bool {
+	for _, header := range []string{echo.HeaderXForwardedFor, echo.HeaderXRealIP, "Forwarded"} {
+		if r.Header.Get(header) != "" {
+			return false
+		}
+	}
+
+	remote, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return false
+	}
+	if ip := net.ParseIP(remote); ip == nil || !ip.IsLoopback() {
+		return false
+	}
+	return loopbackHost(r.Host, host) && !crossOrigin(r)
+}
+
+// loopbackHost reports whether the Host header names this machine: localhost,
+// a loopback address or the configured host
+func loopbackHost(header, host string) bool {
+	name := header
+	if h, _, err := net.SplitHostPort(header); err == nil {
+		name = h
+	}
+	name = strings.TrimSuffix(strings.Trim(name, "[]"), ".")
+	if strings.EqualFold(name, "localhost") {
+		return true
+	}
+	if ip := net.ParseIP(name); ip != nil {
+		return ip.IsLoopback()
+	}
+	return name != "" && strings.EqualFold(name, host)
+}
+
+// crossOrigin reports whether a browser sent the request from another
+// origin, other sites can't act with the local machine's trust
+func crossOrigin(r *http.Request) bool {
+	if origin := r.Header.Get(echo.HeaderOrigin); origin != "" {
+		if u, err := url.Parse(origin); err != nil || u.Host != r.Host {
+			return true
+		}
+	}
+	switch r.Header.Get("Sec-Fetch-Site") {
+	case "", "same-origin", "none":
+		return false
+	}
+	return true
+}
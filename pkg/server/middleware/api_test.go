@@ -0,0 +1,57 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestLoopbackOrToken(t *testing.T) {
+	tests := []struct {
+		name    string
+		remote  string
+		host    string
+		headers map[string]string
+		want    int
+	}{
+		{"localhost", "127.0.0.1:5555", "localhost:8080", nil, http.StatusOK},
+		{"loopback address", "127.0.0.1:5555", "127.0.0.1:8080", nil, http.StatusOK},
+		{"ipv6", "[::1]:5555", "[::1]:8080", nil, http.StatusOK},
+		{"configured host", "127.0.0.1:5555", "Dash.lan:8080", nil, http.StatusOK},
+		{"same origin", "127.0.0.1:5555", "localhost:8080", map[string]string{
+			"Origin": "http://localhost:8080", "Sec-Fetch-Site": "same-origin",
+		}, http.StatusOK},
+		{"typed by the user", "127.0.0.1:5555", "localhost:8080", map[string]string{"Sec-Fetch-Site": "none"}, http.StatusOK},
+
+		{"remote", "192.0.2.7:5555", "localhost:8080", nil, http.StatusForbidden},
+		{"proxied", "127.0.0.1:5555", "localhost:8080", map[string]string{"X-Forwarded-For": "192.0.2.7"}, http.StatusForbidden},
+		{"rebound name", "127.0.0.1:5555", "evil.example:8080", nil, http.StatusForbidden},
+		{"no host", "127.0.0.1:5555", "", nil, http.StatusForbidden},
+		{"other origin", "127.0.0.1:5555", "localhost:8080", map[string]string{"Origin": "https://evil.example"}, http.StatusForbidden},
+		{"other port", "127.0.0.1:5555", "localhost:8080", map[string]string{"Origin": "http://localhost:3000"}, http.StatusForbidden},
+		{"cross site", "127.0.0.1:5555", "localhost:8080", map[string]string{"Sec-Fetch-Site": "cross-site"}, http.StatusForbidden},
+		{"same site", "127.0.0.1:5555", "localhost:8080", map[string]string{"Sec-Fetch-Site": "same-site"}, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := echo.New()
+			e.GET("/api/v1/dashboards", func(c echo.Context) error {
+				return c.NoContent(http.StatusOK)
+			}, LoopbackOrToken("dash.lan", Tokens{}))
+
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/dashboards", nil)
+			req.RemoteAddr = tt.remote
+			req.Host = tt.host
+			for name, value := range tt.headers {
+				req.Header.Set(name, value)
+			}
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
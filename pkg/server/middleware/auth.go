@@ -0,0 +1,189 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/pynezz/wasmdash/pkg/auth"
+)
+
+// echo.Context keys set by the middleware in this file
+const (
+	accountKey     = "account"      // The auth.Account signed in or acting through a token
+	authEnabledKey = "auth_enabled" // Set on every request if Authenticate is in use
+	trustedKey     = "trusted"      // Let in by API token or from loopback
+)
+
+// SessionCookie configures the cookie holding the session token
+type SessionCookie struct {
+	Name   string
+	Secure bool // Only sent over HTTPS, required in production
+}
+
+// NewSessionCookie returns the session cookie settings. Secure cookies use
+// the __Host- prefix, which browsers only accept from HTTPS for the whole
+// site, so they can't be set or shadowed by a subdomain.
+func NewSessionCookie(secure bool) SessionCookie {
+	if secure {
+		return SessionCookie{Name: "__Host-wasmdash_session", Secure: true}
+	}
+	return SessionCookie{Name: "wasmdash_session"}
+}
+
+// New returns the cookie for a session token, expiring with the session
+func (sc SessionCookie) New(token string, session auth.Session) *http.Cookie {
+	return &http.Cookie{
+		Name:     sc.Name,
+		Value:    token,
+		Path:     "/",
+		Expires:  session.Expires,
+		HttpOnly: true,
+		Secure:   sc.Secure,
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+// Clear returns a cookie removing the session cookie
+func (sc SessionCookie) Clear() *http.Cookie {
+	return &http.Cookie{
+		Name:     sc.Name,
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   sc.Secure,
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+// Token returns the session token sent with the request
+func (sc SessionCookie) Token(r *http.Request) (string, bool) {
+	cookie, err := r.Cookie(sc.Name)
+	if err != nil || cookie.Value == "" {
+		return "", false
+	}
+	return cookie.Value, true
+}
+
+// Authenticate loads the account of the session cookie, if there's a valid
+// one, for Account and RequireLogin. The account is looked up on every
+// request, so deleting it or changing its role takes effect immediately.
+func Authenticate(sessions *auth.Sessions, cookie SessionCookie, lookup func(ctx context.Context, id string) (auth.Account, error)) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			c.Set(authEnabledKey, true)
+
+			token, ok := cookie.Token(c.Request())
+			if !ok {
+				return next(c)
+			}
+			session, ok := sessions.Get(token)
+			if !ok {
+				return next(c)
+			}
+			account, err := lookup(c.Request().Context(), session.AccountID)
+			if err != nil {
+				// Deleted, or the store is unavailable: treat as signed out
+				Logger(c).Warn("Looking up the account of a session", "account", session.AccountID, "error", err)
+				return next(c)
+			}
+			c.Set(accountKey, account)
+			return next(c)
+		}
+	}
+}
+
+// Account returns the signed in account, set by Authenticate
+func Account(c echo.Context) (auth.Account, bool) {
+	account, ok := c.Get(accountKey).(auth.Account)
+	return account, ok
+}
+
+// Role returns the role a request acts with:
+//   - the role of the signed in account, limited by the scopes of a signed token
+//   - RoleAdmin for requests let in by the API token or from loopback
+//   - RoleAdmin if authentication is disabled, everyone may do everything
+//
+// ok is false for anonymous requests while authentication is enabled.
+func Role(c echo.Context) (role int, ok bool) {
+	if account, ok := Account(c); ok {
+		return account.Role, true
+	}
+	if trusted, _ := c.Get(trustedKey).(bool); trusted {
+		return auth.RoleAdmin, true
+	}
+	if enabled, _ := c.Get(authEnabledKey).(bool); enabled {
+		return auth.RoleGuest, false
+	}
+	return auth.RoleAdmin, true
+}
+
+// RequireLogin only lets signed in accounts through. Page requests are
+// redirected to the login page, which returns to the page after signing in.
+func RequireLogin(next echo.HandlerFunc) echo.HandlerFunc {
+	return RequireRole(auth.RoleGuest)(next)
+}
+
+// RequireRole only lets requests acting with at least role through, see Role.
+// Anonymous requests are handled like by RequireLogin, others are forbidden.
+func RequireRole(role int) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			have, ok := Role(c)
+			switch {
+			case !ok:
+				r := c.Request()
+				if r.Method == http.MethodGet && acceptsHTML(r) {
+					return c.Redirect(http.StatusSeeOther, "/login?next="+url.QueryEscape(r.URL.RequestURI()))
+				}
+				return echo.NewHTTPError(http.StatusUnauthorized, "sign in required")
+			case have < role:
+				return echo.NewHTTPError(http.StatusForbidden, "your account's role doesn't allow this")
+			}
+			return next(c)
+		}
+	}
+}
+
+// SessionOrToken lets signed in accounts through, and anyone else only
+// with `Authorization: Bearer <token>`. It replaces LoopbackOrToken for the
+// API once authentication is enabled, loopback is no longer trusted then.
+func SessionOrToken(tokens Tokens) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if _, ok := BearerToken(c.Request()); ok {
+				return checkToken(c, tokens, next)
+			}
+			if _, ok := Account(c); ok {
+				return next(c)
+			}
+			c.Response().Header().Set(echo.HeaderWWWAuthenticate, "Bearer")
+			return echo.NewHTTPError(http.StatusUnauthorized, "sign in or use an API token")
+		}
+	}
+}
+
+// SameOrigin rejects state-changing requests sent from other sites, on top
+// of SameSite cookies. Requests without an Origin header are let through,
+// browsers send one with every cross-origin POST.
+func SameOrigin(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		r := c.Request()
+		origin := r.Header.Get(echo.HeaderOrigin)
+		if origin == "" || r.Method == http.MethodGet || r.Method == http.MethodHead {
+			return next(c)
+		}
+		if u, err := url.Parse(origin); err != nil || u.Host != r.Host {
+			return echo.NewHTTPError(http.StatusForbidden, "cross-origin request")
+		}
+		return next(c)
+	}
+}
+
+// acceptsHTML reports whether the request comes from a browser navigating
+func acceptsHTML(r *http.Request) bool {
+	accept := r.Header.Get(echo.HeaderAccept)
+	return accept == "" || strings.Contains(accept, echo.MIMETextHTML)
+}
@@ -0,0 +1,34 @@
+package middleware
+
+import (
+	"github.com/labstack/echo/v4"
+	"github.com/pynezz/wasmdash/pkg/csp"
+)
+
+const cspKey = "csp" // The *csp.Builder of the server, set by CSP
+
+// defaultCSP is used for pages rendered without the CSP middleware
+var defaultCSP, _ = csp.New(csp.Config{})
+
+// CSP makes builder available to SetCSP
+func CSP(builder *csp.Builder) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			c.Set(cspKey, builder)
+			return next(c)
+		}
+	}
+}
+
+// SetCSP sets the Content-Security-Policy of the page being rendered,
+// allowing the scripts carrying nonce
+func SetCSP(c echo.Context, nonce string) {
+	builder, ok := c.Get(cspKey).(*csp.Builder)
+	if !ok {
+		builder = defaultCSP
+	}
+	name, value := builder.Header(c.Request().URL.Path, nonce)
+	header := c.Response().Header()
+	header.Set(name, value)
+	header.Set("Reporting-Endpoints", csp.ReportingEndpoints())
+}
@@ -1,98 +1,69 @@
 package middleware
 
 import (
-	"fmt"
-	"log"
-	"os"
+	"log/slog"
+	"time"
 
 	"github.com/labstack/echo/v4"
+	"github.com/pynezz/wasmdash/pkg/logging"
+	"github.com/pynezz/wasmdash/pkg/timing"
 )
 
-type Level int
-
-const (
-	Debug Level = iota
-	Info
-	Warning
-	Error
-)
-
-func init() {
-	logPath := os.Getenv("WLOGPATH")
-	if logPath == "" {
-		logPath = "wasmdash.log"
-	}
-	logFile, err := os.OpenFile(logPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-	if err != nil {
-		log.Fatal(err)
-	}
-	defer logFile.Close()
-	log.SetOutput(logFile)
-}
-
-var MiddlewareLogger *log.Logger = log.New(os.Stdout, "", log.LstdFlags)
-
-type Message struct {
-	Level   Level
-	Message string
-}
-
-type Logger struct {
-	logger *log.Logger
-}
-
-func NewLogger(logger *log.Logger) Logger {
-	return Logger{
-		logger: logger,
-	}
-}
-
-func (l *Logger) writeErrorMsg(err string, ctx echo.Context) {
-	host := os.Getenv("HOST")
-	l.Printf("[ERROR] [%s] %s\n%s\n%s", host, err, ctx.Request().Header, ctx.Scheme())
-}
-
-func (l *Logger) writeDebugMsg(message string, ctx echo.Context) {
-	details := map[string]string{
-		"request": fmt.Sprintf("%s %s", ctx.Request().Method, ctx.Request().URL.Path),
-	}
-	l.Printf("[DEBUG] %s\n%s", message, details)
-}
-
-func (l *Logger) writeInfoMsg(message string, ctx echo.Context) {
-	l.Printf("[INFO] %s\n%s", message, ctx.Request().Header)
-}
-
-func (l *Logger) writeWarningMsg(message string, ctx echo.Context) {
-	l.Printf("[WARNING] %s\n%s", message, ctx.Request().Header)
-}
-
-func (l *Logger) Printf(format string, v ...any) {
-	l.logger.Printf(format, v...)
-}
-
-func (l *Logger) Log(level Level, message string, ctx echo.Context) Message {
-	switch level {
-	case Debug:
-		l.writeDebugMsg(message, ctx)
-	case Info:
-		l.writeInfoMsg(message, ctx)
-	case Warning:
-		l.writeWarningMsg(message, ctx)
-	case Error:
-		l.writeErrorMsg(message, ctx)
-	default:
-		l.logger.Printf("[UNKNOWN] %s", message)
-	}
-
-	return Message{
-		Level:   level,
-		Message: message,
+// RequestLog logs every request once it's answered: its method, path,
+// status, latency and request ID. Errors returned by handlers are passed
+// to the error handler first, so the status logged is the one sent.
+// Requests taking longer than slow are logged as warnings with all their
+// Server-Timing metrics, even the ones not sent, 0 disables that.
+func RequestLog(logger *slog.Logger, slow time.Duration) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			start := time.Now()
+			req := c.Request()
+			requestLogger := logger
+			if id := logging.RequestID(req.Context()); id != "" {
+				requestLogger = logger.With("request_id", id)
+			}
+			c.SetRequest(req.WithContext(logging.NewContext(req.Context(), requestLogger)))
+
+			err := next(c)
+			if err != nil {
+				c.Error(err)
+			}
+
+			res := c.Response()
+			latency := time.Since(start)
+			isSlow := slow > 0 && latency > slow
+			level, msg := slog.LevelInfo, "request"
+			if isSlow {
+				level, msg = slog.LevelWarn, "slow request"
+			}
+			if res.Status >= 500 {
+				level = slog.LevelError
+			}
+			attrs := []slog.Attr{
+				slog.String("method", req.Method),
+				slog.String("path", req.URL.Path),
+				slog.Int("status", res.Status),
+				slog.Duration("latency", latency),
+				slog.Int64("bytes", res.Size),
+				slog.String("remote", c.RealIP()),
+			}
+			if err != nil && res.Status >= 500 {
+				attrs = append(attrs, slog.Any("error", err))
+			}
+			if isSlow {
+				if timings := timing.FromContext(c.Request().Context()); timings != nil {
+					attrs = append(attrs, slog.String("timing", timings.Header(latency)))
+				}
+			}
+			requestLogger.LogAttrs(c.Request().Context(), level, msg, attrs...)
+			return nil
+		}
 	}
 }
 
-// Logger middleware for logging certain important stuff
-func Log(c echo.Context) error {
-	MiddlewareLogger.Printf("Request: %s %s", c.Request().Method, c.Request().URL.Path)
-	return nil
+// Logger returns the logger of the request, carrying its request ID, or the
+// default logger outside RequestLog
+func Logger(c echo.Context) *slog.Logger {
+	return logging.FromContext(c.Request().Context())
 }
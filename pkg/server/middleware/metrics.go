@@ -0,0 +1,49 @@
+package middleware
+
+import (
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/pynezz/wasmdash/pkg/metrics"
+)
+
+var (
+	httpRequests = metrics.NewCounter("wasmdash_http_requests_total",
+		"HTTP requests answered, by method, route and status.", "method", "route", "status")
+	httpDuration = metrics.NewHistogram("wasmdash_http_request_duration_seconds",
+		"Time taken to answer HTTP requests, by method and route.", metrics.DurationBuckets, "method", "route")
+)
+
+// methods are the request methods counted by name
+var methods = []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"}
+
+// Metrics counts requests and their latency by route pattern, see
+// pkg/metrics. Like RequestLog, errors are passed to the error handler first
+// so the status counted is the one sent. They're still returned for
+// RequestLog to log, the error handler skips responses already sent.
+func Metrics() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			start := time.Now()
+			err := next(c)
+			if err != nil {
+				c.Error(err)
+			}
+
+			// Paths and methods without a route would make a series each
+			route := c.Path()
+			if route == "" {
+				route = "unmatched"
+			}
+			method := c.Request().Method
+			if !slices.Contains(methods, method) {
+				method = "other"
+			}
+			httpRequests.Inc(method, route, strconv.Itoa(c.Response().Status))
+			httpDuration.Observe(time.Since(start).Seconds(), method, route)
+			return err
+		}
+	}
+}
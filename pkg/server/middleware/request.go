@@ -0,0 +1,76 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/pynezz/wasmdash/pkg/logging"
+	"github.com/pynezz/wasmdash/pkg/timing"
+)
+
+// maxRequestIDLength bounds the X-Request-ID accepted from clients and proxies
+const maxRequestIDLength = 128
+
+// RequestID gives every request an ID, the X-Request-ID it came with or a
+// new one. It's echoed in the response and put in the request context for
+// the logger and widget fetchers, see logging.RequestID.
+func RequestID() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			id := c.Request().Header.Get(echo.HeaderXRequestID)
+			if !validRequestID(id) {
+				id = newRequestID()
+			}
+			c.Response().Header().Set(echo.HeaderXRequestID, id)
+
+			req := c.Request()
+			c.SetRequest(req.WithContext(logging.WithRequestID(req.Context(), id)))
+			return next(c)
+		}
+	}
+}
+
+// validRequestID reports whether id is safe to log and echo back
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, r := range id {
+		if r < '!' || r > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	id := make([]byte, 16)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// ServerTiming puts timing.Timings in the request context, and sends what
+// was recorded in them as the Server-Timing header of the response. Unless
+// detailed only the total is sent, the rest is for RequestLog to log.
+func ServerTiming(detailed bool) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			start := time.Now()
+			timings := &timing.Timings{}
+
+			req := c.Request()
+			c.SetRequest(req.WithContext(timing.NewContext(req.Context(), timings)))
+			res := c.Response()
+			res.Before(func() {
+				if detailed {
+					res.Header().Set("Server-Timing", timings.Header(time.Since(start)))
+				} else {
+					res.Header().Set("Server-Timing", timing.Total(time.Since(start)))
+				}
+			})
+			return next(c)
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/pynezz/wasmdash/pkg/timing"
+)
+
+func TestServerTiming(t *testing.T) {
+	tests := []struct {
+		detailed bool
+		want     *regexp.Regexp
+	}{
+		{true, regexp.MustCompile(`^store;desc="Store queries";dur=[0-9.]+, render;desc="Render";dur=[0-9.]+, total;dur=[0-9.]+$`)},
+		{false, regexp.MustCompile(`^total;dur=[0-9.]+$`)},
+	}
+	for _, tt := range tests {
+		e := echo.New()
+		e.Use(ServerTiming(tt.detailed))
+		e.GET("/", func(c echo.Context) error {
+			timings := timing.FromContext(c.Request().Context())
+			timings.Add("store", "Store queries", time.Millisecond)
+			timings.Add("render", "Render", time.Millisecond)
+			return c.String(http.StatusOK, "ok")
+		})
+
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		if got := rec.Header().Get("Server-Timing"); !tt.want.MatchString(got) {
+			t.Errorf("detailed %v: Server-Timing = %q, want %v", tt.detailed, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package middleware
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// RouteClass groups routes getting the same security headers
+type RouteClass string
+
+const (
+	ClassPage   RouteClass = "page"   // HTML pages, and anything not below
+	ClassStatic RouteClass = "static" // Files under /static, the service worker and manifest
+	ClassAPI    RouteClass = "api"    // JSON under /api, health, metrics and the live update stream
+)
+
+// Classify returns the class of the route at path
+func Classify(path string) RouteClass {
+	switch {
+	case strings.HasPrefix(path, "/static/"), path == "/service-worker.js", path == "/manifest.json", path == "/robots.txt":
+		return ClassStatic
+	case strings.HasPrefix(path, "/api/"), path == "/livez", path == "/readyz", path == "/health", path == "/metrics", path == "/events":
+		return ClassAPI
+	}
+	return ClassPage
+}
+
+// SecurityProfile are the security headers of an environment, see
+// DevelopmentSecurity and ProductionSecurity
+type SecurityProfile struct {
+	// HSTS is the Strict-Transport-Security header, empty for none. Only
+	// set it when the server is reached over HTTPS, browsers remember it.
+	HSTS string
+
+	// HSTSIncludeSubdomains extends HSTS to every subdomain of the host,
+	// which must all be served over HTTPS then
+	HSTSIncludeSubdomains bool
+
+	ReferrerPolicy    string
+	PermissionsPolicy string
+
+	// FrameOptions is the X-Frame-Options of pages, for browsers that
+	// don't know the frame-ancestors of the Content-Security-Policy
+	FrameOptions string
+
+	// ServerHeader names the server and its port in the Server header,
+	// which only helps while developing
+	ServerHeader bool
+}
+
+// DevelopmentSecurity is the profile of the development environment
+func DevelopmentSecurity() SecurityProfile {
+	return SecurityProfile{
+		ReferrerPolicy:    "strict-origin-when-cross-origin",
+		PermissionsPolicy: "camera=(), microphone=(), geolocation=(), payment=(), usb=(), browsing-topics=()",
+		FrameOptions:      "DENY",
+		ServerHeader:      true,
+	}
+}
+
+// ProductionSecurity is the profile of the production environment
+func ProductionSecurity() SecurityProfile {
+	p := DevelopmentSecurity()
+	p.HSTS = "max-age=63072000"
+	p.ServerHeader = false
+	return p
+}
+
+// Headers returns the security headers of the routes of class. Its table
+// is what SecurityHeaders sets.
+func (p SecurityProfile) Headers(class RouteClass) http.Header {
+	h := http.Header{}
+	h.Set("X-Content-Type-Options", "nosniff")
+	h.Set("Referrer-Policy", p.ReferrerPolicy)
+	h.Set("Cross-Origin-Resource-Policy", "same-origin")
+	if p.HSTS != "" {
+		hsts := p.HSTS
+		if p.HSTSIncludeSubdomains {
+			hsts += "; includeSubDomains"
+		}
+		h.Set("Strict-Transport-Security", hsts)
+	}
+
+	// Only documents open windows, use features or can be framed
+	if class == ClassPage {
+		h.Set("Cross-Origin-Opener-Policy", "same-origin")
+		h.Set("Permissions-Policy", p.PermissionsPolicy)
+		h.Set("X-Frame-Options", p.FrameOptions)
+	}
+
+	for name, values := range h {
+		if len(values) == 1 && values[0] == "" {
+			delete(h, name)
+		}
+	}
+	return h
+}
+
+// SecurityHeaders sets the headers of profile for the class of each route.
+// Handlers may override them, like StaticFileHeaders does for fonts.
+func SecurityHeaders(profile SecurityProfile, serverName, port string) echo.MiddlewareFunc {
+	headers := make(map[RouteClass]http.Header)
+	for _, class := range []RouteClass{ClassPage, ClassStatic, ClassAPI} {
+		headers[class] = profile.Headers(class)
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			header := c.Response().Header()
+			for name, values := range headers[Classify(c.Request().URL.Path)] {
+				header[name] = slices.Clone(values)
+			}
+			if profile.ServerHeader {
+				header.Set(echo.HeaderServer, serverName+":"+port)
+			}
+			return next(c)
+		}
+	}
+}
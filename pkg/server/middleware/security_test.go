@@ -0,0 +1,106 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/pynezz/wasmdash/pkg/csp"
+)
+
+func TestSecurityHeaders(t *testing.T) {
+	const (
+		policy = "default-src 'none'; script-src 'self' 'nonce-n0nce'; style-src 'self' 'nonce-n0nce'; " +
+			"img-src 'self' data:; font-src 'self'; connect-src 'self'; media-src 'self'; object-src 'none'; " +
+			"frame-src 'none'; worker-src 'self'; manifest-src 'self'; base-uri 'self'; form-action 'self'; " +
+			"frame-ancestors 'none'"
+		report      = "; report-uri /csp-report; report-to csp"
+		upgrade     = "; upgrade-insecure-requests"
+		permissions = "camera=(), microphone=(), geolocation=(), payment=(), usb=(), browsing-topics=()"
+	)
+	common := http.Header{
+		"X-Content-Type-Options":       {"nosniff"},
+		"Referrer-Policy":              {"strict-origin-when-cross-origin"},
+		"Cross-Origin-Resource-Policy": {"same-origin"},
+	}
+	with := func(h http.Header, kv ...string) http.Header {
+		h = h.Clone()
+		for i := 0; i < len(kv); i += 2 {
+			h.Set(kv[i], kv[i+1])
+		}
+		return h
+	}
+	page := func(h http.Header, policy string) http.Header {
+		return with(h,
+			"Cross-Origin-Opener-Policy", "same-origin",
+			"Permissions-Policy", permissions,
+			"X-Frame-Options", "DENY",
+			"Content-Security-Policy", policy,
+			"Reporting-Endpoints", `csp="/csp-report"`,
+		)
+	}
+	development := with(common, "Server", "wasmdash:8080")
+	production := with(common, "Strict-Transport-Security", "max-age=63072000")
+	subdomains := with(common, "Strict-Transport-Security", "max-age=63072000; includeSubDomains")
+
+	tests := []struct {
+		env        string
+		subdomains bool
+		path       string
+		want       http.Header
+	}{
+		{"development", false, "/dashboard", page(development, policy+report)},
+		{"development", false, "/static/js/app.js", development},
+		{"development", false, "/api/v1/widgets", development},
+		{"production", false, "/dashboard", page(production, policy+upgrade+report)},
+		{"production", false, "/static/js/app.js", production},
+		{"production", false, "/api/v1/widgets", production},
+		{"production", true, "/dashboard", page(subdomains, policy+upgrade+report)},
+		{"production", true, "/api/v1/widgets", subdomains},
+	}
+	for _, tt := range tests {
+		name := tt.env + tt.path
+		if tt.subdomains {
+			name += "+subdomains"
+		}
+		t.Run(name, func(t *testing.T) {
+			profile := DevelopmentSecurity()
+			if tt.env == "production" {
+				profile = ProductionSecurity()
+				profile.HSTSIncludeSubdomains = tt.subdomains
+			}
+			builder, err := csp.New(csp.Config{Production: tt.env == "production"})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			e := echo.New()
+			e.Use(SecurityHeaders(profile, "wasmdash", "8080"))
+			e.Use(CSP(builder))
+			e.GET("/dashboard", func(c echo.Context) error {
+				SetCSP(c, "n0nce")
+				return c.HTML(http.StatusOK, "<p>Dashboard</p>")
+			})
+			e.GET("/static/*", func(c echo.Context) error { return c.String(http.StatusOK, "app") })
+			e.GET("/api/v1/widgets", func(c echo.Context) error { return c.JSON(http.StatusOK, []string{}) })
+
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			got := rec.Header()
+			got.Del(echo.HeaderContentType)
+
+			for name, values := range tt.want {
+				if !slices.Equal(got[name], values) {
+					t.Errorf("%s = %q, want %q", name, got[name], values)
+				}
+			}
+			for name, values := range got {
+				if _, ok := tt.want[name]; !ok {
+					t.Errorf("unexpected %s: %q", name, values)
+				}
+			}
+		})
+	}
+}
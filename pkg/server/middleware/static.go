@@ -9,13 +9,22 @@ import (
 	"github.com/labstack/echo/v4"
 )
 
+// Cache-Control of static files, see StaticFileHeaders
+const (
+	cacheImmutable = "public, max-age=31536000, immutable"
+	cacheShort     = "public, max-age=300"
+)
+
 /*
 StaticFileHeaders returns middleware that sets proper MIME types and cache headers for static files*
 
+Files at a hashed path, which never changes content, are cached for a year,
+others for a few minutes. hashed gets the path below /static/.
+
 - return:
 - middleware with custom configuration.
 */
-func StaticFileHeaders() echo.MiddlewareFunc {
+func StaticFileHeaders(hashed func(name string) bool) echo.MiddlewareFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
 			if strings.HasPrefix(c.Request().URL.Path, "/static/") {
@@ -59,7 +68,11 @@ func StaticFileHeaders() echo.MiddlewareFunc {
 				}
 
 				// Set cache headers for static assets
-				c.Response().Header().Set("Cache-Control", "public, max-age=31536000")
+				cacheControl := cacheShort
+				if hashed(strings.TrimPrefix(c.Request().URL.Path, "/static/")) {
+					cacheControl = cacheImmutable
+				}
+				c.Response().Header().Set("Cache-Control", cacheControl)
 				c.Response().Header().Set("Vary", "Accept-Encoding")
 
 				// Add security headers for static files
@@ -69,6 +82,7 @@ func StaticFileHeaders() echo.MiddlewareFunc {
 				if isFont(ext) {
 					c.Response().Header().Set("Access-Control-Allow-Origin", "*")
 					c.Response().Header().Set("Access-Control-Allow-Methods", "GET")
+					c.Response().Header().Set("Cross-Origin-Resource-Policy", "cross-origin")
 				}
 			}
 			return next(c)
@@ -106,8 +120,9 @@ func isStaticFile(ext string) bool {
  * Configuration for static file middleware.
  */
 type StaticFileConfig struct {
-	CacheMaxAge int    // Cache max age in seconds
-	Prefix      string // URL prefix for static files
+	CacheMaxAge int                    // Cache max age in seconds of files that aren't hashed
+	Prefix      string                 // URL prefix for static files
+	Hashed      func(name string) bool // Reports hashed paths below Prefix, cached immutable
 }
 
 /*
@@ -119,7 +134,10 @@ StaticFileHeadersWithConfig
 */
 func StaticFileHeadersWithConfig(config StaticFileConfig) echo.MiddlewareFunc {
 	if config.CacheMaxAge == 0 {
-		config.CacheMaxAge = 31536000 // 1 year default
+		config.CacheMaxAge = 300 // 5 minutes default
+	}
+	if config.Hashed == nil {
+		config.Hashed = func(string) bool { return false }
 	}
 	if config.Prefix == "" {
 		config.Prefix = "/static/"
@@ -134,6 +152,9 @@ func StaticFileHeadersWithConfig(config StaticFileConfig) echo.MiddlewareFunc {
 
 				// Set cache headers for static assets
 				cacheControl := fmt.Sprintf("public, max-age=%d", config.CacheMaxAge)
+				if config.Hashed(strings.TrimPrefix(c.Request().URL.Path, config.Prefix)) {
+					cacheControl = cacheImmutable
+				}
 				c.Response().Header().Set("Cache-Control", cacheControl)
 				c.Response().Header().Set("Vary", "Accept-Encoding")
 
@@ -144,6 +165,7 @@ func StaticFileHeadersWithConfig(config StaticFileConfig) echo.MiddlewareFunc {
 				if isFont(ext) {
 					c.Response().Header().Set("Access-Control-Allow-Origin", "*")
 					c.Response().Header().Set("Access-Control-Allow-Methods", "GET")
+					c.Response().Header().Set("Cross-Origin-Resource-Policy", "cross-origin")
 				}
 			}
 			return next(c)
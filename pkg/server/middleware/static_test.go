@@ -0,0 +1,59 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+
+	"github.com/labstack/echo/v4"
+	"github.com/pynezz/wasmdash/pkg/assets"
+)
+
+func TestStaticFileHeaders(t *testing.T) {
+	m, err := assets.New(fstest.MapFS{
+		"css/styles.css":    {Data: []byte("body { margin: 0; }\n")},
+		"fonts/inter.woff2": {Data: []byte("wOF2")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	styles, font := m.URL("css/styles.css"), m.URL("fonts/inter.woff2")
+
+	tests := []struct {
+		path         string
+		cacheControl string
+		contentType  string
+	}{
+		{styles, cacheImmutable, "text/css; charset=utf-8"},
+		{font, cacheImmutable, "font/woff2"},
+		{"/static/css/styles.css", cacheShort, "text/css; charset=utf-8"},
+		{"/static/css/missing.css", cacheShort, "text/css; charset=utf-8"},
+		// A hash of other content, or of nothing, isn't known to be final
+		{"/static/css/styles.00000000.css", cacheShort, "text/css; charset=utf-8"},
+		{"/static/manifest.json", cacheShort, "application/json"},
+		{"/", "", ""},
+		{styles[len("/static"):], "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			e := echo.New()
+			rec := httptest.NewRecorder()
+			c := e.NewContext(httptest.NewRequest(http.MethodGet, tt.path, nil), rec)
+			h := StaticFileHeaders(m.Hashed)(func(c echo.Context) error { return nil })
+			if err := h(c); err != nil {
+				t.Fatal(err)
+			}
+			header := rec.Header()
+			if got := header.Get("Cache-Control"); got != tt.cacheControl {
+				t.Errorf("Cache-Control = %q, want %q", got, tt.cacheControl)
+			}
+			if got := header.Get("Content-Type"); got != tt.contentType {
+				t.Errorf("Content-Type = %q, want %q", got, tt.contentType)
+			}
+			if tt.cacheControl != "" && header.Get("Vary") != "Accept-Encoding" {
+				t.Errorf("Vary = %q", header.Get("Vary"))
+			}
+		})
+	}
+}
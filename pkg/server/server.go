@@ -1,11 +1,25 @@
 package server
 
 import (
+	"context"
+	"io/fs"
 	"log"
+	"log/slog"
+	"net"
+	"sync"
+	"time"
 
 	"github.com/labstack/echo/v4"
+	echomw "github.com/labstack/echo/v4/middleware"
+	"github.com/pynezz/wasmdash/pkg/assets"
+	"github.com/pynezz/wasmdash/pkg/auth"
+	"github.com/pynezz/wasmdash/pkg/csp"
+	"github.com/pynezz/wasmdash/pkg/health"
+	"github.com/pynezz/wasmdash/pkg/metrics"
 	"github.com/pynezz/wasmdash/pkg/server/handlers"
 	"github.com/pynezz/wasmdash/pkg/server/middleware"
+	"github.com/pynezz/wasmdash/pkg/storage"
+	"github.com/pynezz/wasmdash/pkg/system"
 )
 
 type Config struct {
@@ -13,47 +27,192 @@ type Config struct {
 	Host        string
 	Environment string
 	ServerName  string
+
+	// HSTSIncludeSubdomains extends HSTS in production to the subdomains
+	// of the host
+	HSTSIncludeSubdomains bool
+
+	// Logger logs requests and what handlers report, slog.Default() if nil.
+	// Requests taking longer than SlowRequest are logged as warnings, 0
+	// never warns.
+	Logger      *slog.Logger
+	SlowRequest time.Duration
+
+	// Version and BuildTime describe the build at /health
+	Version   string
+	BuildTime string
+
+	// Health holds the checks reported at /readyz, the server adds its own
+	Health *health.Registry
+
+	// Static holds the files served at /static, /service-worker.js and
+	// /manifest.json, usually the static directory embedded in the binary.
+	// In development StaticDir is served instead when it exists, so edits
+	// show without rebuilding.
+	Static    fs.FS
+	StaticDir string
+
+	// Store holds the dashboard layouts, in memory if nil
+	Store storage.Store
+
+	// Metrics samples the host for the system status card. The caller runs
+	// it, an idle collector reports the status as unknown.
+	Metrics *system.Collector
+
+	// APIEnabled registers the JSON API under /api/v1, which only accepts
+	// requests from loopback or carrying APIToken as a bearer token
+	APIEnabled bool
+	APIToken   string
+
+	// TokenSigner verifies signed API tokens recorded in Store, and issues
+	// them at /admin/tokens. Nil disables them.
+	TokenSigner *auth.Signer
+
+	// CSP makes the Content-Security-Policy of each page, the default
+	// policy if nil
+	CSP *csp.Builder
+
+	// MetricsEnabled serves the metrics of pkg/metrics at /metrics, only to
+	// loopback or scrapers with MetricsToken as a bearer token
+	MetricsEnabled bool
+	MetricsToken   string
+
+	// AuthEnabled requires signing in with an account from Store for the
+	// dashboard and the API, see auth.go
+	AuthEnabled bool
+	SessionTTL  time.Duration
+}
+
+// defaults fills in fields left empty by the caller
+func (c *Config) defaults() {
+	if c.Port == "" {
+		c.Port = "8080"
+	}
+	if c.Host == "" {
+		c.Host = "localhost"
+	}
+	if c.Environment == "" {
+		c.Environment = "development"
+	}
+	if c.ServerName == "" {
+		c.ServerName = "wasmdash"
+	}
+	if c.Logger == nil {
+		c.Logger = slog.Default()
+	}
+	if c.CSP == nil {
+		c.CSP, _ = csp.New(csp.Config{Production: c.Environment == "production"})
+	}
+	if c.StaticDir == "" {
+		c.StaticDir = "static"
+	}
+	if c.Store == nil {
+		c.Store = storage.NewMemory()
+	}
+	if c.Health == nil {
+		c.Health = health.NewRegistry()
+	}
+	if c.Metrics == nil {
+		c.Metrics = system.NewCollector(system.Config{})
+	}
+	if c.SessionTTL <= 0 {
+		c.SessionTTL = 24 * time.Hour
+	}
 }
 
 type Server struct {
 	echo   *echo.Echo
 	config *Config
+
+	// store is config.Store, reporting changes to live dashboards
+	store    storage.Store
+	static   fs.FS
+	assets   *assets.Manifest
+	sessions *auth.Sessions
+	cookie   middleware.SessionCookie
+	hub      *Hub
+	changed  chan string
+
+	// Background jobs run until cancel, jobs tracks them for Shutdown
+	ctx    context.Context
+	cancel context.CancelFunc
+	jobs   sync.WaitGroup
 }
 
-func New(config *Config) *Server {
+// New returns a server for config. It fails when the static files can't
+// serve the pages as configured, see useAlpine.
+func New(config *Config) (*Server, error) {
 	if config == nil {
-		config = &Config{
-			Port:        "8080",
-			Host:        "pynezz.dev",
-			Environment: "development",
-			ServerName:  "wasmdash",
-		}
+		config = &Config{}
+	}
+	config.defaults()
+	static, live := config.staticFS()
+	if err := config.useAlpine(static); err != nil {
+		return nil, err
 	}
 
 	e := echo.New()
 	e.HideBanner = true
+	e.HTTPErrorHandler = handlers.ErrorHandler
+	e.StdLogger = slog.NewLogLogger(config.Logger.Handler(), slog.LevelWarn)
 
-	return &Server{
-		echo:   e,
-		config: config,
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &Server{
+		echo:     e,
+		config:   config,
+		sessions: auth.NewSessions(config.SessionTTL),
+		cookie:   middleware.NewSessionCookie(config.Environment == "production"),
+		hub:      NewHub(),
+		changed:  make(chan string, 64),
+		ctx:      ctx,
+		cancel:   cancel,
 	}
+	s.store = storage.Timed(storage.Observe(config.Store, s.dashboardChanged))
+	s.static, s.assets = static, fingerprint(static, live)
+	assets.SetDefault(s.assets)
+	s.registerChecks()
+	s.registerMetrics()
+	config.Metrics.OnSample(s.publishSystemStatus)
+	return s, nil
 }
 
 // SetupMiddleware configures all middleware
 func (s *Server) SetupMiddleware() {
-	// Server header middleware
-	s.echo.Use(func(next echo.HandlerFunc) echo.HandlerFunc {
-		return func(c echo.Context) error {
-			c.Response().Header().Set(echo.HeaderServer, s.config.ServerName+":"+s.config.Port)
-			return next(c)
-		}
-	})
+	// Request ID and Server-Timing middleware, before the request log so
+	// it carries both. Production responses only time the total, where the
+	// time went is left to the log.
+	s.echo.Use(middleware.RequestID())
+	s.echo.Use(middleware.ServerTiming(s.config.Environment != "production"))
+
+	// Request log and metrics middleware, early so they see the final status
+	s.echo.Use(middleware.RequestLog(s.config.Logger, s.config.SlowRequest))
+	s.echo.Use(middleware.Metrics())
+
+	// Panics are logged and answered with a 500, inside the request log
+	// and metrics so they count it
+	s.echo.Use(middleware.Recover())
+
+	// Security headers middleware, naming the server only in development
+	profile := middleware.DevelopmentSecurity()
+	if s.config.Environment == "production" {
+		profile = middleware.ProductionSecurity()
+		profile.HSTSIncludeSubdomains = s.config.HSTSIncludeSubdomains
+	}
+	s.echo.Use(middleware.SecurityHeaders(profile, s.config.ServerName, s.config.Port))
+
+	// Content-Security-Policy of the rendered pages
+	s.echo.Use(middleware.CSP(s.config.CSP))
 
 	// Static files middleware
-	s.echo.Static("/static", "static")
+	s.echo.GET("/static/*", s.serveStatic)
 
 	// MIME type and cache headers middleware
-	s.echo.Use(middleware.StaticFileHeaders())
+	s.echo.Use(middleware.StaticFileHeaders(s.assets.Hashed))
+
+	// Session cookie middleware
+	if s.config.AuthEnabled {
+		s.echo.Use(middleware.Authenticate(s.sessions, s.cookie, s.store.Account))
+	}
 }
 
 // SetupRoutes configures all application routes
@@ -61,13 +220,39 @@ func (s *Server) SetupRoutes() {
 	// Main application routes
 	s.echo.GET("/", handlers.HomeHandler)
 	s.echo.GET("/about", handlers.AboutHandler)
-	s.echo.GET("/dashboard", handlers.DashboardHandler)
-	s.echo.GET("/service-worker.js", handlers.ServiceWorkerHandler)
-	
+	s.echo.GET("/dashboard", handlers.DashboardHandler(s.store, s.config.Metrics, s.sessions), s.requireRole(auth.RoleGuest)...)
+	s.echo.GET("/service-worker.js", handlers.ServiceWorkerHandler(s.static, s.assets))
+	s.echo.GET("/manifest.json", handlers.ManifestHandler(s.static))
+
+	// Live dashboard updates, see live.go
+	s.echo.GET("/events", s.hub.Handler, s.requireRole(auth.RoleGuest)...)
+
+	// Login and logout
+	if s.config.AuthEnabled {
+		s.setupAuthRoutes()
+	}
+
 	// Utility routes
+	s.echo.POST(csp.ReportPath, handlers.CSPReport, echomw.BodyLimit("64K"))
 	s.echo.GET("/robots.txt", handlers.RobotsHandler)
 	s.echo.GET("/404", handlers.NotFoundHandler)
-	s.echo.GET("/health", handlers.HealthHandler)
+
+	// Health for monitoring, see health.go
+	checks := handlers.NewHealth(s.config.Health, s.config.Version, s.config.BuildTime)
+	s.echo.GET("/livez", checks.Livez)
+	s.echo.GET("/readyz", checks.Readyz)
+	s.echo.GET("/health", checks.Health)
+
+	// Prometheus metrics
+	if s.config.MetricsEnabled {
+		access := middleware.LoopbackOrToken(s.config.Host, middleware.Tokens{Static: s.config.MetricsToken})
+		s.echo.GET("/metrics", handlers.MetricsHandler(metrics.Default), access)
+	}
+
+	// JSON API
+	if s.config.APIEnabled {
+		s.setupAPIRoutes()
+	}
 
 	// Debug routes (only in development)
 	if s.config.Environment == "development" {
@@ -75,15 +260,58 @@ func (s *Server) SetupRoutes() {
 	}
 }
 
-// setupDebugRoutes configures debug and testing routes
+// setupAPIRoutes configures the JSON API, see handlers/api.go
+func (s *Server) setupAPIRoutes() {
+	api := handlers.NewAPI(s.store, s.sessions)
+
+	tokens := middleware.Tokens{Static: s.config.APIToken}
+	if s.config.TokenSigner != nil {
+		tokens.Signed = s.checkToken
+	}
+	access := middleware.LoopbackOrToken(s.config.Host, tokens)
+	if s.config.AuthEnabled {
+		access = middleware.SessionOrToken(tokens)
+	}
+	v1 := s.echo.Group("/api/v1",
+		access,
+		echomw.BodyLimit("1M"),
+	)
+	v1.GET("/widget-types", api.WidgetTypes)
+
+	// Guests read, users change their own dashboards, see API.editableDashboard
+	user := middleware.RequireRole(auth.RoleUser)
+	v1.GET("/dashboards", api.ListDashboards)
+	v1.POST("/dashboards", api.CreateDashboard, user)
+	v1.GET("/dashboards/:id", api.GetDashboard)
+	v1.PATCH("/dashboards/:id", api.UpdateDashboard, user)
+	v1.DELETE("/dashboards/:id", api.DeleteDashboard, user)
+	v1.PUT("/dashboards/:id/layout", api.UpdateLayout, user)
+
+	v1.GET("/dashboards/:id/widgets", api.ListWidgets)
+	v1.POST("/dashboards/:id/widgets", api.CreateWidget, user)
+	v1.GET("/dashboards/:id/widgets/:widget", api.GetWidget)
+	v1.PUT("/dashboards/:id/widgets/:widget", api.UpdateWidget, user)
+	v1.DELETE("/dashboards/:id/widgets/:widget", api.DeleteWidget, user)
+
+	accounts := v1.Group("/accounts", middleware.RequireRole(auth.RoleAdmin))
+	accounts.GET("", api.ListAccounts)
+	accounts.POST("", api.CreateAccount)
+	accounts.PUT("/:account", api.UpdateAccount)
+	accounts.DELETE("/:account", api.DeleteAccount)
+}
+
+// setupDebugRoutes configures debug and testing routes, for admins only
+// once authentication is enabled
 func (s *Server) setupDebugRoutes() {
-	debugGroup := s.echo.Group("/debug")
+	admin := s.requireRole(auth.RoleAdmin)
+
+	debugGroup := s.echo.Group("/debug", admin...)
 	debugGroup.GET("/css", handlers.CSSDebugHandler(s.config.Port))
 
-	testGroup := s.echo.Group("/test")
+	testGroup := s.echo.Group("/test", admin...)
 	testGroup.GET("/css", handlers.CSSTestHandler)
 
-	mobileGroup := s.echo.Group("/mobile")
+	mobileGroup := s.echo.Group("/mobile", admin...)
 	mobileGroup.GET("/detect", handlers.MobileDetectHandler(s.config.Port))
 }
 
@@ -91,18 +319,51 @@ func (s *Server) setupDebugRoutes() {
 func (s *Server) Start() error {
 	log.Printf("Starting server on %s:%s", s.config.Host, s.config.Port)
 
-	address := ":" + s.config.Port
-	if s.config.Host != "" && s.config.Host != "localhost" {
-		address = s.config.Host + ":" + s.config.Port
+	// localhost resolves to other addresses too, listen on loopback only
+	host := s.config.Host
+	if host == "localhost" {
+		host = "127.0.0.1"
 	}
+	address := net.JoinHostPort(host, s.config.Port)
+
+	s.jobs.Add(2)
+	go func() {
+		defer s.jobs.Done()
+		s.publishChanges(s.ctx)
+	}()
+	go func() {
+		defer s.jobs.Done()
+		s.refreshWidgets(s.ctx)
+	}()
 
 	return s.echo.Start(address)
 }
 
-// Shutdown gracefully shuts down the server
-func (s *Server) Shutdown() error {
+// Shutdown stops accepting connections and background jobs, and waits for
+// requests in flight and the jobs to finish until ctx is done. Connections
+// still open then are closed, and ctx.Err is returned.
+func (s *Server) Shutdown(ctx context.Context) error {
 	log.Println("Shutting down server...")
-	return s.echo.Close()
+	s.cancel()
+	// Event streams never finish on their own
+	s.hub.Close()
+
+	if err := s.echo.Shutdown(ctx); err != nil {
+		s.echo.Close()
+		return err
+	}
+
+	done := make(chan struct{})
+	go func() {
+		s.jobs.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
 
 // Echo returns the underlying Echo instance for advanced configuration
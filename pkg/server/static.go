@@ -0,0 +1,76 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/url"
+	"os"
+
+	"github.com/labstack/echo/v4"
+	"github.com/pynezz/wasmdash/pkg/assets"
+	"github.com/pynezz/wasmdash/pkg/ui"
+)
+
+// staticFS returns the files to serve as static, see Config.Static, and
+// whether they're read from disk and may change while the server runs
+func (c *Config) staticFS() (fsys fs.FS, live bool) {
+	if c.Environment == "development" || c.Static == nil {
+		if info, err := os.Stat(c.StaticDir); err == nil && info.IsDir() {
+			log.Printf("Serving static files from %s", c.StaticDir)
+			return os.DirFS(c.StaticDir), true
+		}
+	}
+	if c.Static == nil {
+		log.Printf("No static files: %s doesn't exist", c.StaticDir)
+		return os.DirFS(c.StaticDir), true
+	}
+	return c.Static, false
+}
+
+// fingerprint returns the manifest of the static files, hashing them unless
+// they may change
+func fingerprint(fsys fs.FS, live bool) *assets.Manifest {
+	if live {
+		return assets.Live(fsys)
+	}
+	manifest, err := assets.New(fsys)
+	if err != nil {
+		log.Printf("Static files aren't fingerprinted: %v", err)
+		return assets.Live(fsys)
+	}
+	log.Printf("Fingerprinted %d static file(s)", manifest.Len())
+	return manifest
+}
+
+// useAlpine makes the pages load Alpine's CSP build. Only in development
+// the stock build stands in when it's missing, allowing the eval that one
+// needs; in production that's an error rather than a weaker policy.
+func (c *Config) useAlpine(fsys fs.FS) error {
+	if _, err := fs.Stat(fsys, ui.AlpineCSP); err == nil {
+		ui.SetAlpine(ui.AlpineCSP)
+		return nil
+	}
+	if c.Environment == "production" {
+		return fmt.Errorf("static files: %s is missing, run make alpine", ui.AlpineCSP)
+	}
+	c.Logger.Warn("Alpine's CSP build is missing, pages allow 'unsafe-eval' for the stock build: run make alpine",
+		"file", ui.AlpineCSP)
+	ui.SetAlpine(ui.AlpineStock)
+	c.CSP = c.CSP.WithEval()
+	return nil
+}
+
+// serveStatic handles GET /static/*, see assets.Manifest.Serve
+func (s *Server) serveStatic(c echo.Context) error {
+	name, err := url.PathUnescape(c.Param("*"))
+	if err != nil {
+		return echo.ErrNotFound
+	}
+	err = s.assets.Serve(c.Response(), c.Request(), name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return echo.ErrNotFound
+	}
+	return err
+}
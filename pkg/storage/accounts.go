@@ -0,0 +1,80 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pynezz/wasmdash/pkg/auth"
+)
+
+// ValidateAccount checks the invariants every Store relies on
+func ValidateAccount(a auth.Account) error {
+	if err := auth.ValidID(a.ID); err != nil {
+		return fmt.Errorf("storage: account id %w", err)
+	}
+	if !auth.ValidRole(a.Role) {
+		return fmt.Errorf("storage: account %q: unknown role %d", a.ID, a.Role)
+	}
+	if !auth.IsHash(a.Password) {
+		return fmt.Errorf("storage: account %q: password is not hashed", a.ID)
+	}
+	if a.UUID == "" || a.Creation.IsZero() {
+		return fmt.Errorf("storage: account %q: uuid and creation must be set", a.ID)
+	}
+	return nil
+}
+
+// SyncAccounts makes the accounts from the config file part of the store:
+// new ones are created, existing ones get their role and password from
+// the config. Passwords may be given in plaintext or as an argon2id hash,
+// plaintext ones are hashed before they're stored.
+//
+// Accounts that aren't in the config are left alone. An account is only
+// saved if anything changed.
+func SyncAccounts(ctx context.Context, s Store, accounts []auth.Account) error {
+	for _, want := range accounts {
+		have, err := s.Account(ctx, want.ID)
+		exists := err == nil
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			return err
+		}
+		if !exists {
+			have = auth.Account{ID: want.ID, UUID: uuid.NewString(), Creation: time.Now().UTC()}
+		}
+
+		changed := !exists || have.Role != want.Role
+		have.Role = want.Role
+
+		if password, ok, err := syncPassword(have.Password, want.Password); err != nil {
+			return fmt.Errorf("account %q: %w", want.ID, err)
+		} else if ok {
+			have.Password, changed = password, true
+		}
+
+		if !changed {
+			continue
+		}
+		if err := s.SaveAccount(ctx, have); err != nil {
+			return fmt.Errorf("account %q: %w", want.ID, err)
+		}
+	}
+	return nil
+}
+
+// syncPassword returns the hash to store for a configured password,
+// and false if the stored hash already matches it
+func syncPassword(stored, configured string) (string, bool, error) {
+	if auth.IsHash(configured) {
+		return configured, configured != stored, nil
+	}
+	if stored != "" {
+		if ok, err := auth.VerifyPassword(stored, configured); err == nil && ok {
+			return stored, false, nil
+		}
+	}
+	hash, err := auth.HashPassword(configured)
+	return hash, err == nil, err
+}
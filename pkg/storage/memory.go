@@ -0,0 +1,228 @@
+package storage
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pynezz/wasmdash/pkg/auth"
+)
+
+// Memory is a Store that keeps everything in memory, for tests and for
+// running without a database. Nothing survives a restart.
+type Memory struct {
+	mu         sync.RWMutex
+	dashboards map[string]Dashboard
+	accounts   map[string]auth.Account
+	tokens     map[string]auth.Token
+}
+
+// NewMemory returns an empty in-memory store
+func NewMemory() *Memory {
+	return &Memory{
+		dashboards: make(map[string]Dashboard),
+		accounts:   make(map[string]auth.Account),
+		tokens:     make(map[string]auth.Token),
+	}
+}
+
+func (m *Memory) Dashboards(ctx context.Context) ([]Dashboard, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	list := make([]Dashboard, 0, len(m.dashboards))
+	for _, d := range m.dashboards {
+		d.Widgets = nil
+		list = append(list, d)
+	}
+	slices.SortFunc(list, func(a, b Dashboard) int { return strings.Compare(a.ID, b.ID) })
+	return list, nil
+}
+
+func (m *Memory) Dashboard(ctx context.Context, id string) (Dashboard, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	d, ok := m.dashboards[id]
+	if !ok {
+		return Dashboard{}, ErrNotFound
+	}
+	d.Widgets = cloneWidgets(d.Widgets)
+	return d, nil
+}
+
+func (m *Memory) SaveDashboard(ctx context.Context, d Dashboard) (Dashboard, error) {
+	if err := d.Validate(); err != nil {
+		return Dashboard{}, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now().UTC()
+	old, exists := m.dashboards[d.ID]
+	switch {
+	case d.Version == 0 && exists:
+		return Dashboard{}, ErrExists
+	case d.Version == 0:
+		d.CreatedAt = now
+	case !exists:
+		return Dashboard{}, ErrNotFound
+	case d.Version != old.Version:
+		return Dashboard{}, ErrConflict
+	default:
+		d.CreatedAt = old.CreatedAt
+	}
+	d.UpdatedAt = now
+	d.Version++
+	d.Widgets = cloneWidgets(d.Widgets)
+	SortWidgets(d.Widgets)
+
+	m.dashboards[d.ID] = d
+	d.Widgets = cloneWidgets(d.Widgets)
+	return d, nil
+}
+
+func (m *Memory) DeleteDashboard(ctx context.Context, id string, version int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	d, ok := m.dashboards[id]
+	if !ok {
+		return ErrNotFound
+	}
+	if version != 0 && version != d.Version {
+		return ErrConflict
+	}
+	delete(m.dashboards, id)
+	return nil
+}
+
+func (m *Memory) Accounts(ctx context.Context) ([]auth.Account, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	list := make([]auth.Account, 0, len(m.accounts))
+	for _, a := range m.accounts {
+		list = append(list, a)
+	}
+	slices.SortFunc(list, func(a, b auth.Account) int { return strings.Compare(a.ID, b.ID) })
+	return list, nil
+}
+
+func (m *Memory) Account(ctx context.Context, id string) (auth.Account, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	a, ok := m.accounts[id]
+	if !ok {
+		return auth.Account{}, ErrNotFound
+	}
+	return a, nil
+}
+
+func (m *Memory) SaveAccount(ctx context.Context, a auth.Account) error {
+	if err := ValidateAccount(a); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.accounts[a.ID] = a
+	return nil
+}
+
+func (m *Memory) DeleteAccount(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.accounts[id]; !ok {
+		return ErrNotFound
+	}
+	delete(m.accounts, id)
+	return nil
+}
+
+func (m *Memory) Tokens(ctx context.Context) ([]auth.Token, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	list := make([]auth.Token, 0, len(m.tokens))
+	for _, t := range m.tokens {
+		t.Scopes = slices.Clone(t.Scopes)
+		list = append(list, t)
+	}
+	slices.SortFunc(list, func(a, b auth.Token) int {
+		if c := b.IssuedAt.Compare(a.IssuedAt); c != 0 {
+			return c
+		}
+		return strings.Compare(a.ID, b.ID)
+	})
+	return list, nil
+}
+
+func (m *Memory) Token(ctx context.Context, id string) (auth.Token, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	t, ok := m.tokens[id]
+	if !ok {
+		return auth.Token{}, ErrNotFound
+	}
+	t.Scopes = slices.Clone(t.Scopes)
+	return t, nil
+}
+
+func (m *Memory) SaveToken(ctx context.Context, t auth.Token) error {
+	if err := ValidateToken(t); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.tokens[t.ID]; ok {
+		return ErrExists
+	}
+	t.Scopes = slices.Clone(t.Scopes)
+	m.tokens[t.ID] = t
+	return nil
+}
+
+func (m *Memory) RevokeToken(ctx context.Context, id string, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t, ok := m.tokens[id]
+	if !ok {
+		return ErrNotFound
+	}
+	if t.RevokedAt.IsZero() {
+		t.RevokedAt = at.UTC()
+		m.tokens[id] = t
+	}
+	return nil
+}
+
+func (m *Memory) Ping(context.Context) error {
+	return nil
+}
+
+func (m *Memory) Close() error {
+	return nil
+}
+
+// cloneWidgets copies widgets so callers can't modify the stored ones
+func cloneWidgets(ws []Widget) []Widget {
+	if len(ws) == 0 {
+		return nil
+	}
+	clone := make([]Widget, len(ws))
+	for i, w := range ws {
+		w.Settings = slices.Clone(w.Settings)
+		clone[i] = w
+	}
+	return clone
+}
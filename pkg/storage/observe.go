@@ -0,0 +1,31 @@
+package storage
+
+import "context"
+
+// observed calls changed after every successful change to a dashboard
+type observed struct {
+	Store
+	changed func(id string)
+}
+
+// Observe wraps s to call changed with the ID of every dashboard that is
+// saved or deleted through it, once the change is stored
+func Observe(s Store, changed func(id string)) Store {
+	return &observed{Store: s, changed: changed}
+}
+
+func (o *observed) SaveDashboard(ctx context.Context, d Dashboard) (Dashboard, error) {
+	saved, err := o.Store.SaveDashboard(ctx, d)
+	if err == nil {
+		o.changed(saved.ID)
+	}
+	return saved, err
+}
+
+func (o *observed) DeleteDashboard(ctx context.Context, id string, version int64) error {
+	err := o.Store.DeleteDashboard(ctx, id, version)
+	if err == nil {
+		o.changed(id)
+	}
+	return err
+}
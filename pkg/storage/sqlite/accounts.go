@@ -0,0 +1,76 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/pynezz/wasmdash/pkg/auth"
+	"github.com/pynezz/wasmdash/pkg/storage"
+)
+
+func (s *Store) Accounts(ctx context.Context) ([]auth.Account, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT id, uuid, password, role, created_at FROM accounts ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []auth.Account
+	for rows.Next() {
+		a, err := scanAccount(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, a)
+	}
+	return list, rows.Err()
+}
+
+func (s *Store) Account(ctx context.Context, id string) (auth.Account, error) {
+	a, err := scanAccount(s.db.QueryRowContext(ctx,
+		`SELECT id, uuid, password, role, created_at FROM accounts WHERE id = ?`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return a, storage.ErrNotFound
+	}
+	return a, err
+}
+
+func (s *Store) SaveAccount(ctx context.Context, a auth.Account) error {
+	if err := storage.ValidateAccount(a); err != nil {
+		return err
+	}
+	_, err := s.db.ExecContext(ctx, `INSERT INTO accounts (id, uuid, password, role, created_at)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET password = excluded.password, role = excluded.role`,
+		a.ID, a.UUID, a.Password, a.Role, a.Creation.UTC().Format(timeFormat))
+	return err
+}
+
+func (s *Store) DeleteAccount(ctx context.Context, id string) error {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM accounts WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return storage.ErrNotFound
+	}
+	return nil
+}
+
+func scanAccount(row scanner) (auth.Account, error) {
+	var (
+		a       auth.Account
+		created string
+	)
+	if err := row.Scan(&a.ID, &a.UUID, &a.Password, &a.Role, &created); err != nil {
+		return a, err
+	}
+
+	var err error
+	a.Creation, err = time.Parse(timeFormat, created)
+	return a, err
+}
@@ -0,0 +1,105 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// migrations are applied in order, the schema version is the number applied.
+// Released migrations must never be edited, change the schema by appending.
+var migrations = []string{
+	// 1: dashboards and the widgets placed on them
+	`CREATE TABLE dashboards (
+		id         TEXT PRIMARY KEY,
+		title      TEXT NOT NULL DEFAULT '',
+		version    INTEGER NOT NULL DEFAULT 1,
+		created_at TEXT NOT NULL,
+		updated_at TEXT NOT NULL
+	);
+
+	CREATE TABLE widgets (
+		dashboard_id TEXT NOT NULL REFERENCES dashboards (id) ON DELETE CASCADE,
+		id           TEXT NOT NULL,
+		type         TEXT NOT NULL,
+		title        TEXT NOT NULL DEFAULT '',
+		class        TEXT NOT NULL DEFAULT '',
+		style        TEXT NOT NULL DEFAULT '',
+		hidden       INTEGER NOT NULL DEFAULT 0,
+		x            INTEGER NOT NULL DEFAULT 0,
+		y            INTEGER NOT NULL DEFAULT 0,
+		w            INTEGER NOT NULL DEFAULT 1,
+		h            INTEGER NOT NULL DEFAULT 1,
+		settings     TEXT NOT NULL DEFAULT '',
+		source       TEXT NOT NULL DEFAULT '',
+		PRIMARY KEY (dashboard_id, id)
+	);`,
+
+	// 2: accounts allowed to sign in
+	`CREATE TABLE accounts (
+		id         TEXT PRIMARY KEY,
+		uuid       TEXT NOT NULL UNIQUE,
+		password   TEXT NOT NULL,
+		role       INTEGER NOT NULL DEFAULT 0,
+		created_at TEXT NOT NULL
+	);`,
+
+	// 3: dashboard owners and widgets restricted to a role
+	`ALTER TABLE dashboards ADD COLUMN owner TEXT NOT NULL DEFAULT '';
+	ALTER TABLE widgets ADD COLUMN min_role INTEGER NOT NULL DEFAULT 0;`,
+
+	// 4: issued API tokens, kept to list and revoke them
+	`CREATE TABLE tokens (
+		id         TEXT PRIMARY KEY,
+		name       TEXT NOT NULL DEFAULT '',
+		account_id TEXT NOT NULL,
+		scopes     TEXT NOT NULL,
+		issued_at  TEXT NOT NULL,
+		expires_at TEXT NOT NULL,
+		revoked_at TEXT NOT NULL DEFAULT ''
+	);
+	CREATE INDEX tokens_issued_at ON tokens (issued_at);`,
+}
+
+// migrate brings the schema up to date, each migration in its own transaction
+func migrate(ctx context.Context, db *sql.DB) error {
+	if _, err := db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    INTEGER PRIMARY KEY,
+		applied_at TEXT NOT NULL
+	)`); err != nil {
+		return fmt.Errorf("create schema_migrations: %w", err)
+	}
+
+	var current int
+	if err := db.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&current); err != nil {
+		return fmt.Errorf("read schema version: %w", err)
+	}
+	if current > len(migrations) {
+		return fmt.Errorf("database schema version %d is newer than this build of wasmdash supports (%d)", current, len(migrations))
+	}
+
+	for version := current + 1; version <= len(migrations); version++ {
+		if err := apply(ctx, db, version); err != nil {
+			return fmt.Errorf("migration %d: %w", version, err)
+		}
+	}
+	return nil
+}
+
+func apply(ctx context.Context, db *sql.DB, version int) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, migrations[version-1]); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `INSERT INTO schema_migrations (version, applied_at) VALUES (?, ?)`,
+		version, time.Now().UTC().Format(timeFormat)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
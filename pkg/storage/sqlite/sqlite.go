@@ -0,0 +1,227 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/pynezz/wasmdash/pkg/storage"
+
+	// Pure-Go SQLite driver, registered as "sqlite"
+	_ "modernc.org/sqlite"
+)
+
+// timeFormat is how timestamps are stored, sortable as text
+const timeFormat = time.RFC3339Nano
+
+// Store is a storage.Store backed by a SQLite database file
+type Store struct {
+	db *sql.DB
+}
+
+var _ storage.Store = (*Store)(nil)
+
+// Open opens the database at path, creating it if needed,
+// and migrates it to the latest schema
+func Open(ctx context.Context, path string) (*Store, error) {
+	pragmas := url.Values{"_pragma": {
+		"foreign_keys(1)",
+		"busy_timeout(5000)",
+		"journal_mode(WAL)",
+	}}
+	db, err := sql.Open("sqlite", "file:"+path+"?"+pragmas.Encode())
+	if err != nil {
+		return nil, err
+	}
+	// SQLite allows a single writer, a single connection avoids SQLITE_BUSY
+	db.SetMaxOpenConns(1)
+
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("open %s: %w", path, err)
+	}
+	if err := migrate(ctx, db); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("migrate %s: %w", path, err)
+	}
+
+	return &Store{db: db}, nil
+}
+
+func (s *Store) Dashboards(ctx context.Context) ([]storage.Dashboard, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT id, title, owner, version, created_at, updated_at FROM dashboards ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []storage.Dashboard
+	for rows.Next() {
+		d, err := scanDashboard(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, d)
+	}
+	return list, rows.Err()
+}
+
+func (s *Store) Dashboard(ctx context.Context, id string) (storage.Dashboard, error) {
+	d, err := scanDashboard(s.db.QueryRowContext(ctx,
+		`SELECT id, title, owner, version, created_at, updated_at FROM dashboards WHERE id = ?`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return d, storage.ErrNotFound
+	}
+	if err != nil {
+		return d, err
+	}
+
+	rows, err := s.db.QueryContext(ctx, `SELECT id, type, title, class, style, hidden, min_role, x, y, w, h, settings, source
+		FROM widgets WHERE dashboard_id = ? ORDER BY y, x, id`, id)
+	if err != nil {
+		return d, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			w        storage.Widget
+			settings string
+		)
+		if err := rows.Scan(&w.ID, &w.Type, &w.Title, &w.Class, &w.Style, &w.Hidden, &w.MinRole,
+			&w.Position.X, &w.Position.Y, &w.Position.W, &w.Position.H, &settings, &w.Source); err != nil {
+			return d, err
+		}
+		if settings != "" {
+			w.Settings = []byte(settings)
+		}
+		d.Widgets = append(d.Widgets, w)
+	}
+	return d, rows.Err()
+}
+
+func (s *Store) SaveDashboard(ctx context.Context, d storage.Dashboard) (storage.Dashboard, error) {
+	if err := d.Validate(); err != nil {
+		return storage.Dashboard{}, err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return storage.Dashboard{}, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	var (
+		stored  int64
+		created string
+	)
+	err = tx.QueryRowContext(ctx, `SELECT version, created_at FROM dashboards WHERE id = ?`, d.ID).Scan(&stored, &created)
+	exists := err == nil
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return storage.Dashboard{}, err
+	}
+
+	switch {
+	case d.Version == 0 && exists:
+		return storage.Dashboard{}, storage.ErrExists
+	case d.Version == 0:
+		d.CreatedAt, d.UpdatedAt, d.Version = now, now, 1
+		_, err = tx.ExecContext(ctx, `INSERT INTO dashboards (id, title, owner, version, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?)`,
+			d.ID, d.Title, d.Owner, d.Version, now.Format(timeFormat), now.Format(timeFormat))
+	case !exists:
+		return storage.Dashboard{}, storage.ErrNotFound
+	case d.Version != stored:
+		return storage.Dashboard{}, storage.ErrConflict
+	default:
+		if d.CreatedAt, err = time.Parse(timeFormat, created); err != nil {
+			return storage.Dashboard{}, err
+		}
+		d.UpdatedAt, d.Version = now, stored+1
+		_, err = tx.ExecContext(ctx, `UPDATE dashboards SET title = ?, owner = ?, version = ?, updated_at = ? WHERE id = ?`,
+			d.Title, d.Owner, d.Version, now.Format(timeFormat), d.ID)
+	}
+	if err != nil {
+		return storage.Dashboard{}, err
+	}
+
+	// Widgets are replaced as a whole, the dashboard is the unit of change
+	if _, err := tx.ExecContext(ctx, `DELETE FROM widgets WHERE dashboard_id = ?`, d.ID); err != nil {
+		return storage.Dashboard{}, err
+	}
+	for _, w := range d.Widgets {
+		if _, err := tx.ExecContext(ctx, `INSERT INTO widgets
+			(dashboard_id, id, type, title, class, style, hidden, min_role, x, y, w, h, settings, source)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			d.ID, w.ID, w.Type, w.Title, w.Class, w.Style, w.Hidden, w.MinRole,
+			w.Position.X, w.Position.Y, w.Position.W, w.Position.H, string(w.Settings), w.Source); err != nil {
+			return storage.Dashboard{}, fmt.Errorf("widget %q: %w", w.ID, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return storage.Dashboard{}, err
+	}
+	storage.SortWidgets(d.Widgets)
+	return d, nil
+}
+
+func (s *Store) DeleteDashboard(ctx context.Context, id string, version int64) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var stored int64
+	err = tx.QueryRowContext(ctx, `SELECT version FROM dashboards WHERE id = ?`, id).Scan(&stored)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return storage.ErrNotFound
+	case err != nil:
+		return err
+	case version != 0 && version != stored:
+		return storage.ErrConflict
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM dashboards WHERE id = ?`, id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *Store) Ping(ctx context.Context) error {
+	var one int
+	return s.db.QueryRowContext(ctx, `SELECT 1`).Scan(&one)
+}
+
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// scanner is implemented by both *sql.Row and *sql.Rows
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanDashboard(row scanner) (storage.Dashboard, error) {
+	var (
+		d                storage.Dashboard
+		created, updated string
+	)
+	if err := row.Scan(&d.ID, &d.Title, &d.Owner, &d.Version, &created, &updated); err != nil {
+		return d, err
+	}
+
+	var err error
+	if d.CreatedAt, err = time.Parse(timeFormat, created); err != nil {
+		return d, err
+	}
+	if d.UpdatedAt, err = time.Parse(timeFormat, updated); err != nil {
+		return d, err
+	}
+	return d, nil
+}
@@ -0,0 +1,278 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pynezz/wasmdash/pkg/storage"
+	"github.com/pynezz/wasmdash/pkg/ui/widgets"
+)
+
+// openTest opens a new database file in a temporary directory
+func openTest(t *testing.T) *Store {
+	t.Helper()
+	s, err := Open(context.Background(), filepath.Join(t.TempDir(), "wasmdash.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+// schemaVersion returns the highest migration applied to db
+func schemaVersion(t *testing.T, db *sql.DB) int {
+	t.Helper()
+	var version int
+	if err := db.QueryRow(`SELECT MAX(version) FROM schema_migrations`).Scan(&version); err != nil {
+		t.Fatal(err)
+	}
+	return version
+}
+
+func TestMigrate(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("empty", func(t *testing.T) {
+		if v := schemaVersion(t, openTest(t).db); v != len(migrations) {
+			t.Errorf("version = %d, want %d", v, len(migrations))
+		}
+	})
+
+	// A database left at each released version is brought up to date,
+	// keeping its dashboards
+	for from := 1; from < len(migrations); from++ {
+		t.Run("from "+strconv.Itoa(from), func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "wasmdash.db")
+			db, err := sql.Open("sqlite", "file:"+path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := db.Exec(`CREATE TABLE schema_migrations (version INTEGER PRIMARY KEY, applied_at TEXT NOT NULL)`); err != nil {
+				t.Fatal(err)
+			}
+			for version := 1; version <= from; version++ {
+				if err := apply(ctx, db, version); err != nil {
+					t.Fatalf("migration %d: %v", version, err)
+				}
+			}
+			now := time.Now().UTC().Format(timeFormat)
+			if _, err := db.Exec(`INSERT INTO dashboards (id, title, created_at, updated_at) VALUES ('old', 'Old', ?, ?)`, now, now); err != nil {
+				t.Fatal(err)
+			}
+			db.Close()
+
+			s, err := Open(ctx, path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer s.Close()
+			if v := schemaVersion(t, s.db); v != len(migrations) {
+				t.Errorf("version = %d, want %d", v, len(migrations))
+			}
+			d, err := s.Dashboard(ctx, "old")
+			if err != nil || d.Title != "Old" || d.Version != 1 {
+				t.Errorf("dashboard = %+v, %v, want Old at version 1", d, err)
+			}
+		})
+	}
+
+	t.Run("newer", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "wasmdash.db")
+		s, err := Open(ctx, path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.db.Exec(`INSERT INTO schema_migrations (version, applied_at) VALUES (?, '')`, len(migrations)+1); err != nil {
+			t.Fatal(err)
+		}
+		s.Close()
+
+		if _, err := Open(ctx, path); err == nil || !strings.Contains(err.Error(), "newer than this build") {
+			t.Errorf("Open = %v, want the schema rejected as newer", err)
+		}
+	})
+}
+
+func TestSaveDashboard(t *testing.T) {
+	ctx := context.Background()
+	s := openTest(t)
+
+	created, err := s.SaveDashboard(ctx, storage.Dashboard{ID: "ops", Title: "Ops"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created.Version != 1 || created.CreatedAt.IsZero() || !created.UpdatedAt.Equal(created.CreatedAt) {
+		t.Fatalf("created = %+v, want version 1 with its timestamps", created)
+	}
+
+	tests := []struct {
+		name    string
+		version int64
+		want    error
+	}{
+		{"create existing", 0, storage.ErrExists},
+		{"ahead", created.Version + 1, storage.ErrConflict},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := s.SaveDashboard(ctx, storage.Dashboard{ID: "ops", Title: "Changed", Version: tt.version})
+			if !errors.Is(err, tt.want) {
+				t.Errorf("err = %v, want %v", err, tt.want)
+			}
+		})
+	}
+	if _, err := s.SaveDashboard(ctx, storage.Dashboard{ID: "missing", Version: 1}); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("update missing: err = %v, want ErrNotFound", err)
+	}
+
+	time.Sleep(time.Millisecond)
+	created.Title = "Operations"
+	updated, err := s.SaveDashboard(ctx, created)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored, err := s.Dashboard(ctx, "ops")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range []storage.Dashboard{updated, stored} {
+		if d.Version != 2 || d.Title != "Operations" {
+			t.Errorf("dashboard = %+v, want Operations at version 2", d)
+		}
+		if !d.CreatedAt.Equal(created.CreatedAt) || !d.UpdatedAt.After(created.UpdatedAt) {
+			t.Errorf("created %v, updated %v, want created %v kept and updated later", d.CreatedAt, d.UpdatedAt, created.CreatedAt)
+		}
+	}
+
+	// The version read before the update is stale now
+	if _, err := s.SaveDashboard(ctx, created); !errors.Is(err, storage.ErrConflict) {
+		t.Errorf("save stale: err = %v, want ErrConflict", err)
+	}
+}
+
+func TestDeleteDashboard(t *testing.T) {
+	ctx := context.Background()
+	s := openTest(t)
+
+	d, err := s.SaveDashboard(ctx, storage.Dashboard{ID: "ops", Widgets: []storage.Widget{
+		{ID: "clock", Type: "clock", Position: widgets.Position{W: 1, H: 1}},
+		{ID: "notes", Type: "text", Position: widgets.Position{X: 1, W: 1, H: 1}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.SaveDashboard(ctx, storage.Dashboard{ID: "other", Widgets: []storage.Widget{
+		{ID: "clock", Type: "clock"},
+	}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.DeleteDashboard(ctx, "ops", d.Version+1); !errors.Is(err, storage.ErrConflict) {
+		t.Errorf("delete stale: err = %v, want ErrConflict", err)
+	}
+	if err := s.DeleteDashboard(ctx, "ops", d.Version); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.DeleteDashboard(ctx, "ops", 0); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("delete again: err = %v, want ErrNotFound", err)
+	}
+
+	// The widgets went with it, the other dashboard's stayed
+	var left int
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM widgets WHERE dashboard_id = 'ops'`).Scan(&left); err != nil {
+		t.Fatal(err)
+	}
+	if left != 0 {
+		t.Errorf("%d widgets left of the deleted dashboard", left)
+	}
+	if other, err := s.Dashboard(ctx, "other"); err != nil || len(other.Widgets) != 1 {
+		t.Errorf("other dashboard = %+v, %v, want its widget kept", other, err)
+	}
+}
+
+func TestSync(t *testing.T) {
+	ctx := context.Background()
+	s := openTest(t)
+
+	def := func(id, format string) widgets.Definition {
+		return widgets.Definition{
+			Name:     id,
+			Path:     "widgets/" + id + "/widget.toml",
+			Type:     "clock",
+			Widget:   widgets.Widget{ID: id, Title: id},
+			Settings: map[string]any{"format": format},
+		}
+	}
+	sync := func(defs ...widgets.Definition) storage.Dashboard {
+		t.Helper()
+		shadowed, err := storage.Sync(ctx, s, storage.DefaultDashboard, "Dashboard", defs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(shadowed) != 0 {
+			t.Errorf("shadowed = %v, want none", shadowed)
+		}
+		d, err := s.Dashboard(ctx, storage.DefaultDashboard)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return d
+	}
+
+	// Creates the dashboard, placing the widgets in order
+	d := sync(def("a", "24h"), def("b", "24h"))
+	if d.Version != 1 || len(d.Widgets) != 2 || d.Widgets[1].Position.X != 1 || d.Widgets[1].Source == "" {
+		t.Fatalf("first sync = %+v", d)
+	}
+
+	// Nothing changed, nothing saved
+	if again := sync(def("a", "24h"), def("b", "24h")); again.Version != d.Version {
+		t.Errorf("unchanged sync saved version %d", again.Version)
+	}
+
+	// A widget moved and one created at runtime are kept, b's settings
+	// change in place, a is dropped and c is placed below everything
+	d.Widgets[1].Position = widgets.Position{X: 2, Y: 3, W: 2, H: 1}
+	d.Widgets = append(d.Widgets, storage.Widget{ID: "mine", Type: "text", Position: widgets.Position{Y: 1, W: 1, H: 1}})
+	if _, err := s.SaveDashboard(ctx, d); err != nil {
+		t.Fatal(err)
+	}
+	d = sync(def("b", "12h"), def("c", "24h"))
+	got := map[string]storage.Widget{}
+	for _, w := range d.Widgets {
+		got[w.ID] = w
+	}
+	if _, ok := got["a"]; ok || len(got) != 3 {
+		t.Errorf("widgets = %v, want b, c and mine", got)
+	}
+	if b := got["b"]; b.Position != (widgets.Position{X: 2, Y: 3, W: 2, H: 1}) || !strings.Contains(string(b.Settings), "12h") {
+		t.Errorf("b = %+v, want it updated in place", b)
+	}
+	if c := got["c"]; c.Position.Y != 4 {
+		t.Errorf("c at row %d, want 4 below the layout", c.Position.Y)
+	}
+
+	// A widget.toml with the ID of the runtime widget doesn't replace it
+	shadowed, err := storage.Sync(ctx, s, storage.DefaultDashboard, "Dashboard", []widgets.Definition{def("b", "12h"), def("c", "24h"), def("mine", "24h")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(shadowed) != 1 || shadowed[0].Widget.ID != "mine" {
+		t.Errorf("shadowed = %v, want mine", shadowed)
+	}
+	d, err = s.Dashboard(ctx, storage.DefaultDashboard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, w := range d.Widgets {
+		if w.ID == "mine" && (w.Type != "text" || w.Source != "") {
+			t.Errorf("mine = %+v, want the runtime widget kept", w)
+		}
+	}
+}
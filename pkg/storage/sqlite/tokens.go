@@ -0,0 +1,107 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/pynezz/wasmdash/pkg/auth"
+	"github.com/pynezz/wasmdash/pkg/storage"
+)
+
+const tokenColumns = `id, name, account_id, scopes, issued_at, expires_at, revoked_at`
+
+func (s *Store) Tokens(ctx context.Context) ([]auth.Token, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+tokenColumns+` FROM tokens ORDER BY issued_at DESC, id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []auth.Token
+	for rows.Next() {
+		t, err := scanToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, t)
+	}
+	return list, rows.Err()
+}
+
+func (s *Store) Token(ctx context.Context, id string) (auth.Token, error) {
+	t, err := scanToken(s.db.QueryRowContext(ctx, `SELECT `+tokenColumns+` FROM tokens WHERE id = ?`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return t, storage.ErrNotFound
+	}
+	return t, err
+}
+
+func (s *Store) SaveToken(ctx context.Context, t auth.Token) error {
+	if err := storage.ValidateToken(t); err != nil {
+		return err
+	}
+	res, err := s.db.ExecContext(ctx, `INSERT INTO tokens (`+tokenColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (id) DO NOTHING`,
+		t.ID, t.Name, t.Account, strings.Join(t.Scopes, " "),
+		t.IssuedAt.UTC().Format(timeFormat), t.ExpiresAt.UTC().Format(timeFormat), formatOptional(t.RevokedAt))
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return storage.ErrExists
+	}
+	return nil
+}
+
+func (s *Store) RevokeToken(ctx context.Context, id string, at time.Time) error {
+	res, err := s.db.ExecContext(ctx, `UPDATE tokens
+		SET revoked_at = CASE WHEN revoked_at = '' THEN ? ELSE revoked_at END
+		WHERE id = ?`, at.UTC().Format(timeFormat), id)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return storage.ErrNotFound
+	}
+	return nil
+}
+
+func scanToken(row scanner) (auth.Token, error) {
+	var (
+		t                        auth.Token
+		scopes                   string
+		issued, expires, revoked string
+	)
+	if err := row.Scan(&t.ID, &t.Name, &t.Account, &scopes, &issued, &expires, &revoked); err != nil {
+		return t, err
+	}
+	t.Scopes = strings.Fields(scopes)
+
+	var err error
+	if t.IssuedAt, err = time.Parse(timeFormat, issued); err != nil {
+		return t, err
+	}
+	if t.ExpiresAt, err = time.Parse(timeFormat, expires); err != nil {
+		return t, err
+	}
+	if revoked != "" {
+		t.RevokedAt, err = time.Parse(timeFormat, revoked)
+	}
+	return t, err
+}
+
+// formatOptional stores a zero time as an empty string
+func formatOptional(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(timeFormat)
+}
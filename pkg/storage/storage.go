@@ -0,0 +1,203 @@
+package storage
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/pynezz/wasmdash/pkg/auth"
+	"github.com/pynezz/wasmdash/pkg/ui/widgets"
+)
+
+/*
+ * Persistent dashboard layouts and accounts
+ *
+ * A Store holds dashboards and the widget instances placed on them, the
+ * accounts allowed to sign in and the API tokens issued to them. The server
+ * only depends on the interface: pkg/storage/sqlite is used when a database
+ * path is configured, Memory otherwise and in tests.
+ */
+
+// DefaultDashboard is the dashboard served at /dashboard
+const DefaultDashboard = "default"
+
+var (
+	// ErrNotFound is returned when a dashboard or account does not exist
+	ErrNotFound = errors.New("storage: not found")
+
+	// ErrExists is returned when creating a dashboard whose ID is taken
+	ErrExists = errors.New("storage: already exists")
+
+	// ErrConflict is returned when a dashboard changed since it was read
+	ErrConflict = errors.New("storage: version conflict")
+)
+
+// Dashboard is a named layout of widgets
+type Dashboard struct {
+	ID        string    `json:"id"`
+	Title     string    `json:"title"`
+	Owner     string    `json:"owner,omitempty"` // Account that may edit it besides admins, see pkg/auth
+	Version   int64     `json:"version"`         // Incremented on every save
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Widgets   []Widget  `json:"widgets"`
+}
+
+// Widget is a widget instance placed on a dashboard
+type Widget struct {
+	ID       string           `json:"id"` // Unique within the dashboard
+	Type     string           `json:"type"`
+	Title    string           `json:"title,omitempty"`
+	Class    string           `json:"class,omitempty"`
+	Style    string           `json:"style,omitempty"`
+	Hidden   bool             `json:"hidden,omitempty"`
+	MinRole  int              `json:"min_role,omitempty"` // Least role to see the widget
+	Position widgets.Position `json:"position"`
+	Settings json.RawMessage  `json:"settings,omitempty"` // Type-specific settings as a JSON object
+
+	// Source is the widget.toml the widget was synced from,
+	// empty for widgets that were created at runtime
+	Source string `json:"source,omitempty"`
+}
+
+// Store persists dashboards. Implementations must be safe for concurrent use.
+type Store interface {
+	// Dashboards lists all dashboards sorted by ID, without their widgets
+	Dashboards(ctx context.Context) ([]Dashboard, error)
+
+	// Dashboard returns a dashboard with its widgets in layout order,
+	// or ErrNotFound
+	Dashboard(ctx context.Context, id string) (Dashboard, error)
+
+	// SaveDashboard creates or replaces a dashboard together with all of
+	// its widgets, and returns it with the new version and timestamps.
+	// d.Version is the version the change is based on: 0 creates the
+	// dashboard (ErrExists if it exists), anything else must match the
+	// stored version (ErrConflict) of an existing dashboard (ErrNotFound).
+	SaveDashboard(ctx context.Context, d Dashboard) (Dashboard, error)
+
+	// DeleteDashboard removes a dashboard and its widgets. A version other
+	// than 0 must match the stored one, like for SaveDashboard.
+	DeleteDashboard(ctx context.Context, id string, version int64) error
+
+	// Accounts lists all accounts sorted by ID
+	Accounts(ctx context.Context) ([]auth.Account, error)
+
+	// Account returns an account, or ErrNotFound
+	Account(ctx context.Context, id string) (auth.Account, error)
+
+	// SaveAccount creates or replaces an account. Its password must
+	// already be hashed.
+	SaveAccount(ctx context.Context, a auth.Account) error
+
+	// DeleteAccount removes an account, or returns ErrNotFound
+	DeleteAccount(ctx context.Context, id string) error
+
+	// Tokens lists all issued API tokens, the newest first
+	Tokens(ctx context.Context) ([]auth.Token, error)
+
+	// Token returns an issued API token, or ErrNotFound
+	Token(ctx context.Context, id string) (auth.Token, error)
+
+	// SaveToken records a newly issued API token, or returns ErrExists
+	SaveToken(ctx context.Context, t auth.Token) error
+
+	// RevokeToken marks a token revoked at the given time, or returns
+	// ErrNotFound. A token revoked before keeps its first revocation time.
+	RevokeToken(ctx context.Context, id string, at time.Time) error
+
+	// Ping checks the store can be read, for /readyz
+	Ping(ctx context.Context) error
+
+	Close() error
+}
+
+// Validate checks the invariants every Store relies on
+func (d Dashboard) Validate() error {
+	if d.ID == "" {
+		return errors.New("storage: dashboard id must not be empty")
+	}
+	seen := make(map[string]bool, len(d.Widgets))
+	for _, w := range d.Widgets {
+		switch {
+		case w.ID == "":
+			return fmt.Errorf("storage: dashboard %q: widget id must not be empty", d.ID)
+		case w.Type == "":
+			return fmt.Errorf("storage: dashboard %q: widget %q has no type", d.ID, w.ID)
+		case seen[w.ID]:
+			return fmt.Errorf("storage: dashboard %q: duplicate widget %q", d.ID, w.ID)
+		case !auth.ValidRole(w.MinRole):
+			return fmt.Errorf("storage: dashboard %q: widget %q has unknown min_role %d", d.ID, w.ID, w.MinRole)
+		}
+		seen[w.ID] = true
+	}
+	return nil
+}
+
+// Base returns the fields shared by all widget types
+func (w Widget) Base() widgets.Widget {
+	return widgets.Widget{
+		ID:      w.ID,
+		Class:   w.Class,
+		Style:   w.Style,
+		Title:   w.Title,
+		Hidden:  w.Hidden,
+		MinRole: w.MinRole,
+	}
+}
+
+// Definition creates the widget through the registered widget type.
+// Invalid settings don't fail the dashboard, the widget reports them instead.
+func (w Widget) Definition() widgets.Definition {
+	def := widgets.Definition{
+		Name:     w.ID,
+		Path:     w.Source,
+		Type:     w.Type,
+		Widget:   w.Base(),
+		Position: w.Position,
+	}
+
+	kind, err := widgets.New(w.Type, def.Widget, widgets.JSONSettings(w.Settings))
+	if err != nil {
+		kind = widgets.Failed(err)
+	}
+	def.Kind = kind
+	return def
+}
+
+// Definitions creates all widgets of the dashboard in layout order
+func (d Dashboard) Definitions() []widgets.Definition {
+	defs := make([]widgets.Definition, 0, len(d.Widgets))
+	for _, w := range d.Widgets {
+		def := w.Definition()
+		def.Dashboard = d.ID
+		defs = append(defs, def)
+	}
+	return defs
+}
+
+// Bottom returns the first grid row below all widgets
+func Bottom(ws []Widget) int {
+	bottom := 0
+	for _, w := range ws {
+		bottom = max(bottom, w.Position.Y+max(w.Position.H, 1))
+	}
+	return bottom
+}
+
+// SortWidgets orders widgets row by row, as they are laid out on the grid
+func SortWidgets(ws []Widget) {
+	slices.SortStableFunc(ws, func(a, b Widget) int {
+		if c := cmp.Compare(a.Position.Y, b.Position.Y); c != 0 {
+			return c
+		}
+		if c := cmp.Compare(a.Position.X, b.Position.X); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.ID, b.ID)
+	})
+}
@@ -0,0 +1,110 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+
+	"github.com/pynezz/wasmdash/pkg/ui/widgets"
+)
+
+// Sync makes the widgets defined in widget.toml files part of the dashboard,
+// creating it if needed:
+//   - new definitions are appended below the existing layout
+//   - changed definitions are updated in place, keeping their position
+//   - widgets whose widget.toml was removed are dropped
+//
+// Widgets that weren't synced from a file are left alone. A definition
+// with the ID of such a widget isn't synced, it's returned in shadowed.
+// The dashboard is only saved, and its version bumped, if anything changed.
+func Sync(ctx context.Context, s Store, id, title string, defs []widgets.Definition) (shadowed []widgets.Definition, err error) {
+	d, err := s.Dashboard(ctx, id)
+	if errors.Is(err, ErrNotFound) {
+		d, err = Dashboard{ID: id, Title: title}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	byID := make(map[string]widgets.Definition, len(defs))
+	for _, def := range defs {
+		byID[def.Widget.ID] = def
+	}
+
+	var (
+		synced []Widget
+		placed = make(map[string]bool)
+	)
+	for _, w := range d.Widgets {
+		if w.Source == "" {
+			synced = append(synced, w)
+			if def, ok := byID[w.ID]; ok {
+				shadowed = append(shadowed, def)
+			}
+		} else if def, ok := byID[w.ID]; ok {
+			updated, err := fromDefinition(def)
+			if err != nil {
+				return nil, err
+			}
+			updated.Position = w.Position
+			synced = append(synced, updated)
+		} else {
+			continue
+		}
+		placed[w.ID] = true
+	}
+
+	// New widgets fill rows below everything that's already placed
+	bottom, n := Bottom(synced), 0
+	for _, def := range defs {
+		if placed[def.Widget.ID] {
+			continue
+		}
+		w, err := fromDefinition(def)
+		if err != nil {
+			return nil, err
+		}
+		w.Position = widgets.Position{
+			X: n % widgets.GridColumns,
+			Y: bottom + n/widgets.GridColumns,
+			W: 1,
+			H: 1,
+		}
+		synced = append(synced, w)
+		n++
+	}
+	SortWidgets(synced)
+
+	if d.Version > 0 && reflect.DeepEqual(synced, d.Widgets) {
+		return shadowed, nil
+	}
+	d.Widgets = synced
+	if _, err := s.SaveDashboard(ctx, d); err != nil {
+		return nil, err
+	}
+	return shadowed, nil
+}
+
+// fromDefinition converts a widget loaded from widget.toml
+func fromDefinition(def widgets.Definition) (Widget, error) {
+	w := Widget{
+		ID:      def.Widget.ID,
+		Type:    def.Type,
+		Title:   def.Widget.Title,
+		Class:   def.Widget.Class,
+		Style:   def.Widget.Style,
+		Hidden:  def.Widget.Hidden,
+		MinRole: def.Widget.MinRole,
+		Source:  def.Path,
+	}
+	if def.Settings != nil {
+		settings, err := json.Marshal(def.Settings)
+		if err != nil {
+			return w, fmt.Errorf("%s: settings: %w", def.Path, err)
+		}
+		w.Settings = settings
+	}
+	return w, nil
+}
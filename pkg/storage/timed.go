@@ -0,0 +1,85 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"github.com/pynezz/wasmdash/pkg/auth"
+	"github.com/pynezz/wasmdash/pkg/timing"
+)
+
+// timed records how long every query takes in the Server-Timing of the
+// request it's made for
+type timed struct {
+	Store
+}
+
+// Timed wraps s to time its queries, see pkg/timing
+func Timed(s Store) Store {
+	return &timed{Store: s}
+}
+
+// timeQuery times a query, all of them add up to one metric
+func timeQuery(ctx context.Context) func() {
+	return timing.Start(ctx, "store", "Store queries")
+}
+
+func (s *timed) Dashboards(ctx context.Context) ([]Dashboard, error) {
+	defer timeQuery(ctx)()
+	return s.Store.Dashboards(ctx)
+}
+
+func (s *timed) Dashboard(ctx context.Context, id string) (Dashboard, error) {
+	defer timeQuery(ctx)()
+	return s.Store.Dashboard(ctx, id)
+}
+
+func (s *timed) SaveDashboard(ctx context.Context, d Dashboard) (Dashboard, error) {
+	defer timeQuery(ctx)()
+	return s.Store.SaveDashboard(ctx, d)
+}
+
+func (s *timed) DeleteDashboard(ctx context.Context, id string, version int64) error {
+	defer timeQuery(ctx)()
+	return s.Store.DeleteDashboard(ctx, id, version)
+}
+
+func (s *timed) Accounts(ctx context.Context) ([]auth.Account, error) {
+	defer timeQuery(ctx)()
+	return s.Store.Accounts(ctx)
+}
+
+func (s *timed) Account(ctx context.Context, id string) (auth.Account, error) {
+	defer timeQuery(ctx)()
+	return s.Store.Account(ctx, id)
+}
+
+func (s *timed) SaveAccount(ctx context.Context, a auth.Account) error {
+	defer timeQuery(ctx)()
+	return s.Store.SaveAccount(ctx, a)
+}
+
+func (s *timed) DeleteAccount(ctx context.Context, id string) error {
+	defer timeQuery(ctx)()
+	return s.Store.DeleteAccount(ctx, id)
+}
+
+func (s *timed) Tokens(ctx context.Context) ([]auth.Token, error) {
+	defer timeQuery(ctx)()
+	return s.Store.Tokens(ctx)
+}
+
+func (s *timed) Token(ctx context.Context, id string) (auth.Token, error) {
+	defer timeQuery(ctx)()
+	return s.Store.Token(ctx, id)
+}
+
+func (s *timed) SaveToken(ctx context.Context, t auth.Token) error {
+	defer timeQuery(ctx)()
+	return s.Store.SaveToken(ctx, t)
+}
+
+func (s *timed) RevokeToken(ctx context.Context, id string, at time.Time) error {
+	defer timeQuery(ctx)()
+	return s.Store.RevokeToken(ctx, id, at)
+}
@@ -0,0 +1,98 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pynezz/wasmdash/pkg/auth"
+)
+
+// maxTokenName keeps token names within what a table cell can show
+const maxTokenName = 100
+
+// ValidateToken checks the invariants every Store relies on
+func ValidateToken(t auth.Token) error {
+	if t.ID == "" {
+		return errors.New("storage: token has no id")
+	}
+	if err := auth.ValidID(t.Account); err != nil {
+		return fmt.Errorf("storage: token %s: account %w", t.ID, err)
+	}
+	if err := auth.ValidScopes(t.Scopes); err != nil {
+		return fmt.Errorf("storage: token %s: scope %w", t.ID, err)
+	}
+	if len(t.Name) > maxTokenName {
+		return fmt.Errorf("storage: token %s: name must be at most %d characters", t.ID, maxTokenName)
+	}
+	if t.IssuedAt.IsZero() || !t.ExpiresAt.After(t.IssuedAt) {
+		return fmt.Errorf("storage: token %s: must expire after it's issued", t.ID)
+	}
+	return nil
+}
+
+// IssueToken signs a token for t.Account with t.Name and t.Scopes, valid
+// for ttl from now, and records it in s. The account must have the role
+// the scopes grant. The signed token is returned together with the record,
+// it can't be recovered later.
+func IssueToken(ctx context.Context, s Store, signer *auth.Signer, t auth.Token, ttl time.Duration) (string, auth.Token, error) {
+	if ttl <= 0 {
+		return "", t, errors.New("a token must be valid for a positive duration")
+	}
+	if err := auth.ValidScopes(t.Scopes); err != nil {
+		return "", t, fmt.Errorf("scope %w", err)
+	}
+	account, err := s.Account(ctx, t.Account)
+	if err != nil {
+		return "", t, fmt.Errorf("account %q: %w", t.Account, err)
+	}
+	if role := auth.ScopeRole(t.Scopes); account.Role < role {
+		return "", t, fmt.Errorf("account %q has role %d, the scopes need %d", account.ID, account.Role, role)
+	}
+
+	// Whole seconds, as the signed claims have them
+	now := time.Now().UTC().Truncate(time.Second)
+	t.ID = uuid.NewString()
+	t.IssuedAt, t.ExpiresAt, t.RevokedAt = now, now.Add(ttl), time.Time{}
+
+	signed, err := signer.Sign(t)
+	if err != nil {
+		return "", t, err
+	}
+	if err := s.SaveToken(ctx, t); err != nil {
+		return "", t, err
+	}
+	return signed, t, nil
+}
+
+// CheckToken verifies a signed token at now and returns the account it acts
+// for, with the role limited to what the token's scopes grant. Tokens that
+// weren't recorded by IssueToken, were revoked, or whose account is gone
+// are auth.ErrInvalidToken.
+func CheckToken(ctx context.Context, s Store, signer *auth.Signer, signed string, now time.Time) (auth.Account, auth.Token, error) {
+	claimed, err := signer.Verify(signed, now)
+	if err != nil {
+		return auth.Account{}, claimed, err
+	}
+
+	t, err := s.Token(ctx, claimed.ID)
+	if errors.Is(err, ErrNotFound) {
+		return auth.Account{}, claimed, auth.ErrInvalidToken
+	} else if err != nil {
+		return auth.Account{}, claimed, err
+	}
+	if t.Account != claimed.Account || !t.Active(now) {
+		return auth.Account{}, t, auth.ErrInvalidToken
+	}
+
+	account, err := s.Account(ctx, t.Account)
+	if errors.Is(err, ErrNotFound) {
+		return auth.Account{}, t, auth.ErrInvalidToken
+	} else if err != nil {
+		return auth.Account{}, t, err
+	}
+	account.Role = min(account.Role, auth.ScopeRole(t.Scopes))
+	return account, t, nil
+}
@@ -0,0 +1,110 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pynezz/wasmdash/pkg/auth"
+)
+
+func TestCheckToken(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemory()
+	hash, err := auth.HashPassword("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for id, role := range map[string]int{"admin": auth.RoleAdmin, "bob": auth.RoleUser, "gone": auth.RoleAdmin} {
+		a := auth.Account{ID: id, UUID: uuid.NewString(), Password: hash, Role: role, Creation: time.Now()}
+		if err := store.SaveAccount(ctx, a); err != nil {
+			t.Fatal(err)
+		}
+	}
+	key, _ := auth.GenerateSigningKey("ed25519")
+	signer, err := auth.ParseSigningKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issue := func(account string, scopes ...string) (string, auth.Token) {
+		t.Helper()
+		signed, token, err := IssueToken(ctx, store, signer, auth.Token{Account: account, Scopes: scopes}, time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signed, token
+	}
+
+	read, _ := issue("admin", auth.ScopeRead)
+	write, _ := issue("admin", auth.ScopeWrite)
+	admin, _ := issue("admin", auth.ScopeRead, auth.ScopeAdmin)
+	bob, _ := issue("bob", auth.ScopeWrite)
+	revoked, revokedToken := issue("admin", auth.ScopeAdmin)
+	if err := store.RevokeToken(ctx, revokedToken.ID, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	gone, _ := issue("gone", auth.ScopeAdmin)
+	if err := store.DeleteAccount(ctx, "gone"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Signed with the right key, but claiming more than was recorded
+	now := time.Now().UTC().Truncate(time.Second)
+	_, recorded := issue("bob", auth.ScopeRead)
+	escalated, err := signer.Sign(auth.Token{ID: recorded.ID, Account: "bob", Scopes: []string{auth.ScopeAdmin}, IssuedAt: now, ExpiresAt: now.Add(time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherAccount, err := signer.Sign(auth.Token{ID: recorded.ID, Account: "admin", Scopes: []string{auth.ScopeRead}, IssuedAt: now, ExpiresAt: now.Add(time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	extended, err := signer.Sign(auth.Token{ID: recorded.ID, Account: "bob", Scopes: []string{auth.ScopeRead}, IssuedAt: now, ExpiresAt: now.Add(48 * time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	unrecorded, err := signer.Sign(auth.Token{ID: uuid.NewString(), Account: "admin", Scopes: []string{auth.ScopeAdmin}, IssuedAt: now, ExpiresAt: now.Add(time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		at      time.Time
+		role    int
+		account string
+		err     error
+	}{
+		{"read", read, now, auth.RoleGuest, "admin", nil},
+		{"write", write, now, auth.RoleUser, "admin", nil},
+		{"admin", admin, now, auth.RoleAdmin, "admin", nil},
+		{"scope above the account's role", bob, now, auth.RoleUser, "bob", nil},
+		{"stored scopes win over the claims", escalated, now, auth.RoleGuest, "bob", nil},
+		{"revoked", revoked, now, 0, "", auth.ErrInvalidToken},
+		{"account deleted", gone, now, 0, "", auth.ErrInvalidToken},
+		{"other account than recorded", otherAccount, now, 0, "", auth.ErrInvalidToken},
+		{"expired as recorded", extended, now.Add(2 * time.Hour), 0, "", auth.ErrInvalidToken},
+		{"never issued", unrecorded, now, 0, "", auth.ErrInvalidToken},
+		{"expired", read, now.Add(2 * time.Hour), 0, "", auth.ErrExpiredToken},
+		{"not yet issued", read, now.Add(-time.Hour), 0, "", auth.ErrInvalidToken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			account, _, err := CheckToken(ctx, store, signer, tt.token, tt.at)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("err = %v, want %v", err, tt.err)
+			}
+			if err == nil && (account.ID != tt.account || account.Role != tt.role) {
+				t.Errorf("account %s with role %d, want %s with %d", account.ID, account.Role, tt.account, tt.role)
+			}
+		})
+	}
+
+	// The scopes a token is issued with must be within the account's role
+	if _, _, err := IssueToken(ctx, store, signer, auth.Token{Account: "bob", Scopes: []string{auth.ScopeAdmin}}, time.Hour); err == nil {
+		t.Error("issued an admin token to a user")
+	}
+}
@@ -0,0 +1,118 @@
+//go:build linux
+
+package system
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// readCPU parses the aggregate "cpu" line of /proc/stat:
+//
+//	cpu  user nice system idle iowait irq softirq steal guest guest_nice
+//
+// Guest time is already counted in user and nice, so it's left out.
+func readCPU(proc string) (cpuTimes, error) {
+	data, err := os.ReadFile(filepath.Join(proc, "stat"))
+	if err != nil {
+		return cpuTimes{}, err
+	}
+
+	line, _, _ := bytes.Cut(data, []byte("\n"))
+	fields := strings.Fields(string(line))
+	if len(fields) < 5 || fields[0] != "cpu" {
+		return cpuTimes{}, fmt.Errorf("%s/stat: unexpected format", proc)
+	}
+
+	var (
+		times cpuTimes
+		n     = min(len(fields), 9) // user through steal
+	)
+	for i := 1; i < n; i++ {
+		v, err := strconv.ParseUint(fields[i], 10, 64)
+		if err != nil {
+			return cpuTimes{}, fmt.Errorf("%s/stat: %w", proc, err)
+		}
+		times.total += v
+		if i == 4 || i == 5 { // idle, iowait
+			times.idle += v
+		}
+	}
+	return times, nil
+}
+
+// readMemory reads MemTotal and MemAvailable from /proc/meminfo, in kB
+func readMemory(proc string) (Usage, error) {
+	f, err := os.Open(filepath.Join(proc, "meminfo"))
+	if err != nil {
+		return Usage{}, err
+	}
+	defer f.Close()
+
+	var total, available uint64
+	found := 0
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() && found < 2 {
+		key, value, ok := strings.Cut(scanner.Text(), ":")
+		if !ok || (key != "MemTotal" && key != "MemAvailable") {
+			continue
+		}
+		kb, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimSpace(value), " kB"), 10, 64)
+		if err != nil {
+			return Usage{}, fmt.Errorf("%s/meminfo: %s: %w", proc, key, err)
+		}
+		if key == "MemTotal" {
+			total = kb * 1024
+		} else {
+			available = kb * 1024
+		}
+		found++
+	}
+	if err := scanner.Err(); err != nil {
+		return Usage{}, err
+	}
+	if found < 2 {
+		return Usage{}, fmt.Errorf("%s/meminfo: MemTotal or MemAvailable missing", proc)
+	}
+
+	used := total - min(available, total)
+	return Usage{Used: used, Total: total, Percent: percent(used, total)}, nil
+}
+
+// readUptime reads the seconds since boot from /proc/uptime
+func readUptime(proc string) (time.Duration, error) {
+	data, err := os.ReadFile(filepath.Join(proc, "uptime"))
+	if err != nil {
+		return 0, err
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 {
+		return 0, fmt.Errorf("%s/uptime: empty", proc)
+	}
+	seconds, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return 0, fmt.Errorf("%s/uptime: %w", proc, err)
+	}
+	return time.Duration(seconds * float64(time.Second)), nil
+}
+
+// readDisk reports the usage of the filesystem at mount like df does:
+// blocks reserved for root count as neither used nor available
+func readDisk(mount string) (Usage, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(mount, &st); err != nil {
+		return Usage{}, fmt.Errorf("statfs %s: %w", mount, err)
+	}
+
+	size := uint64(st.Bsize)
+	used := (st.Blocks - st.Bfree) * size
+	available := st.Bavail * size
+	return Usage{Used: used, Total: st.Blocks * size, Percent: percent(used, used+available)}, nil
+}
@@ -0,0 +1,158 @@
+//go:build linux
+
+package system
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeProc writes the files of a fake procfs to a temporary directory
+func writeProc(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestReadCPU(t *testing.T) {
+	tests := []struct {
+		name string
+		stat string
+		want cpuTimes
+		ok   bool
+	}{
+		{"linux 5", "cpu  4705 356 584 3699176 23060 0 277 0 0 0\ncpu0 1393 280 234 852850 5225 0 8 0 0 0\nintr 114930548 113199788 3\n",
+			cpuTimes{idle: 3699176 + 23060, total: 4705 + 356 + 584 + 3699176 + 23060 + 277}, true},
+		{"guest left out", "cpu  100 0 100 700 100 0 0 0 50 50\n", cpuTimes{idle: 800, total: 1000}, true},
+		{"steal counted", "cpu  100 0 100 700 0 0 0 100\n", cpuTimes{idle: 700, total: 1000}, true},
+		{"linux 2.4, no iowait", "cpu  100 0 100 800\n", cpuTimes{idle: 800, total: 1000}, true},
+		{"too few fields", "cpu  100 0 100\n", cpuTimes{}, false},
+		{"per cpu first", "cpu0 100 0 100 800 0 0 0\n", cpuTimes{}, false},
+		{"not a number", "cpu  100 0 x 800 0 0 0\n", cpuTimes{}, false},
+		{"negative", "cpu  100 0 -1 800 0 0 0\n", cpuTimes{}, false},
+		{"empty", "", cpuTimes{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := readCPU(writeProc(t, map[string]string{"stat": tt.stat}))
+			if (err == nil) != tt.ok {
+				t.Fatalf("err = %v, want ok %t", err, tt.ok)
+			}
+			if got != tt.want {
+				t.Errorf("readCPU = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := readCPU(t.TempDir()); err == nil {
+		t.Error("readCPU without a stat file succeeded")
+	}
+}
+
+func TestReadMemory(t *testing.T) {
+	const gib = 1 << 30
+	tests := []struct {
+		name    string
+		meminfo string
+		want    Usage
+		ok      bool
+	}{
+		{"meminfo", "MemTotal:       16303744 kB\nMemFree:          954952 kB\nMemAvailable:    4075936 kB\nBuffers:          312012 kB\n",
+			Usage{Used: (16303744 - 4075936) * 1024, Total: 16303744 * 1024, Percent: 75}, true},
+		{"available first", "MemAvailable: 1048576 kB\nMemTotal: 4194304 kB\n", Usage{Used: 3 * gib, Total: 4 * gib, Percent: 75}, true},
+		{"all available", "MemTotal: 1048576 kB\nMemAvailable: 1048576 kB\n", Usage{Total: gib}, true},
+		{"more available than total", "MemTotal: 1048576 kB\nMemAvailable: 2097152 kB\n", Usage{Total: gib}, true},
+		{"zero total", "MemTotal: 0 kB\nMemAvailable: 0 kB\n", Usage{}, true},
+		{"no MemAvailable", "MemTotal: 1048576 kB\nMemFree: 524288 kB\n", Usage{}, false},
+		{"prefixed key", "MemTotalX: 1 kB\nMemAvailable: 1 kB\n", Usage{}, false},
+		{"not a number", "MemTotal: lots kB\nMemAvailable: 1 kB\n", Usage{}, false},
+		{"empty", "", Usage{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := readMemory(writeProc(t, map[string]string{"meminfo": tt.meminfo}))
+			if (err == nil) != tt.ok {
+				t.Fatalf("err = %v, want ok %t", err, tt.ok)
+			}
+			if got.Used != tt.want.Used || got.Total != tt.want.Total || int(got.Percent*100) != int(tt.want.Percent*100) {
+				t.Errorf("readMemory = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadUptime(t *testing.T) {
+	tests := []struct {
+		uptime string
+		want   time.Duration
+		ok     bool
+	}{
+		{"350735.47 234388.90\n", 350735*time.Second + 470*time.Millisecond, true},
+		{"12 7\n", 12 * time.Second, true},
+		{"0.00 0.00", 0, true},
+		{"", 0, false},
+		{"\n", 0, false},
+		{"soon 1.0\n", 0, false},
+	}
+	for _, tt := range tests {
+		got, err := readUptime(writeProc(t, map[string]string{"uptime": tt.uptime}))
+		if (err == nil) != tt.ok {
+			t.Errorf("%q: err = %v, want ok %t", tt.uptime, err, tt.ok)
+			continue
+		}
+		if got.Round(time.Millisecond) != tt.want {
+			t.Errorf("%q: readUptime = %v, want %v", tt.uptime, got, tt.want)
+		}
+	}
+}
+
+func TestCollectorSample(t *testing.T) {
+	c := NewCollector(Config{
+		Warning:  Thresholds{CPU: 50, Memory: 70},
+		Critical: Thresholds{CPU: 90, Memory: 95},
+	})
+	c.proc = writeProc(t, map[string]string{
+		"stat":    "cpu  100 0 100 800 0 0 0 0 0 0\n",
+		"meminfo": "MemTotal: 4194304 kB\nMemAvailable: 2097152 kB\n",
+		"uptime":  "3600.00 7000.00\n",
+	})
+	var samples []Snapshot
+	c.OnSample(func(s Snapshot) { samples = append(samples, s) })
+
+	// The first sample averages since boot
+	c.sample()
+	snap := c.Snapshot()
+	if snap.Err != nil || snap.CPU != 20 || snap.Memory.Percent != 50 || snap.Uptime != time.Hour || snap.Health != Healthy {
+		t.Fatalf("first sample = %+v", snap)
+	}
+
+	// The second one covers the time since the first: 95 of 100 ticks busy
+	os.WriteFile(filepath.Join(c.proc, "stat"), []byte("cpu  190 0 105 805 0 0 0 0 0 0\n"), 0o644)
+	os.WriteFile(filepath.Join(c.proc, "meminfo"), []byte("MemTotal: 4194304 kB\nMemAvailable: 1048576 kB\n"), 0o644)
+	c.sample()
+	snap = c.Snapshot()
+	if snap.CPU != 95 || snap.Health != Critical {
+		t.Fatalf("second sample = %+v", snap)
+	}
+	if want := []string{"cpu at 95%", "memory at 75%"}; len(snap.Reasons) != 2 || snap.Reasons[0] != want[0] || snap.Reasons[1] != want[1] {
+		t.Errorf("reasons = %q, want %q", snap.Reasons, want)
+	}
+
+	// A failed sample keeps the values, but not the health
+	os.Remove(filepath.Join(c.proc, "meminfo"))
+	c.sample()
+	snap = c.Snapshot()
+	if snap.Err == nil || snap.Health != Unknown || snap.CPU != 95 || len(snap.Reasons) != 1 {
+		t.Errorf("failed sample = %+v", snap)
+	}
+	if len(samples) != 3 || samples[2].Health != Unknown {
+		t.Errorf("listeners got %d samples, want 3", len(samples))
+	}
+}
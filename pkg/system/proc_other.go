@@ -0,0 +1,16 @@
+//go:build !linux
+
+package system
+
+import (
+	"errors"
+	"runtime"
+	"time"
+)
+
+var errUnsupported = errors.New("system metrics are not supported on " + runtime.GOOS)
+
+func readCPU(string) (cpuTimes, error)         { return cpuTimes{}, errUnsupported }
+func readMemory(string) (Usage, error)         { return Usage{}, errUnsupported }
+func readUptime(string) (time.Duration, error) { return 0, errUnsupported }
+func readDisk(string) (Usage, error)           { return Usage{}, errUnsupported }
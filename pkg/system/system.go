@@ -0,0 +1,222 @@
+package system
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+/*
+ * Host metrics for the system status card
+ *
+ * A Collector samples CPU, memory, uptime and disk usage in the background,
+ * so rendering a dashboard never waits on /proc. CPU usage is the share of
+ * non-idle time between two samples, the first sample averages since boot.
+ */
+
+// Health summarizes a snapshot against the configured thresholds
+type Health string
+
+const (
+	Healthy  Health = "healthy"
+	Warning  Health = "warning"
+	Critical Health = "critical"
+	Unknown  Health = "unknown" // Metrics are not available on this platform
+)
+
+// Thresholds are usage percentages, from 0 to 100
+type Thresholds struct {
+	CPU    float64
+	Memory float64
+	Disk   float64
+}
+
+// Config configures a Collector
+type Config struct {
+	Interval time.Duration
+	Mounts   []string // Mount points to report disk usage for
+	Warning  Thresholds
+	Critical Thresholds
+}
+
+// Usage is the used and total amount of a resource, in bytes
+type Usage struct {
+	Used    uint64
+	Total   uint64
+	Percent float64
+}
+
+// Disk is the usage of the filesystem mounted at Mount
+type Disk struct {
+	Mount string
+	Usage
+}
+
+// Snapshot is a single sample of the host metrics
+type Snapshot struct {
+	SampledAt time.Time
+	Uptime    time.Duration
+	CPU       float64 // Percent
+	Memory    Usage
+	Disks     []Disk
+	Health    Health
+	Reasons   []string // Why the health isn't Healthy, e.g. "memory at 91%"
+	Err       error    // Set if the last sample failed
+}
+
+// Collector samples the host metrics in the background
+type Collector struct {
+	config Config
+	proc   string // Mount point of procfs
+
+	mu        sync.RWMutex
+	latest    Snapshot
+	prev      cpuTimes
+	listeners []func(Snapshot)
+}
+
+// NewCollector returns a collector, start sampling with Run
+func NewCollector(config Config) *Collector {
+	if config.Interval <= 0 {
+		config.Interval = 5 * time.Second
+	}
+	return &Collector{
+		config: config,
+		proc:   "/proc",
+		latest: Snapshot{Health: Unknown},
+	}
+}
+
+// Run samples every interval until ctx is done
+func (c *Collector) Run(ctx context.Context) {
+	ticker := time.NewTicker(c.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		c.sample()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Snapshot returns the latest sample. Before the first sample, or if
+// sampling isn't supported, its Health is Unknown.
+func (c *Collector) Snapshot() Snapshot {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.latest
+}
+
+// OnSample registers fn to be called with every new sample
+func (c *Collector) OnSample(fn func(Snapshot)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.listeners = append(c.listeners, fn)
+}
+
+func (c *Collector) sample() {
+	snap, cpu, err := c.read()
+
+	c.mu.Lock()
+	if err != nil {
+		// Keep the last good values around, but don't claim they're healthy
+		c.latest.Err = err
+		c.latest.Health = Unknown
+		c.latest.Reasons = []string{err.Error()}
+	} else {
+		snap.CPU = cpu.percentSince(c.prev)
+		c.prev = cpu
+		snap.Health, snap.Reasons = c.evaluate(snap)
+		c.latest = snap
+	}
+	latest, listeners := c.latest, c.listeners
+	c.mu.Unlock()
+
+	for _, fn := range listeners {
+		fn(latest)
+	}
+}
+
+// read takes a sample, apart from the CPU percentage which needs the previous one
+func (c *Collector) read() (Snapshot, cpuTimes, error) {
+	snap := Snapshot{SampledAt: time.Now()}
+
+	cpu, err := readCPU(c.proc)
+	if err != nil {
+		return snap, cpu, err
+	}
+	if snap.Memory, err = readMemory(c.proc); err != nil {
+		return snap, cpu, err
+	}
+	if snap.Uptime, err = readUptime(c.proc); err != nil {
+		return snap, cpu, err
+	}
+	for _, mount := range c.config.Mounts {
+		usage, err := readDisk(mount)
+		if err != nil {
+			return snap, cpu, err
+		}
+		snap.Disks = append(snap.Disks, Disk{Mount: mount, Usage: usage})
+	}
+
+	return snap, cpu, nil
+}
+
+// evaluate derives the health from the worst metric
+func (c *Collector) evaluate(snap Snapshot) (Health, []string) {
+	var warnings, criticals []string
+	check := func(name string, value, warning, critical float64) {
+		switch {
+		case critical > 0 && value >= critical:
+			criticals = append(criticals, fmt.Sprintf("%s at %.0f%%", name, value))
+		case warning > 0 && value >= warning:
+			warnings = append(warnings, fmt.Sprintf("%s at %.0f%%", name, value))
+		}
+	}
+
+	check("cpu", snap.CPU, c.config.Warning.CPU, c.config.Critical.CPU)
+	check("memory", snap.Memory.Percent, c.config.Warning.Memory, c.config.Critical.Memory)
+	for _, disk := range snap.Disks {
+		check("disk "+disk.Mount, disk.Percent, c.config.Warning.Disk, c.config.Critical.Disk)
+	}
+
+	switch {
+	case len(criticals) > 0:
+		return Critical, append(criticals, warnings...)
+	case len(warnings) > 0:
+		return Warning, warnings
+	}
+	return Healthy, nil
+}
+
+// cpuTimes are the aggregate CPU counters, in clock ticks
+type cpuTimes struct {
+	idle  uint64
+	total uint64
+}
+
+// percentSince returns the non-idle share of the time passed since prev
+func (t cpuTimes) percentSince(prev cpuTimes) float64 {
+	total := t.total - prev.total
+	if t.total < prev.total || total == 0 {
+		return 0
+	}
+	// iowait is not guaranteed to be monotonic, so neither is idle
+	var idle uint64
+	if t.idle > prev.idle {
+		idle = min(t.idle-prev.idle, total)
+	}
+	return float64(total-idle) / float64(total) * 100
+}
+
+func percent(used, total uint64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(used) / float64(total) * 100
+}
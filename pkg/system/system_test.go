@@ -0,0 +1,71 @@
+package system
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestEvaluate(t *testing.T) {
+	c := NewCollector(Config{
+		Warning:  Thresholds{CPU: 80, Memory: 85, Disk: 90},
+		Critical: Thresholds{CPU: 95, Memory: 95, Disk: 98},
+	})
+	disks := func(percents ...float64) []Disk {
+		var ds []Disk
+		for i, p := range percents {
+			ds = append(ds, Disk{Mount: []string{"/", "/home"}[i], Usage: Usage{Percent: p}})
+		}
+		return ds
+	}
+
+	tests := []struct {
+		name    string
+		snap    Snapshot
+		health  Health
+		reasons []string
+	}{
+		{"idle", Snapshot{}, Healthy, nil},
+		{"below", Snapshot{CPU: 79.9, Memory: Usage{Percent: 84}, Disks: disks(89)}, Healthy, nil},
+		{"at warning", Snapshot{CPU: 80}, Warning, []string{"cpu at 80%"}},
+		{"warnings", Snapshot{Memory: Usage{Percent: 90}, Disks: disks(10, 91)}, Warning, []string{"memory at 90%", "disk /home at 91%"}},
+		{"at critical", Snapshot{Memory: Usage{Percent: 95}}, Critical, []string{"memory at 95%"}},
+		{"criticals first", Snapshot{CPU: 85, Disks: disks(99)}, Critical, []string{"disk / at 99%", "cpu at 85%"}},
+		{"full", Snapshot{CPU: 100, Memory: Usage{Percent: 100}, Disks: disks(100, 100)}, Critical,
+			[]string{"cpu at 100%", "memory at 100%", "disk / at 100%", "disk /home at 100%"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			health, reasons := c.evaluate(tt.snap)
+			if health != tt.health || !slices.Equal(reasons, tt.reasons) {
+				t.Errorf("evaluate = %s %q, want %s %q", health, reasons, tt.health, tt.reasons)
+			}
+		})
+	}
+
+	// Thresholds left at 0 are off
+	off := NewCollector(Config{Warning: Thresholds{CPU: 50}})
+	if health, reasons := off.evaluate(Snapshot{CPU: 100, Memory: Usage{Percent: 100}}); health != Warning || len(reasons) != 1 {
+		t.Errorf("only a cpu warning: evaluate = %s %q", health, reasons)
+	}
+}
+
+func TestPercentSince(t *testing.T) {
+	tests := []struct {
+		name      string
+		prev, now cpuTimes
+		want      float64
+	}{
+		{"since boot", cpuTimes{}, cpuTimes{idle: 750, total: 1000}, 25},
+		{"busy", cpuTimes{idle: 100, total: 200}, cpuTimes{idle: 100, total: 300}, 100},
+		{"idle", cpuTimes{idle: 100, total: 200}, cpuTimes{idle: 200, total: 300}, 0},
+		{"no time passed", cpuTimes{idle: 100, total: 200}, cpuTimes{idle: 100, total: 200}, 0},
+		{"counters reset", cpuTimes{idle: 100, total: 200}, cpuTimes{idle: 10, total: 20}, 0},
+		{"iowait went back", cpuTimes{idle: 100, total: 200}, cpuTimes{idle: 90, total: 300}, 100},
+		{"idle past total", cpuTimes{idle: 100, total: 200}, cpuTimes{idle: 500, total: 300}, 0},
+	}
+	for _, tt := range tests {
+		if got := tt.now.percentSince(tt.prev); got != tt.want {
+			t.Errorf("%s: percentSince = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
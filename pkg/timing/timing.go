@@ -0,0 +1,133 @@
+package timing
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+ * Package for the Server-Timing header, showing where the time of a request
+ * went in the network panel of the browser
+ *
+ * The server puts Timings in the context of every request. Whatever the
+ * request does with that context records how long it took:
+ *
+ *   defer timing.Start(ctx, "render", "Render")()
+ *
+ * Metrics recorded more than once under the same name, like store queries,
+ * are added up. Without Timings in the context nothing is recorded.
+ */
+
+// Timings are the metrics of one request. It's safe for concurrent use.
+type Timings struct {
+	mu      sync.Mutex
+	metrics []metric
+	sealed  bool // The header was sent, later metrics are dropped
+}
+
+type metric struct {
+	name, desc string
+	dur        time.Duration
+	count      int
+}
+
+type contextKey struct{}
+
+// NewContext returns ctx carrying t
+func NewContext(ctx context.Context, t *Timings) context.Context {
+	return context.WithValue(ctx, contextKey{}, t)
+}
+
+// FromContext returns the Timings of ctx, or nil
+func FromContext(ctx context.Context) *Timings {
+	t, _ := ctx.Value(contextKey{}).(*Timings)
+	return t
+}
+
+// Start starts timing name in the Timings of ctx, and returns the function
+// stopping it
+func Start(ctx context.Context, name, desc string) func() {
+	t := FromContext(ctx)
+	if t == nil {
+		return func() {}
+	}
+	start := time.Now()
+	return func() { t.Add(name, desc, time.Since(start)) }
+}
+
+// Add records that name took d, adding it up with earlier metrics of the
+// same name. It does nothing on nil Timings.
+func (t *Timings) Add(name, desc string, d time.Duration) {
+	if t == nil {
+		return
+	}
+	name = token(name)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.sealed {
+		return
+	}
+	for i := range t.metrics {
+		if t.metrics[i].name == name {
+			t.metrics[i].dur += d
+			t.metrics[i].count++
+			return
+		}
+	}
+	t.metrics = append(t.metrics, metric{name: name, desc: desc, dur: d, count: 1})
+}
+
+// Header seals t and formats its metrics for Server-Timing, followed by
+// total, in milliseconds
+func (t *Timings) Header(total time.Duration) string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.sealed = true
+
+	var b strings.Builder
+	for _, m := range t.metrics {
+		desc := m.desc
+		if m.count > 1 {
+			desc = fmt.Sprintf("%s (%d)", desc, m.count)
+		}
+		writeMetric(&b, m.name, desc, m.dur)
+		b.WriteString(", ")
+	}
+	writeMetric(&b, "total", "", total)
+	return b.String()
+}
+
+// Total formats only total for Server-Timing, for responses that shouldn't
+// tell where the time went
+func Total(total time.Duration) string {
+	var b strings.Builder
+	writeMetric(&b, "total", "", total)
+	return b.String()
+}
+
+func writeMetric(b *strings.Builder, name, desc string, d time.Duration) {
+	b.WriteString(name)
+	if desc != "" {
+		b.WriteString(`;desc="`)
+		b.WriteString(strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(desc))
+		b.WriteByte('"')
+	}
+	fmt.Fprintf(b, ";dur=%.1f", float64(d.Microseconds())/1000)
+}
+
+// token replaces the characters not allowed in a metric name with "-"
+func token(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		case strings.ContainsRune("!#$%&'*+-.^_`|~", r):
+			return r
+		}
+		return '-'
+	}, name)
+}
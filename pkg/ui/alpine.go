@@ -0,0 +1,27 @@
+package ui
+
+import "sync/atomic"
+
+// The Alpine builds under static/js. The CSP build evaluates no expressions
+// with eval, so markup may only name the data and methods of the components
+// in static/js/components.js. Fetch it with make alpine.
+const (
+	AlpineCSP   = "js/alpine-csp@3.14.9.js"
+	AlpineStock = "js/alpine@3.14.9.js"
+)
+
+var alpine atomic.Value
+
+// SetAlpine makes name, AlpineCSP or AlpineStock, the build Head loads
+func SetAlpine(name string) {
+	alpine.Store(name)
+}
+
+// alpineScript is the build Head loads, AlpineCSP unless SetAlpine said
+// otherwise
+func alpineScript() string {
+	if name, ok := alpine.Load().(string); ok {
+		return name
+	}
+	return AlpineCSP
+}
@@ -0,0 +1,203 @@
+package pages
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/a-h/templ"
+	"golang.org/x/net/html"
+
+	"github.com/pynezz/wasmdash/pkg/assets"
+	"github.com/pynezz/wasmdash/pkg/auth"
+	"github.com/pynezz/wasmdash/pkg/ui"
+	"github.com/pynezz/wasmdash/pkg/ui/widgets"
+	_ "github.com/pynezz/wasmdash/pkg/ui/widgets/stat"
+	_ "github.com/pynezz/wasmdash/pkg/ui/widgets/text"
+)
+
+// The pages render nothing the policy of csp.Default blocks, or that
+// Alpine's CSP build can't evaluate:
+//
+//   - inline event handlers (onclick=...) and javascript: URLs
+//   - style attributes, use classes or a <style> with the nonce, see
+//     WidgetStyles
+//   - inline scripts and style elements without the nonce
+//   - Alpine expressions that aren't the name of data or a method
+//   - static scripts and stylesheets without their integrity
+
+const nonce = "csptest"
+
+// staticDir is the static directory of the repository, for the digests
+const staticDir = "../../../static"
+
+// page is a page to render, at the path it's served from
+type page struct {
+	path      string
+	component templ.Component
+}
+
+// alpineDirectives are the Alpine attributes holding an expression
+var alpineDirectives = []string{"x-data", "x-init", "x-text", "x-html", "x-show", "x-if", "x-model", "x-effect", "x-modelable"}
+
+// alpineName is all the CSP build evaluates: a property, or a method to call
+var alpineName = regexp.MustCompile(`^[A-Za-z_$][\w$]*(\.[A-Za-z_$][\w$]*)*$`)
+
+func TestPagesCSP(t *testing.T) {
+	static := os.DirFS(staticDir)
+	if _, err := fs.Stat(static, ui.AlpineCSP); err != nil {
+		t.Fatalf("Alpine's CSP build, run make alpine: %v", err)
+	}
+	assets.SetDefault(assets.Live(static))
+	defer assets.SetDefault(nil)
+	ui.SetAlpine(ui.AlpineCSP)
+
+	for _, p := range allPages(t) {
+		t.Run(p.path, func(t *testing.T) {
+			var buf bytes.Buffer
+			ctx := templ.WithNonce(context.Background(), nonce)
+			if err := ui.Layout(p.component, p.path).Render(ctx, &buf); err != nil {
+				t.Fatal(err)
+			}
+			for _, problem := range audit(buf.Bytes()) {
+				t.Error(problem)
+			}
+		})
+	}
+}
+
+// allPages returns the pages the server renders, with data showing as much
+// of their markup as possible
+func allPages(t *testing.T) []page {
+	dashboard := NewDashboardData("default", widgetViews(t), SystemStatus{
+		Uptime:       "1h 2m",
+		MemoryUsage:  "42%",
+		MemoryWidth:  usageWidth(42),
+		CPUUsage:     "7%",
+		CPUWidth:     usageWidth(7),
+		Disks:        []DiskStatus{{Mount: "/", Usage: "63%", Width: usageWidth(63)}},
+		HealthStatus: "healthy",
+	})
+	dashboard.Username, dashboard.SignedIn = "admin", true
+	now := time.Now()
+	token := auth.Token{ID: "1", Name: "backup", Account: "admin", Scopes: []string{"read"}, IssuedAt: now, ExpiresAt: now.Add(time.Hour)}
+
+	return []page{
+		{"/", Home()},
+		{"/about", About("/about")},
+		{"/dashboard", Dashboard(dashboard)},
+		{"/login", Login(LoginData{Next: "/dashboard", Error: "Wrong username or password"})},
+		{"/tokens", Tokens(TokensData{
+			Tokens:   []auth.Token{token},
+			Accounts: []string{"admin"},
+			TTLs:     []TokenTTL{{Label: "1 day", Value: "24h0m0s"}},
+			Now:      now,
+			CanIssue: true,
+			Issued:   "token",
+			Error:    "Name is required",
+		})},
+		{"/missing", NotFound()},
+		{"/error", ServerError()},
+		{"/error/401", Error(401, "sign in required")},
+		{"/error/403", Error(403, "your account's role doesn't allow this")},
+		{"/error/429", Error(429, "")},
+	}
+}
+
+// widgetViews returns a view of each widget type
+func widgetViews(t *testing.T) []widgets.View {
+	settings := map[string]string{
+		"clock": `{"format": "12h"}`,
+		"text":  `{"body": "Text"}`,
+		"stat":  `{"value": "42", "change": 1.5, "icon": "users"}`,
+	}
+	var views []widgets.View
+	for typ, s := range settings {
+		base := widgets.Widget{ID: typ, Title: typ, Style: "color: red"}
+		kind, err := widgets.New(typ, base, widgets.JSONSettings([]byte(s)))
+		if err != nil {
+			t.Fatalf("widget %s: %v", typ, err)
+		}
+		data, err := kind.Fetch(context.Background())
+		views = append(views, widgets.View{
+			Definition: widgets.Definition{Type: typ, Widget: base, Kind: kind},
+			Data:       data,
+			Err:        err,
+		})
+	}
+	return views
+}
+
+// audit returns what the policy would block in page
+func audit(page []byte) []string {
+	var problems []string
+	z := html.NewTokenizer(bytes.NewReader(page))
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			return problems
+		case html.StartTagToken, html.SelfClosingTagToken:
+			token := z.Token()
+			for _, problem := range auditTag(token) {
+				problems = append(problems, fmt.Sprintf("<%s>: %s", token.Data, problem))
+			}
+		}
+	}
+}
+
+// auditTag returns what the policy would block in the attributes of token
+func auditTag(token html.Token) []string {
+	var problems []string
+	attrs := make(map[string]string, len(token.Attr))
+	for _, a := range token.Attr {
+		attrs[a.Key] = a.Val
+		switch {
+		case strings.HasPrefix(a.Key, "on"):
+			problems = append(problems, fmt.Sprintf("inline event handler %s=%q", a.Key, a.Val))
+		case a.Key == "style":
+			problems = append(problems, fmt.Sprintf("style attribute %q, use classes or a <style> with the nonce", a.Val))
+		case a.Key == "href" || a.Key == "src" || a.Key == "action" || a.Key == "formaction":
+			if strings.HasPrefix(strings.ToLower(strings.TrimSpace(a.Val)), "javascript:") {
+				problems = append(problems, fmt.Sprintf("javascript: URL in %s", a.Key))
+			}
+		case isAlpine(a.Key):
+			if !alpineName.MatchString(strings.TrimSpace(a.Val)) {
+				problems = append(problems, fmt.Sprintf("Alpine expression %s=%q needs eval, name a component's data or method", a.Key, a.Val))
+			}
+		}
+	}
+
+	src, hasSrc := attrs["src"]
+	switch {
+	case token.Data == "script" && !hasSrc && attrs["nonce"] != nonce:
+		problems = append(problems, "inline script without the nonce")
+	case token.Data == "style" && attrs["nonce"] != nonce:
+		problems = append(problems, "style element without the nonce")
+	case token.Data == "script" && strings.HasPrefix(src, assets.Prefix) && attrs["integrity"] == "":
+		problems = append(problems, fmt.Sprintf("script %s without integrity, use ui.Script", src))
+	case token.Data == "link" && (attrs["rel"] == "stylesheet" || attrs["as"] == "style") &&
+		strings.HasPrefix(attrs["href"], assets.Prefix) && attrs["integrity"] == "":
+		problems = append(problems, fmt.Sprintf("stylesheet %s without integrity, use ui.Stylesheet", attrs["href"]))
+	}
+	return problems
+}
+
+// isAlpine reports whether the attribute key holds an Alpine expression
+func isAlpine(key string) bool {
+	if strings.HasPrefix(key, "@") || strings.HasPrefix(key, ":") ||
+		strings.HasPrefix(key, "x-on:") || strings.HasPrefix(key, "x-bind:") {
+		return true
+	}
+	for _, directive := range alpineDirectives {
+		if key == directive {
+			return true
+		}
+	}
+	return false
+}
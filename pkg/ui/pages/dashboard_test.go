@@ -0,0 +1,91 @@
+package pages
+
+import (
+	"bytes"
+	"context"
+	"math"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/a-h/templ"
+	"github.com/pynezz/wasmdash/pkg/system"
+	"github.com/pynezz/wasmdash/pkg/ui/widgets"
+)
+
+func TestUsageWidth(t *testing.T) {
+	tests := []struct {
+		percent float64
+		want    string
+	}{
+		{0, "w-0"},
+		{2.4, "w-0"},
+		{2.5, "w-1/20"},
+		{42, "w-8/20"},
+		{43, "w-9/20"},
+		{97.4, "w-19/20"},
+		{97.5, "w-full"},
+		{100, "w-full"},
+		{250, "w-full"},
+		{-3, "w-0"},
+		{math.NaN(), "w-0"},
+	}
+	for _, tt := range tests {
+		if got := usageWidth(tt.percent); got != tt.want {
+			t.Errorf("usageWidth(%v) = %s, want %s", tt.percent, got, tt.want)
+		}
+	}
+
+	status := NewSystemStatus(system.Snapshot{CPU: 50, Memory: system.Usage{Percent: 100}, Disks: []system.Disk{{Mount: "/", Usage: system.Usage{Percent: 5}}}})
+	var buf bytes.Buffer
+	if err := SystemStatusCard(status).Render(context.Background(), &buf); err != nil {
+		t.Fatal(err)
+	}
+	for _, class := range []string{"w-10/20", "w-full", "w-1/20"} {
+		if !strings.Contains(buf.String(), " "+class+`"`) {
+			t.Errorf("no usage bar with %s in\n%s", class, buf.String())
+		}
+	}
+}
+
+func TestWidgetStyles(t *testing.T) {
+	def := func(id, style string, hidden bool) widgets.Definition {
+		return widgets.Definition{Type: "clock", Widget: widgets.Widget{ID: id, Style: style, Hidden: hidden}}
+	}
+	defs := []widgets.Definition{
+		def("clock", " color: red; padding: 0 ", false),
+		def("plain", "", false),
+		def("hidden", "color: blue", true),
+		def("escape", "color: red } body { display: none", false),
+		def("close", "color: red</style><script>", false),
+		def("9 lives", "font-family: 'Inter'", false),
+	}
+	want := []string{
+		"#widget-clock { color: red; padding: 0 }",
+		`#widget-9\20 lives { font-family: 'Inter' }`,
+	}
+	if got := WidgetStyles(defs); !slices.Equal(got, want) {
+		t.Errorf("WidgetStyles = %q, want %q", got, want)
+	}
+
+	version := StylesVersion(defs)
+	if version == "" || StylesVersion(defs[:2]) == version || StylesVersion(defs[1:5]) != "" {
+		t.Errorf("StylesVersion doesn't follow the styles: %q", version)
+	}
+
+	// Pages get them with their nonce, never without one
+	views := []widgets.View{{Definition: defs[0]}, {Definition: defs[1]}}
+	render := func(ctx context.Context) string {
+		var buf bytes.Buffer
+		if err := widgetStyles(views).Render(ctx, &buf); err != nil {
+			t.Fatal(err)
+		}
+		return buf.String()
+	}
+	if got, want := render(templ.WithNonce(context.Background(), "n0nce")), `<style nonce="n0nce">#widget-clock { color: red; padding: 0 }</style>`; got != want {
+		t.Errorf("widgetStyles = %s, want %s", got, want)
+	}
+	if got := render(context.Background()); got != "" {
+		t.Errorf("widgetStyles without a nonce = %s", got)
+	}
+}
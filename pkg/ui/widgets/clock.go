@@ -0,0 +1,41 @@
+package widgets
+
+import (
+	"context"
+	"time"
+
+	"github.com/a-h/templ"
+)
+
+func init() {
+	Register("clock", newClock)
+}
+
+// clockKind ticks in the browser, Fetch only provides the initial server time
+type clockKind struct {
+	clock Clock
+}
+
+func newClock(base Widget, settings Decoder) (Kind, error) {
+	clock := Clock{WClock: base, Format: "24h"}
+	if err := settings(&clock); err != nil {
+		return nil, err
+	}
+	if clock.Format != "12h" && clock.Format != "24h" {
+		return nil, Invalid("clock.format", "%q must be \"12h\" or \"24h\"", clock.Format)
+	}
+	return &clockKind{clock: clock}, nil
+}
+
+func (k *clockKind) Fetch(context.Context) (any, error) {
+	now := time.Now()
+	return Time{Hour: now.Hour(), Minute: now.Minute(), Second: now.Second()}, nil
+}
+
+func (k *clockKind) Render(data any) templ.Component {
+	clock := k.clock
+	if t, ok := data.(Time); ok {
+		clock.Time = t
+	}
+	return DisplayClock(clock)
+}
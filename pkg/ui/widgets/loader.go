@@ -0,0 +1,273 @@
+package widgets
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/pynezz/wasmdash/pkg/auth"
+)
+
+/*
+ * Declarative widget definitions
+ *
+ * Every widget lives in its own directory with a widget.toml:
+ *
+ *   widgets/
+ *   └── clock/
+ *       └── widget.toml
+ *
+ * The file holds the base Widget fields at the top level, and a section
+ * named after the widget type with its type-specific settings:
+ *
+ *   type  = "clock"
+ *   id    = "main-clock"
+ *   title = "Current Time"
+ *
+ *   [clock]
+ *   format = "24h"
+ */
+
+// DefinitionFile is the name of the file describing a widget
+const DefinitionFile = "widget.toml"
+
+// Definition is a configured widget instance
+type Definition struct {
+	Name   string // Name of the directory the widget was loaded from
+	Path   string // Path to the widget.toml file
+	Type   string
+	Widget Widget
+	Kind   Kind // Created by the Factory registered for Type
+
+	// Settings is the type-specific section as decoded from TOML, kept so
+	// the definition can be persisted and recreated with JSONSettings
+	Settings map[string]any
+
+	// Position on the dashboard grid, zero for definitions loaded from files
+	Position Position
+
+	// Dashboard is the ID of the dashboard the widget is on, empty for
+	// definitions loaded from files
+	Dashboard string
+}
+
+const (
+	// GridColumns is the number of columns of the dashboard grid on wide screens
+	GridColumns = 4
+
+	// MaxRowSpan is the number of rows a single widget may span
+	MaxRowSpan = 3
+)
+
+// Position places a widget on the dashboard grid. X and Y are the zero-based
+// column and row, W and H the number of columns and rows it spans.
+type Position struct {
+	X int `json:"x"`
+	Y int `json:"y"`
+	W int `json:"w"`
+	H int `json:"h"`
+}
+
+// Validate reports the first field that doesn't fit on the grid
+func (p Position) Validate() *FieldError {
+	switch {
+	case p.X < 0 || p.X >= GridColumns:
+		return &FieldError{Field: "x", Msg: fmt.Sprintf("must be between 0 and %d", GridColumns-1)}
+	case p.Y < 0:
+		return &FieldError{Field: "y", Msg: "must not be negative"}
+	case p.W < 1 || p.X+p.W > GridColumns:
+		return &FieldError{Field: "w", Msg: fmt.Sprintf("must be at least 1 and fit within %d columns", GridColumns)}
+	case p.H < 1 || p.H > MaxRowSpan:
+		return &FieldError{Field: "h", Msg: fmt.Sprintf("must be between 1 and %d", MaxRowSpan)}
+	}
+	return nil
+}
+
+// styleForbidden are the characters that could end the rule a widget's
+// Style is scoped to, or its <style> element, see pages.WidgetStyles
+const styleForbidden = "{}<>\\"
+
+// CheckStyle checks the Style of a widget only holds CSS declarations, like
+// "color: red; padding: 0"
+func CheckStyle(style string) *FieldError {
+	if i := strings.IndexAny(style, styleForbidden); i >= 0 {
+		return &FieldError{Field: "style", Msg: fmt.Sprintf("must only hold CSS declarations, found %q", style[i])}
+	}
+	return nil
+}
+
+// FieldError reports an invalid field in a widget definition
+type FieldError struct {
+	File  string
+	Line  int
+	Field string
+	Msg   string
+}
+
+func (e *FieldError) Error() string {
+	var location string
+	if e.File != "" {
+		location = e.File
+		if e.Line > 0 {
+			location += ":" + strconv.Itoa(e.Line)
+		}
+		location += ": "
+	}
+	if e.Field == "" {
+		return location + e.Msg
+	}
+	return location + e.Field + ": " + e.Msg
+}
+
+// LoadDir parses every <dir>/*/widget.toml, sorted by directory name.
+// A missing directory is not an error and yields no definitions.
+// All invalid definitions are reported together, joined with errors.Join.
+func LoadDir(dir string) ([]Definition, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		defs []Definition
+		errs []error
+		ids  = make(map[string]string)
+	)
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+
+		path := filepath.Join(dir, entry.Name(), DefinitionFile)
+		if _, err := os.Stat(path); errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+
+		def, err := LoadFile(path)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		if other, ok := ids[def.Widget.ID]; ok {
+			errs = append(errs, &FieldError{File: path, Field: "id", Msg: fmt.Sprintf("%q is already used by %s", def.Widget.ID, other)})
+			continue
+		}
+		ids[def.Widget.ID] = path
+		defs = append(defs, def)
+	}
+
+	return defs, errors.Join(errs...)
+}
+
+// LoadFile parses and validates a single widget.toml
+func LoadFile(path string) (Definition, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Definition{}, err
+	}
+
+	def := Definition{
+		Name: filepath.Base(filepath.Dir(path)),
+		Path: path,
+	}
+
+	// Base fields live at the top level of the file
+	var base struct {
+		Type string `toml:"type"`
+		Widget
+	}
+	md, err := toml.Decode(string(data), &base)
+	if err != nil {
+		return def, decodeError(path, err)
+	}
+	def.Type, def.Widget = base.Type, base.Widget
+
+	if def.Type == "" {
+		return def, &FieldError{File: path, Field: "type", Msg: "must be set"}
+	}
+	if def.Widget.ID == "" {
+		def.Widget.ID = def.Name
+	}
+	if !auth.ValidRole(def.Widget.MinRole) {
+		return def, &FieldError{File: path, Field: "min_role",
+			Msg: fmt.Sprintf("unknown role %d, use %d (guest), %d (user) or %d (admin)", def.Widget.MinRole, auth.RoleGuest, auth.RoleUser, auth.RoleAdmin)}
+	}
+
+	if ferr := CheckStyle(def.Widget.Style); ferr != nil {
+		ferr.File = path
+		return def, ferr
+	}
+
+	// The section named after the type holds the type-specific settings
+	var sections map[string]toml.Primitive
+	smd, err := toml.Decode(string(data), &sections)
+	if err != nil {
+		return def, decodeError(path, err)
+	}
+	section, hasSection := sections[def.Type]
+	decodeSection := func(v any) error {
+		if !hasSection {
+			return nil
+		}
+		if err := smd.PrimitiveDecode(section, v); err != nil {
+			return decodeError(path, err)
+		}
+		return nil
+	}
+
+	// A third, generic pass keeps the raw settings. Decoding them from the
+	// primitive would mark every key as decoded and hide unknown fields.
+	var raw map[string]any
+	if _, err := toml.Decode(string(data), &raw); err != nil {
+		return def, decodeError(path, err)
+	}
+	def.Settings, _ = raw[def.Type].(map[string]any)
+
+	if def.Kind, err = New(def.Type, def.Widget, decodeSection); err != nil {
+		var ferr *FieldError
+		if errors.As(err, &ferr) && ferr.File == "" {
+			ferr.File = path
+		}
+		return def, err
+	}
+	// Anything left over in either pass is a typo or belongs to another type.
+	// The settings of unknown types are left alone, they're never decoded.
+	for _, key := range md.Undecoded() {
+		if key[0] != def.Type {
+			return def, &FieldError{File: path, Field: key.String(), Msg: "unknown field"}
+		}
+	}
+	for _, key := range smd.Undecoded() {
+		if key[0] == def.Type && len(key) > 1 && !IsUnknown(def.Kind) {
+			return def, &FieldError{File: path, Field: key.String(), Msg: "unknown field"}
+		}
+	}
+
+	return def, nil
+}
+
+// decodeErr matches the "toml: line N (last key "k"): msg" errors returned for type mismatches
+var decodeErr = regexp.MustCompile(`^toml: (?:line (\d+) )?(?:\(last key "([^"]*)"\): )?(.*)$`)
+
+// decodeError turns toml decoding errors into a FieldError carrying the line
+func decodeError(path string, err error) error {
+	var perr toml.ParseError
+	if errors.As(err, &perr) {
+		return &FieldError{File: path, Line: perr.Position.Line, Field: perr.LastKey, Msg: perr.Message}
+	}
+	if m := decodeErr.FindStringSubmatch(err.Error()); m != nil {
+		line, _ := strconv.Atoi(m[1])
+		return &FieldError{File: path, Line: line, Field: m[2], Msg: m[3]}
+	}
+	return &FieldError{File: path, Msg: err.Error()}
+}
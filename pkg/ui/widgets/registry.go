@@ -0,0 +1,305 @@
+package widgets
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/a-h/templ"
+	"github.com/pynezz/wasmdash/pkg/logging"
+	"github.com/pynezz/wasmdash/pkg/metrics"
+	"github.com/pynezz/wasmdash/pkg/timing"
+)
+
+/*
+ * Widget type registry
+ *
+ * A widget type registers a Factory under the name used by `type = "..."`
+ * in widget.toml, usually from an init function in its own package:
+ *
+ *   func init() {
+ *       widgets.Register("weather", New)
+ *   }
+ *
+ * The package then only has to be imported (for side effects) by main.
+ */
+
+// Kind is a configured widget. Fetching the data is separated from rendering
+// it, so slow data sources can be fetched concurrently before the page renders.
+type Kind interface {
+	// Fetch loads the data to display. It's called on every render, with
+	// the request ID in ctx to pass on to other services, see
+	// logging.RequestID.
+	Fetch(ctx context.Context) (any, error)
+
+	// Render renders the data returned by Fetch as the body of the widget card
+	Render(data any) templ.Component
+}
+
+// Refresher is implemented by widgets whose data changes on its own.
+// Open dashboards re-fetch and re-render them every RefreshInterval.
+type Refresher interface {
+	RefreshInterval() time.Duration
+}
+
+// Decoder decodes the type-specific settings section of a definition into v.
+// Fields of type secrets.Secret get the secrets they reference resolved.
+type Decoder func(v any) error
+
+// JSONSettings decodes settings stored as a JSON object, like the ones
+// persisted by pkg/storage. Unknown fields are rejected as in widget.toml.
+func JSONSettings(data []byte) Decoder {
+	return func(v any) error {
+		if len(data) == 0 {
+			return nil
+		}
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(v); err != nil {
+			return &FieldError{Field: "settings", Msg: err.Error()}
+		}
+		return nil
+	}
+}
+
+// Factory creates a Kind from the base widget fields and its settings.
+// Invalid settings should be reported with Invalid.
+type Factory func(base Widget, settings Decoder) (Kind, error)
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[string]Factory)
+)
+
+// Register makes a widget type available under name.
+// It panics if the name is already registered, like database/sql drivers.
+func Register(name string, factory Factory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if factory == nil {
+		panic("widgets: Register factory is nil for " + name)
+	}
+	if _, dup := registry[name]; dup {
+		panic("widgets: Register called twice for " + name)
+	}
+	registry[name] = factory
+}
+
+// Types returns the names of all registered widget types, sorted
+func Types() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// New creates a widget of the given type. Unknown types are not an error,
+// they yield a placeholder so a single stale widget can't break a dashboard.
+func New(typ string, base Widget, settings Decoder) (Kind, error) {
+	registryMu.RLock()
+	factory, ok := registry[typ]
+	registryMu.RUnlock()
+
+	if !ok {
+		return Unknown(typ), nil
+	}
+	return factory(base, settings)
+}
+
+// Invalid reports an invalid settings field from a Factory
+func Invalid(field, format string, args ...any) error {
+	return &FieldError{Field: field, Msg: fmt.Sprintf(format, args...)}
+}
+
+// unknown is the placeholder for widget types that aren't registered
+type unknown struct {
+	typ string
+}
+
+// Unknown returns a Kind rendering a placeholder for an unregistered type
+func Unknown(typ string) Kind {
+	return unknown{typ: typ}
+}
+
+func (u unknown) Fetch(context.Context) (any, error) { return nil, nil }
+
+func (u unknown) Render(any) templ.Component {
+	return Placeholder(fmt.Sprintf("Unknown widget type %q", u.typ),
+		"Is the package providing it imported? Known types: "+fmt.Sprint(Types()))
+}
+
+// IsUnknown reports whether k is a placeholder for an unregistered type
+func IsUnknown(k Kind) bool {
+	_, ok := k.(unknown)
+	return ok
+}
+
+// failedDetail is what failed widgets show, the error is only logged
+const failedDetail = "Its data couldn't be loaded, the server log has the details"
+
+// failed is the placeholder for widgets whose settings are invalid
+type failed struct {
+	err error
+}
+
+// Failed returns a Kind that reports err instead of rendering, for widgets
+// that could not be created from settings loaded at runtime
+func Failed(err error) Kind {
+	return failed{err: err}
+}
+
+func (f failed) Fetch(context.Context) (any, error) { return nil, f.err }
+
+func (f failed) Render(any) templ.Component {
+	return Placeholder("Failed to load widget", failedDetail)
+}
+
+// View is a widget together with its fetched data, ready to be rendered
+type View struct {
+	Definition
+	Data any
+	Err  error
+}
+
+// VisibleTo returns the definitions an account with role may see,
+// see pkg/auth for the roles
+func VisibleTo(defs []Definition, role int) []Definition {
+	visible := make([]Definition, 0, len(defs))
+	for _, def := range defs {
+		if def.Widget.MinRole <= role {
+			visible = append(visible, def)
+		}
+	}
+	return visible
+}
+
+var fetchDuration = metrics.NewHistogram("wasmdash_widget_fetch_duration_seconds",
+	"Time taken by widgets to fetch their data, by type and result.", metrics.DurationBuckets, "type", "result")
+
+// FetchTimeout bounds how long a single widget may take to fetch its data
+var FetchTimeout = 5 * time.Second
+
+// FetchAll fetches the data of all visible widgets concurrently, timing each
+// in the Server-Timing of the request ctx is for. Failures are logged and
+// kept on the View so the widget can render an error instead.
+func FetchAll(ctx context.Context, defs []Definition) []View {
+	views := make([]View, 0, len(defs))
+	for _, def := range defs {
+		if !def.Widget.Hidden {
+			views = append(views, View{Definition: def})
+		}
+	}
+
+	var wg sync.WaitGroup
+	for i := range views {
+		wg.Add(1)
+		go func(v *View) {
+			defer wg.Done()
+			start := time.Now()
+			defer func() {
+				elapsed := time.Since(start)
+				timing.FromContext(ctx).Add("widget."+v.Widget.ID, v.Type, elapsed)
+				result := "success"
+				if v.Err != nil {
+					result = "failure"
+				}
+				fetchDuration.Observe(elapsed.Seconds(), v.Type, result)
+				recordFetch(v.Definition, v.Err)
+			}()
+			defer func() {
+				if r := recover(); r != nil {
+					v.Err = fmt.Errorf("widget %s panicked: %v", v.Widget.ID, r)
+				}
+			}()
+
+			fctx, cancel := context.WithTimeout(ctx, FetchTimeout)
+			defer cancel()
+			v.Data, v.Err = v.Kind.Fetch(fctx)
+		}(&views[i])
+	}
+	wg.Wait()
+
+	for _, v := range views {
+		if v.Err != nil {
+			logging.FromContext(ctx).Warn("Fetching widget data", "dashboard", v.Dashboard, "widget", v.Widget.ID, "type", v.Type, "error", v.Err)
+		}
+	}
+
+	return views
+}
+
+// failure is a failed fetch, see FetchErrors
+type failure struct {
+	err error
+	at  time.Time
+}
+
+// failureKey identifies a widget across dashboards, the same ID may be used
+// on several
+type failureKey struct {
+	dashboard, widget string
+}
+
+var (
+	failuresMu sync.Mutex
+	failures   = make(map[failureKey]failure)
+)
+
+func recordFetch(def Definition, err error) {
+	failuresMu.Lock()
+	defer failuresMu.Unlock()
+	key := failureKey{dashboard: def.Dashboard, widget: def.Widget.ID}
+	if err == nil {
+		delete(failures, key)
+	} else {
+		failures[key] = failure{err: err, at: time.Now()}
+	}
+}
+
+// FetchErrors returns the widgets whose last fetch failed after since, by
+// dashboard and widget ID like ops/clock, or widget ID alone for
+// definitions that aren't on a dashboard
+func FetchErrors(since time.Time) map[string]error {
+	failuresMu.Lock()
+	defer failuresMu.Unlock()
+
+	errs := make(map[string]error)
+	for key, f := range failures {
+		if !f.at.After(since) {
+			continue
+		}
+		id := key.widget
+		if key.dashboard != "" {
+			id = key.dashboard + "/" + key.widget
+		}
+		errs[id] = f.err
+	}
+	return errs
+}
+
+// Component renders the widget body, a placeholder if fetching failed. The
+// error goes to the log of the request, it may tell more than visitors
+// should see.
+func (v View) Component() templ.Component {
+	if v.Kind == nil {
+		return Unknown(v.Type).Render(nil)
+	}
+	if v.Err != nil {
+		return templ.ComponentFunc(func(ctx context.Context, w io.Writer) error {
+			logging.FromContext(ctx).Warn("Rendering failed widget", "widget", v.Widget.ID, "type", v.Type, "error", v.Err)
+			return Placeholder("Failed to load widget", failedDetail).Render(ctx, w)
+		})
+	}
+	return v.Kind.Render(v.Data)
+}
@@ -0,0 +1,65 @@
+package stat
+
+import (
+	"context"
+	"slices"
+	"strings"
+
+	"github.com/a-h/templ"
+	"github.com/pynezz/wasmdash/pkg/ui/components/icon"
+	"github.com/pynezz/wasmdash/pkg/ui/widgets"
+)
+
+func init() {
+	widgets.Register("stat", New)
+}
+
+// Stat is a single figure with an optional trend
+type Stat struct {
+	Value       string  `toml:"value" json:"value"`
+	Change      float64 `toml:"change" json:"change"` // positive is good, negative is bad
+	Description string  `toml:"description" json:"description"`
+	Icon        string  `toml:"icon" json:"icon"`
+}
+
+// icons maps the names usable in `icon = "..."` to an icon and its color
+var icons = map[string]struct {
+	icon  func(...icon.Props) templ.Component
+	class string
+}{
+	"users":    {icon.Users, "text-primary"},
+	"activity": {icon.Activity, "text-accent"},
+	"cpu":      {icon.Cpu, "text-warning"},
+	"database": {icon.Database, "text-success"},
+}
+
+// New creates a stat widget from its [stat] section
+func New(base widgets.Widget, settings widgets.Decoder) (widgets.Kind, error) {
+	var s Stat
+	if err := settings(&s); err != nil {
+		return nil, err
+	}
+	if s.Value == "" {
+		return nil, widgets.Invalid("stat.value", "must be set")
+	}
+	if _, ok := icons[s.Icon]; s.Icon != "" && !ok {
+		names := make([]string, 0, len(icons))
+		for name := range icons {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+		return nil, widgets.Invalid("stat.icon", "%q must be one of %s", s.Icon, strings.Join(names, ", "))
+	}
+	return s, nil
+}
+
+func (s Stat) Fetch(context.Context) (any, error) {
+	return s, nil
+}
+
+func (s Stat) Render(data any) templ.Component {
+	if stat, ok := data.(Stat); ok {
+		s = stat
+	}
+	return Card(s)
+}
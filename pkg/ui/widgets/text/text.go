@@ -0,0 +1,39 @@
+package text
+
+import (
+	"context"
+
+	"github.com/a-h/templ"
+	"github.com/pynezz/wasmdash/pkg/ui/widgets"
+)
+
+func init() {
+	widgets.Register("text", New)
+}
+
+// Text is a free-form block of text
+type Text struct {
+	Body  string `toml:"body" json:"body"`
+	class string
+}
+
+// New creates a text widget from its [text] section
+func New(base widgets.Widget, settings widgets.Decoder) (widgets.Kind, error) {
+	t := Text{class: base.Class}
+	if err := settings(&t); err != nil {
+		return nil, err
+	}
+	if t.Body == "" {
+		return nil, widgets.Invalid("text.body", "must be set")
+	}
+	return t, nil
+}
+
+func (t Text) Fetch(context.Context) (any, error) {
+	return t.Body, nil
+}
+
+func (t Text) Render(data any) templ.Component {
+	body, _ := data.(string)
+	return Block(body, t.class)
+}
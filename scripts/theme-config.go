@@ -3,9 +3,12 @@ package main
 // Dashboard theme config
 
 import (
+	"flag"
 	"fmt"
 	"log"
 	"os"
+
+	wconfig "github.com/pynezz/wasmdash/pkg/config"
 )
 
 type ThemeConfig struct {
@@ -17,12 +20,21 @@ type ThemeConfig struct {
 }
 
 func main() {
+	configPath := flag.String("config", os.Getenv("WASMDASH_CONFIG"), "Path to wasmdash.toml")
+	flag.Parse()
+
+	// The [theme] section of wasmdash.toml, or the defaults if no file is given
+	settings, err := wconfig.Load(*configPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	config := ThemeConfig{
-		Primary: "262 83% 58%", // Purple
-		Accent:  "178 60% 48%", // Teal
-		Success: "142 76% 36%", // Green
-		Warning: "43 96% 56%",  // Golden
-		Dark:    true,
+		Primary: settings.Theme.Primary,
+		Accent:  settings.Theme.Accent,
+		Success: settings.Theme.Success,
+		Warning: settings.Theme.Warning,
+		Dark:    settings.Theme.Dark,
 	}
 
 	generateThemeCSS(config)
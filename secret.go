@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/pynezz/wasmdash/pkg/config"
+	"github.com/pynezz/wasmdash/pkg/health"
+	"github.com/pynezz/wasmdash/pkg/secrets"
+)
+
+const secretHelp = `Usage:
+    wasmdash secret keygen
+    wasmdash [--config FILE] secret set NAME     Reads the value from stdin
+    wasmdash [--config FILE] secret list
+    wasmdash [--config FILE] secret delete NAME
+
+keygen prints a new identity for [secrets] identity. The secrets file at
+[secrets] path is created on first use, encrypted with that identity or with
+[secrets] passphrase. Widget settings reference secrets as ${secret:NAME};
+values are never printed, list only shows the names.`
+
+// secretCommand implements `wasmdash secret` and returns the exit code
+func secretCommand(configPath string, args []string) int {
+	if len(args) == 0 || args[0] == "help" || args[0] == "--help" || args[0] == "-h" {
+		fmt.Println(secretHelp)
+		return 0
+	}
+
+	var err error
+	switch args[0] {
+	case "keygen":
+		err = secretKeygen()
+	case "set", "list", "delete":
+		err = withVault(configPath, args[0], args[1:])
+	default:
+		fmt.Fprintf(os.Stderr, "secret: unknown command %q\n\n%s\n", args[0], secretHelp)
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "secret %s: %v\n", args[0], err)
+		return 1
+	}
+	return 0
+}
+
+func secretKeygen() error {
+	id, recipient, err := secrets.GenerateIdentity()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Public key: %s\n", recipient)
+	fmt.Println(id)
+	return nil
+}
+
+// withVault runs a secret command against the configured secrets file
+func withVault(configPath, command string, args []string) error {
+	settings, err := config.Load(configPath)
+	if err != nil {
+		return err
+	}
+	vault, err := openVault(settings.Secrets)
+	if err != nil {
+		return err
+	}
+	if vault == nil {
+		return errors.New("set [secrets] path and an identity or passphrase first")
+	}
+
+	switch command {
+	case "set":
+		if len(args) != 1 {
+			return errors.New("expected the name of the secret")
+		}
+		value, err := readLine("Value (echoed): ")
+		if err != nil {
+			return err
+		}
+		if err := vault.Set(args[0], value); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "Secret %q saved, reference it as ${secret:%s}\n", args[0], args[0])
+	case "list":
+		names, err := vault.Names()
+		if err != nil {
+			return err
+		}
+		for _, name := range names {
+			fmt.Println(name)
+		}
+	default:
+		if len(args) != 1 {
+			return errors.New("expected the name of the secret")
+		}
+		if err := vault.Delete(args[0]); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "Secret %q deleted\n", args[0])
+	}
+	return nil
+}
+
+// openVault opens the secrets file of [secrets], nil if none is configured
+func openVault(cfg config.Secrets) (*secrets.Vault, error) {
+	if cfg.Path == "" {
+		return nil, nil
+	}
+	key := secrets.Passphrase(cfg.Passphrase)
+	if cfg.Identity != "" {
+		var err error
+		if key, err = secrets.ParseIdentity(cfg.Identity); err != nil {
+			return nil, fmt.Errorf("secrets.identity: %w", err)
+		}
+	}
+	return secrets.Open(cfg.Path, key)
+}
+
+// openSecrets makes the secrets file available to widgets, before they're
+// loaded: their settings resolve the secrets they reference when decoded
+func openSecrets(cfg config.Secrets, checks *health.Registry) error {
+	vault, err := openVault(cfg)
+	if err != nil {
+		return err
+	}
+	secrets.SetDefault(vault)
+	if vault == nil {
+		return nil
+	}
+
+	// Widgets without secrets keep working if the file goes missing
+	checks.RegisterOptional("secrets", time.Second, func(context.Context) error {
+		_, err := vault.Names()
+		return err
+	})
+	names, err := vault.Names()
+	if err != nil {
+		return err
+	}
+	log.Printf("Secrets: %d in %s", len(names), vault.Path())
+	return nil
+}
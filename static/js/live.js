@@ -0,0 +1,63 @@
+// live.js
+// Applies the live updates streamed from /events to the dashboard,
+// see pkg/server/live.go for the events
+
+(function () {
+    const root = document.querySelector("[data-live]");
+    if (!root || !window.EventSource) {
+        return;
+    }
+    const dashboard = root.dataset.dashboard || "";
+
+    function data(event) {
+        try {
+            return JSON.parse(event.data);
+        } catch (err) {
+            console.warn("live: invalid event", event.type, err);
+            return null;
+        }
+    }
+
+    function forThisPage(update) {
+        return update && (!update.dashboard || update.dashboard === dashboard);
+    }
+
+    // EventSource reconnects on its own, resuming from the last event ID
+    const source = new EventSource(root.dataset.live);
+
+    source.addEventListener("swap", function (event) {
+        const update = data(event);
+        if (!forThisPage(update)) {
+            return;
+        }
+        const target = document.getElementById(update.target);
+        if (target) {
+            target.outerHTML = update.html;
+        }
+    });
+
+    // Widgets were added, removed, moved or restyled, which a swap can't
+    // express
+    source.addEventListener("layout", function (event) {
+        const update = data(event);
+        if (!forThisPage(update)) {
+            return;
+        }
+        const current = Array.from(root.querySelectorAll("[data-widget-id]"), function (el) {
+            return el.dataset.widgetId;
+        });
+        // The server only sends the widgets this page's role may see
+        if (current.join("\n") !== update.widgets.join("\n") || (root.dataset.styles || "") !== (update.styles || "")) {
+            window.location.reload();
+        }
+    });
+
+    // Updates were lost while disconnected
+    source.addEventListener("resync", function () {
+        window.location.reload();
+    });
+
+    window.addEventListener("pagehide", function () {
+        source.close();
+    });
+})();
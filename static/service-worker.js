@@ -1,28 +1,68 @@
 // Go WASM Service Worker
 //
+// The server prepends PRECACHE, the hashed scripts and stylesheets under
+// /static with their Subresource Integrity: [{ url, integrity }, ...].
+// They're only cached when they match it, and dropped from the cache once
+// they don't. Pages and everything else always come from the network, a
+// cached page would be stale and could be another account's.
 
-// Initialize the service worker
+// Bumped to drop the caches of earlier workers, which held pages
+const CACHE = "static-v3";
+
+// The URLs served from the cache
+const CACHED = new Set(PRECACHE.map(({ url }) => url));
+
+// verify reports whether response has the SHA-384 digest of integrity
+async function verify(response, integrity) {
+  const digest = await crypto.subtle.digest("SHA-384", await response.clone().arrayBuffer());
+  const base64 = btoa(String.fromCharCode(...new Uint8Array(digest)));
+  return integrity === "sha384-" + base64;
+}
+
+// Initialize the service worker. Fetching with integrity fails on a
+// mismatch, and with it the install.
 self.addEventListener("install", (event) => {
   event.waitUntil(
-    caches.open("static-v1").then((cache) => {
-      return cache.addAll([
-        "/",
-        "/about",
-        "/dashboard",
-        "/index.html",
-        "/favicon.ico",
-        "/manifest.json",
-        "/service-worker.js",
-        "/static/js/app.js",
-        "/static/css/tailwind.css",
-        "/static/icons/icon-192-fs8.png",
-      ]);
+    caches.open(CACHE).then((cache) => {
+      return Promise.all(
+        PRECACHE.map(({ url, integrity }) =>
+          fetch(new Request(url, { integrity })).then((response) => {
+            if (!response.ok) {
+              throw new Error(`precaching ${url}: ${response.status}`);
+            }
+            return cache.put(url, response);
+          }),
+        ),
+      );
+    }),
+  );
+});
+
+// Drop old caches, and cached scripts and stylesheets that no longer match
+self.addEventListener("activate", (event) => {
+  event.waitUntil(
+    caches.keys().then(async (names) => {
+      await Promise.all(names.filter((name) => name !== CACHE).map((name) => caches.delete(name)));
+      const cache = await caches.open(CACHE);
+      await Promise.all(
+        PRECACHE.map(async ({ url, integrity }) => {
+          const response = await cache.match(url);
+          if (response && !(await verify(response, integrity))) {
+            await cache.delete(url);
+          }
+        }),
+      );
     }),
   );
 });
 
-// Fetch resources from the cache or network
+// Serve the hashed scripts and stylesheets from the cache, their content
+// never changes. Anything else, navigations included, isn't intercepted.
 self.addEventListener("fetch", (event) => {
+  const url = new URL(event.request.url);
+  if (event.request.method !== "GET" || url.origin !== self.location.origin || !CACHED.has(url.pathname)) {
+    return;
+  }
   event.respondWith(
     caches.match(event.request).then((response) => {
       return response || fetch(event.request);
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pynezz/wasmdash/pkg/auth"
+	"github.com/pynezz/wasmdash/pkg/config"
+	"github.com/pynezz/wasmdash/pkg/storage"
+)
+
+const tokenHelp = `Usage:
+    wasmdash [--config FILE] token keygen [ed25519|hmac]
+    wasmdash [--config FILE] token create --account ID [--scope read] [--ttl 720h] [--name NAME]
+    wasmdash [--config FILE] token list
+    wasmdash [--config FILE] token revoke ID
+
+keygen prints a new key for [api] signing_key, ed25519 unless hmac is asked for.
+create prints a signed token for the account, which is only shown once.
+Scopes are read, write and admin, comma-separated, and can't exceed the
+role of the account. Tokens are kept in [storage] path, so the server sees
+tokens created and revoked here while it's running.`
+
+// tokenCommand implements `wasmdash token` and returns the exit code
+func tokenCommand(configPath string, args []string) int {
+	if len(args) == 0 || args[0] == "help" || args[0] == "--help" || args[0] == "-h" {
+		fmt.Println(tokenHelp)
+		return 0
+	}
+
+	var err error
+	switch args[0] {
+	case "keygen":
+		err = tokenKeygen(args[1:])
+	case "create", "list", "revoke":
+		err = withTokenStore(configPath, args[0], args[1:])
+	default:
+		fmt.Fprintf(os.Stderr, "token: unknown command %q\n\n%s\n", args[0], tokenHelp)
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "token %s: %v\n", args[0], err)
+		return 1
+	}
+	return 0
+}
+
+func tokenKeygen(args []string) error {
+	kind := "ed25519"
+	if len(args) > 0 {
+		kind = args[0]
+	}
+	key, err := auth.GenerateSigningKey(kind)
+	if err != nil {
+		return err
+	}
+	fmt.Println(key)
+	return nil
+}
+
+// withTokenStore runs a token command against the configured store
+func withTokenStore(configPath, command string, args []string) error {
+	settings, err := config.Load(configPath)
+	if err != nil {
+		return err
+	}
+	if settings.Storage.Path == "" {
+		return errors.New("tokens need [storage] path, an in-memory store is gone when this command exits")
+	}
+	store, err := openStore(settings.Storage.Path)
+	if err != nil {
+		return fmt.Errorf("opening storage: %w", err)
+	}
+	defer store.Close()
+
+	ctx := context.Background()
+	switch command {
+	case "create":
+		return tokenCreate(ctx, store, settings.API.SigningKey, args)
+	case "list":
+		return tokenList(ctx, store)
+	default:
+		return tokenRevoke(ctx, store, args)
+	}
+}
+
+func tokenCreate(ctx context.Context, store storage.Store, key string, args []string) error {
+	flags := flag.NewFlagSet("token create", flag.ContinueOnError)
+	account := flags.String("account", "", "Account the token acts for")
+	scope := flags.String("scope", auth.ScopeRead, "Comma-separated scopes: "+strings.Join(auth.Scopes, ", "))
+	ttl := flags.Duration("ttl", 30*24*time.Hour, "How long the token is valid")
+	name := flags.String("name", "", "What the token is for")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *account == "" {
+		return errors.New("--account is required")
+	}
+	if key == "" {
+		return errors.New("set [api] signing_key first, generate one with `wasmdash token keygen`")
+	}
+	signer, err := auth.ParseSigningKey(key)
+	if err != nil {
+		return fmt.Errorf("api.signing_key: %w", err)
+	}
+
+	signed, issued, err := storage.IssueToken(ctx, store, signer, auth.Token{
+		Name:    *name,
+		Account: *account,
+		Scopes:  strings.Split(*scope, ","),
+	}, *ttl)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Token %s for %q, expires %s:\n", issued.ID, issued.Account, issued.ExpiresAt.Local().Format(time.DateTime))
+	fmt.Println(signed)
+	return nil
+}
+
+func tokenList(ctx context.Context, store storage.Store) error {
+	tokens, err := store.Tokens(ctx)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tNAME\tACCOUNT\tSCOPES\tEXPIRES\tSTATUS")
+	for _, t := range tokens {
+		status := "active"
+		switch {
+		case !t.RevokedAt.IsZero():
+			status = "revoked"
+		case !t.Active(now):
+			status = "expired"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", t.ID, t.Name, t.Account,
+			strings.Join(t.Scopes, ","), t.ExpiresAt.Local().Format(time.DateTime), status)
+	}
+	return w.Flush()
+}
+
+func tokenRevoke(ctx context.Context, store storage.Store, args []string) error {
+	if len(args) != 1 {
+		return errors.New("expected the ID of the token to revoke, see `wasmdash token list`")
+	}
+	if err := store.RevokeToken(ctx, args[0], time.Now()); errors.Is(err, storage.ErrNotFound) {
+		return fmt.Errorf("no token %q", args[0])
+	} else if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Token %s revoked\n", args[0])
+	return nil
+}